@@ -0,0 +1,130 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/polyrepopro/api/config"
+)
+
+// defaultSecrets are the variable name patterns whose values are always masked.
+var defaultSecrets = []string{
+	"*TOKEN*",
+	"*SECRET*",
+	"*PASSWORD*",
+	"*PASSWD*",
+	"*API_KEY*",
+	"*PRIVATE_KEY*",
+	"*CREDENTIAL*",
+}
+
+// minSecretLength is the length below which values are not masked, masking
+// very short values would mangle unrelated output.
+const minSecretLength = 4
+
+const secretMask = "****"
+
+// Env returns the environment a command is started with.
+//
+// The environment starts from the variables of the current process, or only
+// the inherited ones when cleanEnv is set. The env files are loaded on top in
+// order and the command env is applied last.
+//
+// Arguments:
+//   - command: The command.
+//   - dir: The directory relative env files are resolved against.
+//
+// Returns:
+//   - []string: The environment in "KEY=value" form, sorted by key.
+//   - *strings.Replacer: Masks the values of secret variables.
+//   - error: An error if an env file could not be read.
+func Env(command config.Command, dir string) ([]string, *strings.Replacer, error) {
+	environment := command.Environment.Resolve(dir)
+
+	vars := make(map[string]string)
+	for _, kv := range os.Environ() {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+		if environment.CleanEnv && !matchName(environment.InheritEnv, k, false) {
+			continue
+		}
+		vars[k] = v
+	}
+
+	for _, file := range environment.EnvFile {
+		values, err := godotenv.Read(file)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read env file %q: %w", file, err)
+		}
+		for k, v := range values {
+			vars[k] = v
+		}
+	}
+
+	for k, v := range command.Env {
+		vars[k] = v
+	}
+
+	env := make([]string, 0, len(vars))
+	var secrets []string
+	secretNames := slices.Concat(defaultSecrets, environment.Secrets)
+	for k, v := range vars {
+		env = append(env, fmt.Sprintf("%s=%s", k, v))
+		if len(v) >= minSecretLength && matchName(secretNames, k, true) {
+			secrets = append(secrets, v)
+		}
+	}
+	sort.Strings(env)
+
+	// Longer values are masked first so a secret containing another is masked whole.
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+	pairs := make([]string, 0, len(secrets)*2)
+	for _, secret := range secrets {
+		pairs = append(pairs, secret, secretMask)
+	}
+
+	return env, strings.NewReplacer(pairs...), nil
+}
+
+// matchName reports whether a variable name matches any of the patterns,
+// ignoring case when fold is set.
+func matchName(patterns []string, name string, fold bool) bool {
+	if fold {
+		name = strings.ToUpper(name)
+	}
+	for _, pattern := range patterns {
+		if fold {
+			pattern = strings.ToUpper(pattern)
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// InheritEnvironment returns copies of the commands with their environment
+// layered on top of the environment of a workspace, repository or runner.
+//
+// Arguments:
+//   - commands: The commands.
+//   - parent: The environment of the less specific level, with its env files resolved.
+//   - dir: The directory the relative env files of the commands are resolved against.
+//
+// Returns:
+//   - []config.Command: The commands with the combined environment.
+func InheritEnvironment(commands []config.Command, parent config.Environment, dir string) []config.Command {
+	inherited := make([]config.Command, len(commands))
+	for i, command := range commands {
+		command.Environment = command.Environment.Resolve(dir).Inherit(parent)
+		inherited[i] = command
+	}
+	return inherited
+}
@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert"
+	"github.com/polyrepopro/api/config"
+)
+
+func TestEnv(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "base.env"), []byte("# shared\nLEVEL=base\nPORT=8080\nAPI_TOKEN=s3cr3t-token\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "local.env"), []byte("LEVEL=local\nDATABASE_URL=postgres://user:hunter2@db\n"), 0644))
+	t.Setenv("POLYREPO_TEST_KEEP", "kept")
+	t.Setenv("POLYREPO_TEST_DROP", "dropped")
+
+	command := config.Command{
+		Name: "env",
+		Env:  map[string]string{"PORT": "9090"},
+		Environment: config.Environment{
+			EnvFile:    config.EnvFiles{"base.env", "local.env"},
+			CleanEnv:   true,
+			InheritEnv: []string{"POLYREPO_TEST_K*"},
+			Secrets:    []string{"database_url"},
+		},
+	}
+
+	env, mask, err := Env(command, dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"API_TOKEN=s3cr3t-token",
+		"DATABASE_URL=postgres://user:hunter2@db",
+		"LEVEL=local",
+		"POLYREPO_TEST_KEEP=kept",
+		"PORT=9090",
+	}, env)
+	assert.Equal(t, "token **** url ****", mask.Replace("token s3cr3t-token url postgres://user:hunter2@db"))
+
+	command.CleanEnv = false
+	env, _, err = Env(command, dir)
+	assert.NoError(t, err)
+	assert.Contains(t, env, "POLYREPO_TEST_DROP=dropped")
+
+	command.EnvFile = config.EnvFiles{"missing.env"}
+	_, _, err = Env(command, dir)
+	assert.Error(t, err)
+}
+
+func TestInheritEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "workspace.env"), []byte("LEVEL=workspace\nWORKSPACE=1\n"), 0644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "api"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "api", ".env"), []byte("LEVEL=repository\n"), 0644))
+
+	workspace := &config.Workspace{
+		Name:        "test",
+		Path:        dir,
+		Environment: config.Environment{EnvFile: config.EnvFiles{"workspace.env"}},
+	}
+	repository := &config.Repository{
+		Name:        "api",
+		Path:        "api",
+		Environment: config.Environment{EnvFile: config.EnvFiles{".env"}},
+	}
+
+	commands := InheritEnvironment([]config.Command{
+		{Name: "print", Command: []string{"sh", "-c", `test "$LEVEL-$WORKSPACE" = "repository-1"`}},
+	}, workspace.GetEnvironment(repository), filepath.Join(dir, "api"))
+
+	_, err := ExecuteAll(context.Background(), "test", commands, filepath.Join(dir, "api"), nil)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,185 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mateothegreat/go-multilog/multilog"
+	"github.com/polyrepopro/api/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Outcome is the outcome of running a command with its timeout and retries.
+type Outcome struct {
+	Name string `json:"name"`
+	// Attempts is the number of times the command was started.
+	Attempts int `json:"attempts"`
+	// Duration is the time spent on every attempt, including the retry delays.
+	Duration time.Duration `json:"duration"`
+	// ExitCode is the exit code of the last attempt, -1 if it was terminated by a signal or not started.
+	ExitCode int  `json:"exitCode"`
+	TimedOut bool `json:"timedOut"`
+	// Skipped is set when the command was not run because an earlier command failed with exitOnError.
+	Skipped bool   `json:"skipped"`
+	Error   string `json:"error,omitempty"`
+	// Output is the captured output of the last attempt, see Output.Capture.
+	Output    string `json:"output,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// Execute runs a command, stopping each attempt after the command timeout and
+// retrying failed attempts up to the configured number of retries.
+//
+// Arguments:
+//   - ctx: The context for the command, cancelling it stops the command without retrying.
+//   - label: The label used when logging the output.
+//   - command: The command to run.
+//   - cwd: The directory to run the command in, relative command cwd values are resolved against it.
+//   - output: Where the output is sent and how much of it is captured, nil only logs it.
+//
+// Returns:
+//   - *Outcome: The outcome of the command.
+//   - error: The error of the last attempt if every attempt failed.
+func Execute(ctx context.Context, label string, command config.Command, cwd string, output *Output) (*Outcome, error) {
+	outcome := &Outcome{Name: command.Name, ExitCode: -1}
+	start := time.Now()
+	defer func() { outcome.Duration = time.Since(start) }()
+
+	var err error
+	for attempt := 0; attempt <= max(command.Retries, 0); attempt++ {
+		if attempt > 0 {
+			multilog.Warn(label, "retrying command", map[string]interface{}{
+				"name":    command.Name,
+				"attempt": attempt + 1,
+				"error":   err.Error(),
+			})
+			timer := time.NewTimer(command.RetryDelay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				outcome.Error = err.Error()
+				return outcome, err
+			case <-timer.C:
+			}
+		}
+
+		attemptCtx := ctx
+		cancel := func() {}
+		if command.Timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, command.Timeout)
+		}
+
+		var result *Result
+		outcome.Attempts++
+		result, err = Run(attemptCtx, label, command, cwd, output)
+		outcome.TimedOut = ctx.Err() == nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded)
+		cancel()
+
+		outcome.ExitCode = -1
+		outcome.Output = ""
+		outcome.Truncated = false
+		if result != nil {
+			outcome.ExitCode = result.ExitCode
+			outcome.Output = result.Output
+			outcome.Truncated = result.Truncated
+		}
+		if outcome.TimedOut {
+			err = fmt.Errorf("command %q timed out after %s", command.Name, command.Timeout)
+		}
+		if err == nil {
+			outcome.Error = ""
+			return outcome, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	outcome.Error = err.Error()
+	return outcome, err
+}
+
+// ExecuteAll runs commands in order with Execute. When a command fails the
+// remaining commands are skipped unless it has exitOnError set to false, in
+// which case they still run. When ctx carries a recording span, such as the span of a hook,
+// every command is traced as a child span.
+//
+// Arguments:
+//   - ctx: The context for the commands.
+//   - label: The label used when logging the output.
+//   - commands: The commands to run.
+//   - cwd: The directory to run the commands in, relative command cwd values are resolved against it.
+//   - output: Where the output is sent and how much of it is captured, nil only logs it.
+//
+// Returns:
+//   - []Outcome: The outcome of every command in order.
+//   - error: The errors of the commands that failed.
+func ExecuteAll(ctx context.Context, label string, commands []config.Command, cwd string, output *Output) ([]Outcome, error) {
+	outcomes := make([]Outcome, 0, len(commands))
+	var errs []error
+	aborted := false
+
+	for i, command := range commands {
+		if aborted || ctx.Err() != nil {
+			outcomes = append(outcomes, Outcome{Name: command.Name, ExitCode: -1, Skipped: true})
+			continue
+		}
+
+		outcome, err := executeTraced(ctx, label, command, cwd, output)
+		outcomes = append(outcomes, *outcome)
+		if err == nil {
+			continue
+		}
+
+		errs = append(errs, fmt.Errorf("command %q failed: %w", command.Name, err))
+		if command.ExitsOnError() {
+			aborted = true
+			continue
+		}
+		if ctx.Err() == nil && i < len(commands)-1 {
+			multilog.Warn(label, "command failed, continuing", map[string]interface{}{
+				"name":  command.Name,
+				"error": err.Error(),
+			})
+		}
+	}
+
+	return outcomes, errors.Join(errs...)
+}
+
+// tracer returns the tracer of commands from the global tracer provider.
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/polyrepopro/api/commands")
+}
+
+// executeTraced runs a command with Execute in a span when ctx is traced.
+// Runners are not traced as their commands would keep a span open for as long
+// as they run.
+func executeTraced(ctx context.Context, label string, command config.Command, cwd string, output *Output) (*Outcome, error) {
+	if !trace.SpanFromContext(ctx).IsRecording() {
+		return Execute(ctx, label, command, cwd, output)
+	}
+
+	ctx, span := tracer().Start(ctx, "command "+command.Name, trace.WithAttributes(
+		attribute.String("command.name", command.Name),
+		attribute.String("command.cwd", cwd),
+	))
+	defer span.End()
+
+	outcome, err := Execute(ctx, label, command, cwd, output)
+	span.SetAttributes(
+		attribute.Int("command.exit_code", outcome.ExitCode),
+		attribute.Int("command.attempts", outcome.Attempts),
+		attribute.Bool("command.timed_out", outcome.TimedOut),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return outcome, err
+}
@@ -0,0 +1,76 @@
+package commands
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert"
+	"github.com/polyrepopro/api/config"
+)
+
+func TestExecuteRetries(t *testing.T) {
+	dir := t.TempDir()
+
+	// Fails until the third attempt.
+	outcome, err := Execute(context.Background(), "test", config.Command{
+		Name:       "flaky",
+		Command:    []string{"sh", "-c", "echo x >> attempts; test $(wc -l < attempts) -ge 3"},
+		Retries:    3,
+		RetryDelay: 10 * time.Millisecond,
+	}, dir, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, outcome.Attempts)
+	assert.Equal(t, 0, outcome.ExitCode)
+	assert.Equal(t, "", outcome.Error)
+
+	outcome, err = Execute(context.Background(), "test", config.Command{
+		Name:    "fail",
+		Command: []string{"sh", "-c", "exit 4"},
+		Retries: 1,
+	}, dir, nil)
+	assert.Error(t, err)
+	assert.Equal(t, 2, outcome.Attempts)
+	assert.Equal(t, 4, outcome.ExitCode)
+	assert.False(t, outcome.TimedOut)
+}
+
+func TestExecuteTimeout(t *testing.T) {
+	start := time.Now()
+	outcome, err := Execute(context.Background(), "test", config.Command{
+		Name:    "slow",
+		Command: []string{"sleep", "30"},
+		Timeout: 100 * time.Millisecond,
+		Retries: 1,
+	}, "", nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out")
+	assert.True(t, outcome.TimedOut)
+	assert.Equal(t, 2, outcome.Attempts)
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestExecuteAllExitOnError(t *testing.T) {
+	continues := false
+	commands := []config.Command{
+		{Name: "first", Command: []string{"false"}, ExitOnError: &continues},
+		{Name: "second", Command: []string{"false"}},
+		{Name: "third", Command: []string{"true"}},
+	}
+
+	outcomes, err := ExecuteAll(context.Background(), "test", commands, "", nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `command "first" failed`)
+	assert.Contains(t, err.Error(), `command "second" failed`)
+	assert.Equal(t, 3, len(outcomes))
+	assert.Equal(t, 1, outcomes[0].ExitCode)
+	assert.Equal(t, 1, outcomes[1].Attempts)
+	assert.True(t, outcomes[2].Skipped)
+	assert.Equal(t, 0, outcomes[2].Attempts)
+
+	commands[1].ExitOnError = &continues
+	outcomes, err = ExecuteAll(context.Background(), "test", commands, "", nil)
+	assert.Error(t, err)
+	assert.False(t, outcomes[2].Skipped)
+	assert.Equal(t, 0, outcomes[2].ExitCode)
+}
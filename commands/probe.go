@@ -0,0 +1,137 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/polyrepopro/api/config"
+)
+
+const (
+	defaultProbeInterval = 500 * time.Millisecond
+	probeCheckTimeout    = 5 * time.Second
+)
+
+// readiness waits for a runner to become ready according to its probe.
+type readiness struct {
+	probe   *config.Probe
+	base    string
+	pattern *regexp.Regexp
+	matched chan struct{}
+	once    sync.Once
+}
+
+// newReadiness prepares the readiness probe of a single run of a runner.
+//
+// Arguments:
+//   - probe: The probe, nil when the runner is ready once it is started.
+//   - base: The directory probe commands run in.
+//
+// Returns:
+//   - *readiness: The readiness probe.
+//   - error: An error if the log pattern is not valid.
+func newReadiness(probe *config.Probe, base string) (*readiness, error) {
+	r := &readiness{probe: probe, base: base, matched: make(chan struct{})}
+	if probe != nil && probe.Log != "" {
+		pattern, err := regexp.Compile(probe.Log)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log pattern %q: %w", probe.Log, err)
+		}
+		r.pattern = pattern
+	}
+	return r, nil
+}
+
+// line is called with every line of the runner output.
+func (r *readiness) line(line string) {
+	if r.pattern != nil && r.pattern.MatchString(line) {
+		r.once.Do(func() { close(r.matched) })
+	}
+}
+
+// wait blocks until the probe succeeds.
+//
+// Arguments:
+//   - ctx: The context of the run, the probe is abandoned when it is cancelled.
+//
+// Returns:
+//   - error: An error if the probe timed out or the context was cancelled.
+func (r *readiness) wait(ctx context.Context) error {
+	if r.probe == nil {
+		return nil
+	}
+	if r.probe.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.probe.Timeout)
+		defer cancel()
+	}
+
+	if r.pattern != nil {
+		select {
+		case <-r.matched:
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("no output matched %q: %w", r.probe.Log, ctx.Err())
+		}
+	}
+
+	interval := r.probe.Interval
+	if interval <= 0 {
+		interval = defaultProbeInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var err error
+	for {
+		if err = r.check(ctx); err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ctx.Err(), err)
+		case <-ticker.C:
+		}
+	}
+}
+
+// check runs the probe once.
+func (r *readiness) check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, probeCheckTimeout)
+	defer cancel()
+
+	switch {
+	case r.probe.TCP != "":
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", r.probe.TCP)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case r.probe.HTTP != "":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.probe.HTTP, nil)
+		if err != nil {
+			return err
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			return fmt.Errorf("%s responded with status %d", r.probe.HTTP, res.StatusCode)
+		}
+		return nil
+	case len(r.probe.Command) > 0:
+		cmd := exec.CommandContext(ctx, r.probe.Command[0], r.probe.Command[1:]...)
+		cmd.Dir = r.base
+		return cmd.Run()
+	}
+	return fmt.Errorf("readiness probe has no check")
+}
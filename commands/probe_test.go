@@ -0,0 +1,62 @@
+package commands
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert"
+	"github.com/polyrepopro/api/config"
+)
+
+func TestReadinessProbes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	ready := []*config.Probe{
+		{HTTP: server.URL + "/healthz"},
+		{TCP: listener.Addr().String()},
+		{Command: []string{"true"}},
+	}
+	for _, probe := range ready {
+		r, err := newReadiness(probe, t.TempDir())
+		assert.NoError(t, err)
+		assert.NoError(t, r.wait(context.Background()))
+	}
+
+	notReady := []*config.Probe{
+		{HTTP: server.URL + "/other"},
+		{Command: []string{"false"}},
+		{Log: "^ready$"},
+	}
+	for _, probe := range notReady {
+		probe.Interval = 10 * time.Millisecond
+		probe.Timeout = 100 * time.Millisecond
+		r, err := newReadiness(probe, t.TempDir())
+		assert.NoError(t, err)
+		assert.Error(t, r.wait(context.Background()))
+	}
+}
+
+func TestReadinessLog(t *testing.T) {
+	r, err := newReadiness(&config.Probe{Log: "listening on :\\d+"}, "")
+	assert.NoError(t, err)
+
+	go func() {
+		r.line("starting")
+		r.line("listening on :8080")
+		r.line("listening on :8080")
+	}()
+	assert.NoError(t, r.wait(context.Background()))
+}
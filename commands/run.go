@@ -1,105 +1,437 @@
 package commands
 
 import (
-	"bufio"
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/mateothegreat/go-multilog/multilog"
 	"github.com/mateothegreat/go-util/files"
 	"github.com/polyrepopro/api/config"
 )
 
-func Run(ctx context.Context, label string, command config.Command, cwd string) error {
-	if command.Cwd != "" {
-		if err := os.Chdir(files.ExpandPath(command.Cwd)); err != nil {
-			multilog.Error(label, "failed to change directory", map[string]interface{}{
-				"command": command,
-				"error":   err,
-			})
-			return err
-		}
-	} else if cwd != "" {
-		if err := os.Chdir(files.ExpandPath(cwd)); err != nil {
-			multilog.Error(label, "failed to change directory", map[string]interface{}{
-				"command": command,
+// ResolveDir returns the directory a command runs in.
+// A relative command cwd is resolved against the base directory, which is
+// usually the repository or workspace path.
+//
+// Arguments:
+//   - command: The command to resolve the directory for.
+//   - base: The directory relative cwd values are resolved against.
+//
+// Returns:
+//   - string: The directory to run the command in.
+func ResolveDir(command config.Command, base string) string {
+	if base != "" {
+		base = files.ExpandPath(base)
+	}
+	if command.Cwd == "" {
+		return base
+	}
+
+	dir := files.ExpandPath(command.Cwd)
+	if filepath.IsAbs(dir) || base == "" {
+		return dir
+	}
+	return filepath.Join(base, dir)
+}
+
+// ExitReason describes how a command's process ended.
+type ExitReason string
+
+const (
+	// ExitReasonExited means the process exited on its own.
+	ExitReasonExited ExitReason = "exited"
+	// ExitReasonSignaled means the process was terminated by a signal it was not sent by Run.
+	ExitReasonSignaled ExitReason = "signaled"
+	// ExitReasonStopped means the process ended after receiving the stop signal.
+	ExitReasonStopped ExitReason = "stopped"
+	// ExitReasonKilled means the process group was killed after the stop timeout elapsed.
+	ExitReasonKilled ExitReason = "killed"
+)
+
+// Result describes how a command exited.
+type Result struct {
+	// ExitCode is the exit code of the process, -1 if it was terminated by a signal.
+	ExitCode int `json:"exitCode"`
+	// Signal is the name of the signal that terminated the process, if any.
+	Signal   string        `json:"signal,omitempty"`
+	Reason   ExitReason    `json:"reason"`
+	Duration time.Duration `json:"duration"`
+	// Output is the tail of the combined stdout and stderr when capturing is enabled,
+	// with the values of secret variables masked.
+	Output string `json:"output,omitempty"`
+	// Truncated is set when the output exceeded the capture limit and its beginning was dropped.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// DefaultCapture is a capture limit suitable for keeping the output of hooks in reports.
+const DefaultCapture = 64 * 1024
+
+// Output configures where the output of a command is sent.
+// A nil Output logs the output and does not capture it.
+type Output struct {
+	// Stdout and Stderr receive the raw output of the command as it is produced.
+	Stdout io.Writer
+	Stderr io.Writer
+	// Mask sends Stdout and Stderr complete lines with the values of secret variables masked.
+	Mask bool
+	// Capture is the number of bytes of combined output kept in the Result,
+	// the oldest output is dropped once it is exceeded. Zero captures nothing.
+	Capture int
+	// Quiet stops the output from being logged.
+	Quiet bool
+
+	// lines is called with every line of output.
+	lines func(line string)
+}
+
+// Run runs a command until it exits or the context is cancelled, logging its
+// output and sending it to the sinks of the output configuration.
+// The process working directory is never changed so commands can run concurrently.
+// A command with a shell script is run with its interpreter, see config.Command.Argv.
+//
+// The command is started in its own process group. When the context is cancelled
+// the group is sent the command's stop signal (SIGTERM by default) and, if it is
+// still running after the stop timeout, SIGKILL.
+//
+// Arguments:
+//   - ctx: The context for the command, cancelling it stops the command.
+//   - label: The label used when logging the output.
+//   - command: The command to run.
+//   - cwd: The directory to run the command in, relative command cwd values are resolved against it.
+//   - output: Where the output is sent and how much of it is captured, nil only logs it.
+//
+// Returns:
+//   - *Result: How the command exited, nil if it could not be started.
+//   - error: An error if the command could not be started or did not exit successfully.
+func Run(ctx context.Context, label string, command config.Command, cwd string, output *Output) (*Result, error) {
+	if output == nil {
+		output = &Output{}
+	}
+
+	argv := command.Argv()
+	if len(argv) == 0 {
+		return nil, fmt.Errorf("command %q has nothing to run", command.Name)
+	}
+
+	stopSignal, err := ParseSignal(command.StopSignal)
+	if err != nil {
+		return nil, fmt.Errorf("command %q: %w", command.Name, err)
+	}
+	stopTimeout := command.StopTimeout
+	if stopTimeout <= 0 {
+		stopTimeout = defaultStopTimeout
+	}
+
+	dir := ResolveDir(command, cwd)
+	if dir != "" {
+		if stat, err := os.Stat(dir); err != nil || !stat.IsDir() {
+			multilog.Error(label, "invalid working directory", map[string]interface{}{
+				"command": command.Name,
+				"dir":     dir,
 				"error":   err,
 			})
-			return err
+			return nil, fmt.Errorf("invalid working directory %q for command %q", dir, command.Name)
 		}
 	}
 
-	cmd := exec.CommandContext(ctx, command.Command[0], command.Command[1:]...)
-	env := os.Environ()
-	for k, v := range command.Env {
-		env = append(env, fmt.Sprintf("%s=%s", k, v))
+	env, mask, err := Env(command, cwd)
+	if err != nil {
+		return nil, fmt.Errorf("command %q: %w", command.Name, err)
 	}
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = dir
 	cmd.Env = env
 
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		multilog.Error(label, "failed to get stdout pipe", map[string]interface{}{
-			"command": command,
-			"error":   err,
-		})
-		return err
+	stdout := &logWriter{label: label, name: command.Name, level: multilog.INFO, stream: "stdout", mask: mask, quiet: output.Quiet, onLine: output.lines}
+	stderr := &logWriter{label: label, name: command.Name, level: multilog.ERROR, stream: "stderr", mask: mask, quiet: output.Quiet, onLine: output.lines}
+	stdoutWriters := []io.Writer{stdout}
+	stderrWriters := []io.Writer{stderr}
+	if output.Stdout != nil {
+		sink := output.Stdout
+		if output.Mask {
+			masked := &maskWriter{w: sink, mask: mask}
+			defer masked.Flush()
+			sink = masked
+		}
+		stdoutWriters = append(stdoutWriters, sink)
 	}
+	if output.Stderr != nil {
+		sink := output.Stderr
+		if output.Mask {
+			masked := &maskWriter{w: sink, mask: mask}
+			defer masked.Flush()
+			sink = masked
+		}
+		stderrWriters = append(stderrWriters, sink)
+	}
+	var capture *tailBuffer
+	var captured []*maskWriter
+	if output.Capture > 0 {
+		// Lines are masked before they are captured, a secret cut by the
+		// truncation of the tail would no longer match once truncated.
+		capture = &tailBuffer{limit: output.Capture}
+		captured = []*maskWriter{{w: capture, mask: mask}, {w: capture, mask: mask}}
+		stdoutWriters = append(stdoutWriters, captured[0])
+		stderrWriters = append(stderrWriters, captured[1])
+	}
+	cmd.Stdout = io.MultiWriter(stdoutWriters...)
+	cmd.Stderr = io.MultiWriter(stderrWriters...)
 
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		multilog.Error(label, "failed to get stderr pipe", map[string]interface{}{
-			"command": command,
-			"error":   err,
+	// Run the command in its own process group so the whole tree can be signalled.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	var mu sync.Mutex
+	var stopped, killed bool
+	exited := make(chan struct{})
+
+	cmd.Cancel = func() error {
+		pgid := cmd.Process.Pid
+		mu.Lock()
+		stopped = true
+		mu.Unlock()
+
+		multilog.Debug(label, "stopping command", map[string]interface{}{
+			"name":   command.Name,
+			"signal": stopSignal.String(),
 		})
-		return err
+		if err := syscall.Kill(-pgid, stopSignal); err != nil && err != syscall.ESRCH {
+			return err
+		}
+
+		go func() {
+			timer := time.NewTimer(stopTimeout)
+			defer timer.Stop()
+			select {
+			case <-exited:
+				// The leader is gone, only wait for the rest of the group if it is still alive.
+				if syscall.Kill(-pgid, 0) != nil {
+					return
+				}
+				<-timer.C
+			case <-timer.C:
+			}
+			if syscall.Kill(-pgid, syscall.SIGKILL) == nil {
+				mu.Lock()
+				killed = true
+				mu.Unlock()
+				multilog.Warn(label, "killed command after stop timeout", map[string]interface{}{
+					"name":    command.Name,
+					"timeout": stopTimeout.String(),
+				})
+			}
+		}()
+		return nil
 	}
+	// Bound how long Wait blocks on processes that ignore the stop signal or
+	// background processes that inherited the output pipes.
+	cmd.WaitDelay = stopTimeout + waitDelay
 
+	start := time.Now()
 	err = cmd.Start()
 	if err != nil {
 		multilog.Error(label, "failed to start command", map[string]interface{}{
 			"name":  command.Name,
 			"error": err,
 		})
-		return err
+		return nil, err
 	}
 
-	go func() {
-		scanner := bufio.NewScanner(stdout)
-		for scanner.Scan() {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				multilog.Info(label, "stdout", map[string]interface{}{
-					"name":   command.Name,
-					"output": scanner.Text(),
-				})
-			}
-		}
-	}()
+	err = cmd.Wait()
+	close(exited)
+	stdout.Flush()
+	stderr.Flush()
+	for _, w := range captured {
+		w.Flush()
+	}
 
-	go func() {
-		scanner := bufio.NewScanner(stderr)
-		for scanner.Scan() {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				multilog.Error(label, "stderr", map[string]interface{}{
-					"name":   command.Name,
-					"output": scanner.Text(),
-				})
-			}
+	mu.Lock()
+	defer mu.Unlock()
+
+	result := &Result{
+		ExitCode: cmd.ProcessState.ExitCode(),
+		Reason:   ExitReasonExited,
+		Duration: time.Since(start),
+	}
+	if capture != nil {
+		tail, truncated := capture.Tail()
+		result.Output = tail
+		result.Truncated = truncated
+	}
+	if cmd.ProcessState == nil {
+		return result, err
+	}
+	if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		result.Signal = status.Signal().String()
+		result.Reason = ExitReasonSignaled
+	}
+	switch {
+	case killed:
+		result.Reason = ExitReasonKilled
+	case stopped:
+		result.Reason = ExitReasonStopped
+	}
+
+	return result, err
+}
+
+// ParseSignal parses a signal name such as "SIGTERM", "TERM" or "sigint".
+// An empty name returns SIGTERM.
+//
+// Arguments:
+//   - name: The signal name.
+//
+// Returns:
+//   - syscall.Signal: The signal.
+//   - error: An error if the signal is not supported.
+func ParseSignal(name string) (syscall.Signal, error) {
+	if name == "" {
+		return syscall.SIGTERM, nil
+	}
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	signal, ok := signals[name]
+	if !ok {
+		return 0, fmt.Errorf("unsupported stop signal %q", name)
+	}
+	return signal, nil
+}
+
+var signals = map[string]syscall.Signal{
+	"SIGTERM": syscall.SIGTERM,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGKILL": syscall.SIGKILL,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+}
+
+const defaultStopTimeout = 10 * time.Second
+
+const waitDelay = 5 * time.Second
+
+// logWriter logs each complete line written to it.
+type logWriter struct {
+	label  string
+	name   string
+	level  multilog.LogLevel
+	stream string
+	mask   *strings.Replacer
+	quiet  bool
+	onLine func(line string)
+	buf    []byte
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
 		}
-	}()
+		w.log(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
 
-	go func() {
-		<-ctx.Done()
-		syscall.Kill(cmd.Process.Pid, syscall.SIGKILL)
-	}()
+// Flush logs any buffered partial line.
+func (w *logWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.log(string(w.buf))
+		w.buf = nil
+	}
+}
 
-	return cmd.Wait()
+func (w *logWriter) log(line string) {
+	if w.onLine != nil {
+		w.onLine(line)
+	}
+	if w.quiet {
+		return
+	}
+	if w.mask != nil {
+		line = w.mask.Replace(line)
+	}
+	data := map[string]interface{}{
+		"name":   w.name,
+		"output": line,
+	}
+	if w.level == multilog.ERROR {
+		multilog.Error(w.label, w.stream, data)
+	} else {
+		multilog.Info(w.label, w.stream, data)
+	}
+}
+
+// maskWriter writes complete lines to w with the secret values masked.
+type maskWriter struct {
+	w    io.Writer
+	mask *strings.Replacer
+	buf  []byte
+}
+
+func (m *maskWriter) Write(p []byte) (int, error) {
+	m.buf = append(m.buf, p...)
+	i := bytes.LastIndexByte(m.buf, '\n')
+	if i < 0 {
+		return len(p), nil
+	}
+	if _, err := io.WriteString(m.w, m.mask.Replace(string(m.buf[:i+1]))); err != nil {
+		return 0, err
+	}
+	m.buf = m.buf[i+1:]
+	return len(p), nil
+}
+
+// Flush writes any buffered partial line.
+func (m *maskWriter) Flush() {
+	if len(m.buf) > 0 {
+		io.WriteString(m.w, m.mask.Replace(string(m.buf)))
+		m.buf = nil
+	}
+}
+
+// tailBuffer keeps the last limit bytes written to it, it is safe for concurrent use.
+type tailBuffer struct {
+	mu        sync.Mutex
+	limit     int
+	buf       []byte
+	truncated bool
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buf = append(b.buf, p...)
+	// Trim once the buffer holds twice the limit to avoid copying on every write.
+	if len(b.buf) > 2*b.limit {
+		b.buf = append(b.buf[:0], b.buf[len(b.buf)-b.limit:]...)
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+// Tail returns the last limit bytes written and whether earlier bytes were dropped.
+func (b *tailBuffer) Tail() (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.buf) > b.limit {
+		return string(b.buf[len(b.buf)-b.limit:]), true
+	}
+	return string(b.buf), b.truncated
 }
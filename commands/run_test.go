@@ -0,0 +1,229 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert"
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/test"
+)
+
+func TestResolveDir(t *testing.T) {
+	assert.Equal(t, "/repo", ResolveDir(config.Command{}, "/repo"))
+	assert.Equal(t, "/repo/web", ResolveDir(config.Command{Cwd: "web"}, "/repo"))
+	assert.Equal(t, "/tmp", ResolveDir(config.Command{Cwd: "/tmp"}, "/repo"))
+	assert.Equal(t, "web", ResolveDir(config.Command{Cwd: "web"}, ""))
+}
+
+func TestRunConcurrently(t *testing.T) {
+	test.Setup()
+
+	cwd, err := os.Getwd()
+	assert.NoError(t, err)
+
+	base := t.TempDir()
+	var wg sync.WaitGroup
+	errs := make([]error, 20)
+	for i := range errs {
+		dir := filepath.Join(base, fmt.Sprintf("repo-%d", i))
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = Run(context.Background(), "test", config.Command{
+				Name:    "pwd",
+				Cwd:     "sub",
+				Command: []string{"sh", "-c", "pwd > out"},
+			}, dir, nil)
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		assert.NoError(t, err)
+		out, err := os.ReadFile(filepath.Join(base, fmt.Sprintf("repo-%d", i), "sub", "out"))
+		assert.NoError(t, err)
+		assert.True(t, strings.HasSuffix(strings.TrimSpace(string(out)), fmt.Sprintf("repo-%d/sub", i)))
+	}
+
+	after, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.Equal(t, cwd, after)
+}
+
+func TestRunInvalidDir(t *testing.T) {
+	test.Setup()
+
+	_, err := Run(context.Background(), "test", config.Command{
+		Name:    "true",
+		Command: []string{"true"},
+	}, filepath.Join(t.TempDir(), "missing"), nil)
+	assert.Error(t, err)
+}
+
+func TestRunStopsProcessGroup(t *testing.T) {
+	test.Setup()
+
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		cancel()
+	}()
+
+	// The grandchild writes its pid so we can check it was terminated with the group.
+	result, err := Run(ctx, "test", config.Command{
+		Name:    "tree",
+		Command: []string{"sh", "-c", "sleep 30 & echo $! > child; wait"},
+	}, dir, nil)
+	assert.Error(t, err)
+	assert.Equal(t, ExitReasonStopped, result.Reason)
+	assert.Equal(t, "terminated", result.Signal)
+
+	b, err := os.ReadFile(filepath.Join(dir, "child"))
+	assert.NoError(t, err)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	assert.NoError(t, err)
+
+	// The grandchild is either gone or a zombie waiting to be reaped by init.
+	time.Sleep(100 * time.Millisecond)
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err == nil {
+		fields := strings.Fields(string(stat))
+		assert.Equal(t, "Z", fields[2])
+	}
+}
+
+func TestRunKillsAfterStopTimeout(t *testing.T) {
+	test.Setup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		cancel()
+	}()
+
+	result, err := Run(ctx, "test", config.Command{
+		Name:        "stubborn",
+		Command:     []string{"sh", "-c", "trap '' TERM; while true; do sleep 0.1; done"},
+		StopTimeout: 200 * time.Millisecond,
+	}, t.TempDir(), nil)
+	assert.Error(t, err)
+	assert.Equal(t, ExitReasonKilled, result.Reason)
+	assert.Equal(t, "killed", result.Signal)
+}
+
+func TestRunExitCode(t *testing.T) {
+	test.Setup()
+
+	result, err := Run(context.Background(), "test", config.Command{
+		Name:    "exit",
+		Command: []string{"sh", "-c", "exit 3"},
+	}, "", nil)
+	assert.Error(t, err)
+	assert.Equal(t, 3, result.ExitCode)
+	assert.Equal(t, ExitReasonExited, result.Reason)
+
+	_, err = ParseSignal("bogus")
+	assert.Error(t, err)
+	signal, err := ParseSignal("int")
+	assert.NoError(t, err)
+	assert.Equal(t, syscall.SIGINT, signal)
+}
+
+func TestRunShell(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := Run(context.Background(), "test", config.Command{
+		Name:  "pipeline",
+		Shell: "printf 'b\\na\\n' | sort > sorted && test \"$(head -n 1 sorted)\" = a",
+	}, dir, nil)
+	assert.NoError(t, err)
+
+	result, err := Run(context.Background(), "test", config.Command{
+		Name:        "strict",
+		Shell:       "false | true; exit $?",
+		Interpreter: "bash -o pipefail",
+	}, dir, nil)
+	assert.Error(t, err)
+	assert.Equal(t, 1, result.ExitCode)
+
+	// Template values cannot break out of the script.
+	vars := &Vars{Repository: RepositoryVars{Name: "x; touch injected"}}
+	command, err := vars.ExpandCommand(config.Command{Name: "echo", Shell: "echo {{ .Repository.Name }} > name"})
+	assert.NoError(t, err)
+	_, err = Run(context.Background(), "test", command, dir, nil)
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "injected"))
+	assert.True(t, os.IsNotExist(err))
+	name, err := os.ReadFile(filepath.Join(dir, "name"))
+	assert.NoError(t, err)
+	assert.Equal(t, "x; touch injected\n", string(name))
+}
+
+func TestRunOutput(t *testing.T) {
+	test.Setup()
+
+	var stdout, stderr strings.Builder
+	result, err := Run(context.Background(), "test", config.Command{
+		Name:  "print",
+		Shell: "echo out; echo err >&2; echo token=$API_TOKEN",
+		Env:   map[string]string{"API_TOKEN": "s3cr3t-token"},
+	}, t.TempDir(), &Output{Stdout: &stdout, Stderr: &stderr, Capture: DefaultCapture, Quiet: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "out\ntoken=s3cr3t-token\n", stdout.String())
+	assert.Equal(t, "err\n", stderr.String())
+	assert.Contains(t, result.Output, "out\n")
+	assert.Contains(t, result.Output, "err\n")
+	assert.Contains(t, result.Output, "token=****\n")
+	assert.False(t, result.Truncated)
+	assert.True(t, result.Duration > 0)
+
+	result, err = Run(context.Background(), "test", config.Command{
+		Name:  "long",
+		Shell: "seq 1 10000",
+	}, "", &Output{Capture: 10, Quiet: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "999\n10000\n", result.Output)
+	assert.True(t, result.Truncated)
+
+	// A secret is masked before the tail is cut, so no fragment of it is kept.
+	result, err = Run(context.Background(), "test", config.Command{
+		Name:  "secret",
+		Shell: "echo $API_TOKEN",
+		Env:   map[string]string{"API_TOKEN": "s3cr3t-token"},
+	}, "", &Output{Capture: 8, Quiet: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "****\n", result.Output)
+	assert.False(t, result.Truncated)
+
+	result, err = Run(context.Background(), "test", config.Command{Name: "none", Command: []string{"true"}}, "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "", result.Output)
+}
+
+func TestTailBuffer(t *testing.T) {
+	b := &tailBuffer{limit: 4}
+	b.Write([]byte("ab"))
+	tail, truncated := b.Tail()
+	assert.Equal(t, "ab", tail)
+	assert.False(t, truncated)
+
+	for i := 0; i < 10; i++ {
+		b.Write([]byte("cd"))
+	}
+	b.Write([]byte("ef"))
+	tail, truncated = b.Tail()
+	assert.Equal(t, "cdef", tail)
+	assert.True(t, truncated)
+}
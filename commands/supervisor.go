@@ -0,0 +1,660 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mateothegreat/go-multilog/multilog"
+	"github.com/mateothegreat/go-util/files"
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/events"
+	"github.com/polyrepopro/api/logs"
+)
+
+const (
+	defaultRestartDelay    = time.Second
+	defaultMaxRestartDelay = 30 * time.Second
+)
+
+// RunnerStatus is the lifecycle status of a supervised runner.
+type RunnerStatus string
+
+const (
+	// RunnerPending is a runner that has not been started yet.
+	RunnerPending RunnerStatus = "pending"
+	// RunnerRunning is a runner whose commands are running.
+	RunnerRunning RunnerStatus = "running"
+	// RunnerBackoff is a runner waiting to be restarted.
+	RunnerBackoff RunnerStatus = "backoff"
+	// RunnerWaiting is a watched runner that exited and waits for a change to restart.
+	RunnerWaiting RunnerStatus = "waiting"
+	// RunnerExited is a runner that exited successfully and will not be restarted.
+	RunnerExited RunnerStatus = "exited"
+	// RunnerFailed is a runner that failed and will not be restarted.
+	RunnerFailed RunnerStatus = "failed"
+	// RunnerStopped is a runner that was stopped by cancelling its context.
+	RunnerStopped RunnerStatus = "stopped"
+)
+
+// RunnerState is a snapshot of the state of a supervised runner.
+type RunnerState struct {
+	Name       string       `json:"name"`
+	Repository string       `json:"repository,omitempty"`
+	Status     RunnerStatus `json:"status"`
+	Ready      bool         `json:"ready"`
+	Restarts   int          `json:"restarts"`
+	StartedAt  time.Time    `json:"startedAt,omitempty"`
+	ExitedAt   time.Time    `json:"exitedAt,omitempty"`
+	LastError  string       `json:"lastError,omitempty"`
+}
+
+// process supervises a single runner.
+type process struct {
+	label  string
+	base   string
+	runner config.Runner
+	// workspace and repository are used to expand the command templates, when set.
+	workspace  *config.Workspace
+	repository *config.Repository
+	// sink receives the output of the runner commands, when set.
+	sink    io.Writer
+	quiet   bool
+	recent  *logs.Recent
+	logFile *logs.RotatingFile
+	// dependencies must be ready before the runner is started.
+	dependencies []*process
+
+	mu        sync.RWMutex
+	state     RunnerState
+	ready     chan struct{}
+	readyOnce sync.Once
+	done      chan struct{}
+}
+
+func newProcess(label string, repository string, base string, runner config.Runner) *process {
+	return &process{
+		label:  label,
+		base:   base,
+		runner: runner,
+		state: RunnerState{
+			Name:       label,
+			Repository: repository,
+			Status:     RunnerPending,
+		},
+		ready: make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+// State returns a snapshot of the runner state.
+func (p *process) State() RunnerState {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.state
+}
+
+// update changes the runner state and publishes a RunnerState event when its status or readiness changed.
+func (p *process) update(fn func(state *RunnerState)) {
+	p.mu.Lock()
+	before := p.state
+	fn(&p.state)
+	after := p.state
+	p.mu.Unlock()
+
+	if before.Status == after.Status && before.Ready == after.Ready {
+		return
+	}
+	event := events.Event{
+		Type:       events.RunnerState,
+		Repository: after.Repository,
+		Runner:     after.Name,
+		Status:     string(after.Status),
+		Ready:      after.Ready,
+		Restarts:   after.Restarts,
+		Error:      after.LastError,
+	}
+	if p.workspace != nil {
+		event.Workspace = p.workspace.Name
+	}
+	events.Publish(event)
+}
+
+// markReady records that the runner is ready and releases its dependents.
+func (p *process) markReady() {
+	p.update(func(state *RunnerState) { state.Ready = true })
+	p.readyOnce.Do(func() { close(p.ready) })
+}
+
+// waitDependencies blocks until every dependency is ready.
+//
+// Returns:
+//   - error: An error if a dependency stopped before it became ready or the context was cancelled.
+func (p *process) waitDependencies(ctx context.Context) error {
+	for _, dep := range p.dependencies {
+		multilog.Debug(p.label, "waiting for dependency", map[string]interface{}{
+			"dependency": dep.label,
+		})
+		select {
+		case <-dep.ready:
+		case <-dep.done:
+			select {
+			case <-dep.ready:
+			default:
+				return fmt.Errorf("dependency %s stopped before it was ready", dep.label)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// runOnce runs the runner commands in order, honouring their timeouts,
+// retries and exitOnError, and returns the errors of the commands that failed.
+func (p *process) runOnce(ctx context.Context, onLine func(line string)) error {
+	commands := p.runner.Commands
+	environment := p.runner.Environment.Resolve(p.base)
+	if p.repository != nil {
+		// Expanded on every run so values such as the HEAD commit are current.
+		var err error
+		commands, err = NewVars(p.workspace, p.repository).ExpandCommands(commands)
+		if err != nil {
+			return err
+		}
+		environment = environment.Inherit(p.workspace.GetEnvironment(p.repository))
+	}
+	output := &Output{Quiet: p.quiet, lines: onLine}
+	if p.sink != nil {
+		output.Stdout = p.sink
+		output.Stderr = p.sink
+		output.Mask = true
+	}
+	_, err := ExecuteAll(ctx, p.label, InheritEnvironment(commands, environment, p.base), p.base, output)
+	return err
+}
+
+// supervise runs the runner until the context is cancelled, restarting it
+// according to its restart policy and, for watched runners, on file changes.
+// The runner is only started once its dependencies are ready.
+func (p *process) supervise(ctx context.Context) error {
+	defer close(p.done)
+
+	if err := p.waitDependencies(ctx); err != nil {
+		if ctx.Err() != nil {
+			p.update(func(state *RunnerState) { state.Status = RunnerStopped })
+			return nil
+		}
+		p.update(func(state *RunnerState) {
+			state.Status = RunnerFailed
+			state.LastError = err.Error()
+		})
+		return err
+	}
+
+	var changes <-chan string
+	var watchErrors <-chan error
+	if p.runner.Watch {
+		watcher, err := newChangeWatcher(ctx, p.label, p.base, p.runner)
+		if err != nil {
+			p.update(func(state *RunnerState) {
+				state.Status = RunnerFailed
+				state.LastError = err.Error()
+			})
+			return err
+		}
+		changes = watcher.Changes
+		watchErrors = watcher.Errors
+	}
+
+	policy := p.runner.Restart
+	if policy == "" {
+		policy = config.RestartNever
+	}
+	delay := p.runner.RestartDelay
+	if delay <= 0 {
+		delay = defaultRestartDelay
+	}
+	maxDelay := p.runner.MaxRestartDelay
+	if maxDelay <= 0 {
+		maxDelay = defaultMaxRestartDelay
+	}
+	backoff := delay
+
+	for {
+		readiness, err := newReadiness(p.runner.Ready, p.base)
+		if err != nil {
+			p.update(func(state *RunnerState) {
+				state.Status = RunnerFailed
+				state.LastError = err.Error()
+			})
+			return err
+		}
+
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		probed := make(chan error, 1)
+		started := time.Now()
+
+		p.update(func(state *RunnerState) {
+			state.Status = RunnerRunning
+			state.Ready = false
+			state.StartedAt = started
+		})
+		if p.runner.Ready == nil {
+			// A runner without a probe is ready once it is started, even if it exits right away.
+			p.markReady()
+		}
+		go func() {
+			done <- p.runOnce(runCtx, readiness.line)
+		}()
+		go func() {
+			probed <- readiness.wait(runCtx)
+		}()
+
+		changed := false
+	running:
+		for {
+			select {
+			case err = <-done:
+				break running
+			case perr := <-probed:
+				probed = nil
+				if perr == nil {
+					multilog.Info(p.label, "runner is ready", nil)
+					p.markReady()
+					continue
+				}
+				if runCtx.Err() != nil {
+					continue
+				}
+				// A runner that does not become ready in time is treated as failed.
+				cancel()
+				<-done
+				err = fmt.Errorf("readiness probe failed: %w", perr)
+				break running
+			case <-changes:
+				changed = true
+				cancel()
+				<-done
+				break running
+			case werr := <-watchErrors:
+				cancel()
+				<-done
+				p.update(func(state *RunnerState) {
+					state.Status = RunnerFailed
+					state.ExitedAt = time.Now()
+					state.LastError = werr.Error()
+				})
+				return werr
+			}
+		}
+		cancel()
+
+		if err == nil && probed != nil {
+			// The output may have matched the log probe just before the commands exited.
+			select {
+			case <-readiness.matched:
+				p.markReady()
+			default:
+			}
+		}
+
+		p.update(func(state *RunnerState) {
+			state.Ready = false
+			state.ExitedAt = time.Now()
+			state.LastError = ""
+			if err != nil {
+				state.LastError = err.Error()
+			}
+		})
+
+		if ctx.Err() != nil {
+			p.update(func(state *RunnerState) { state.Status = RunnerStopped })
+			return nil
+		}
+
+		if changed {
+			p.update(func(state *RunnerState) { state.Restarts++ })
+			continue
+		}
+
+		if err != nil {
+			multilog.Error(p.label, "runner exited", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+
+		restart := policy == config.RestartAlways || (policy == config.RestartOnFailure && err != nil)
+		if restart && p.runner.MaxRestarts > 0 && p.State().Restarts >= p.runner.MaxRestarts {
+			multilog.Error(p.label, "runner reached the maximum number of restarts", map[string]interface{}{
+				"maxRestarts": p.runner.MaxRestarts,
+			})
+			restart = false
+		}
+
+		if !restart {
+			status := RunnerExited
+			if err != nil {
+				status = RunnerFailed
+			}
+			if !p.runner.Watch {
+				p.update(func(state *RunnerState) { state.Status = status })
+				return nil
+			}
+
+			// Watched runners are started again when a file changes.
+			p.update(func(state *RunnerState) { state.Status = RunnerWaiting })
+			select {
+			case <-ctx.Done():
+				p.update(func(state *RunnerState) { state.Status = RunnerStopped })
+				return nil
+			case <-changes:
+				p.update(func(state *RunnerState) { state.Restarts++ })
+				backoff = delay
+				continue
+			case werr := <-watchErrors:
+				p.update(func(state *RunnerState) {
+					state.Status = RunnerFailed
+					state.LastError = werr.Error()
+				})
+				return werr
+			}
+		}
+
+		// A runner that stayed up longer than the maximum delay starts over with the initial delay.
+		if time.Since(started) > maxDelay {
+			backoff = delay
+		}
+
+		p.update(func(state *RunnerState) { state.Status = RunnerBackoff })
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			p.update(func(state *RunnerState) { state.Status = RunnerStopped })
+			return nil
+		case <-timer.C:
+		}
+
+		backoff = min(backoff*2, maxDelay)
+		p.update(func(state *RunnerState) { state.Restarts++ })
+	}
+}
+
+// SupervisorArgs are the arguments for creating a supervisor.
+type SupervisorArgs struct {
+	Workspace *config.Workspace
+	// Selector limits the supervisor to the runners of the matching repositories.
+	Selector *config.Selector
+	// LogDir is the directory the output of each runner is written to as
+	// "<repository>/<runner>.log", a relative path is resolved against the
+	// workspace path. No log files are written when it is empty.
+	LogDir string
+	// LogMaxSize is the size in bytes a log file is rotated at, zero uses logs.DefaultMaxSize.
+	LogMaxSize int64
+	// LogMaxFiles is the number of rotated log files kept, zero uses logs.DefaultMaxFiles.
+	LogMaxFiles int
+	// Console receives the output of every runner prefixed with the runner name,
+	// padded to the longest name of the selected runners, the output is then no
+	// longer logged through multilog.
+	Console io.Writer
+	// ConsoleColor colors the runner names written to Console.
+	ConsoleColor bool
+	// RecentLines is the number of lines of output kept for each runner for Tail, zero uses logs.DefaultRecentLines.
+	RecentLines int
+}
+
+// Supervisor starts and supervises the runners of a workspace.
+type Supervisor struct {
+	workspace *config.Workspace
+	levels    [][]*process
+	processes []*process
+	wg        sync.WaitGroup
+	mu        sync.Mutex
+	errors    []error
+}
+
+// NewSupervisor creates a supervisor for the runners of the workspace repositories.
+//
+// Arguments:
+//   - args: The arguments for the supervisor.
+//
+// Returns:
+//   - *Supervisor: The supervisor.
+//   - error: An error if the dependencies form a cycle or a runner depends on a runner that is not selected.
+func NewSupervisor(args SupervisorArgs) (*Supervisor, error) {
+	s := &Supervisor{workspace: args.Workspace}
+
+	if err := args.Workspace.ValidateRunnerDependencies(); err != nil {
+		return nil, err
+	}
+
+	levels, err := args.Workspace.GetRepositoryLevels(args.Workspace.SelectRepositories(args.Selector))
+	if err != nil {
+		return nil, err
+	}
+
+	dependencies := make(map[*process][]string)
+
+	for _, level := range levels {
+		var processes []*process
+		for _, repo := range level {
+			if repo.Runners == nil {
+				continue
+			}
+			base := fmt.Sprintf("%s/%s", args.Workspace.GetAbsolutePath(), repo.Path)
+			for i, runner := range *repo.Runners {
+				p := newProcess(repo.RunnerID(i), repo.Name, ResolveDir(config.Command{Cwd: runner.Cwd}, base), runner)
+				p.workspace = args.Workspace
+				p.repository = &repo
+				processes = append(processes, p)
+				s.processes = append(s.processes, p)
+				dependencies[p] = make([]string, 0, len(runner.DependsOn))
+				for _, dep := range runner.DependsOn {
+					dependencies[p] = append(dependencies[p], repo.ResolveRunnerDependency(dep))
+				}
+			}
+		}
+		if len(processes) > 0 {
+			s.levels = append(s.levels, processes)
+		}
+	}
+
+	for _, p := range s.processes {
+		for _, dep := range dependencies[p] {
+			found := false
+			for _, candidate := range s.processes {
+				if candidate.label == dep {
+					p.dependencies = append(p.dependencies, candidate)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("runner %s depends on runner %s which is not selected", p.label, dep)
+			}
+		}
+	}
+
+	// The runners of a repository are started once the runners of the
+	// repositories it depends on are ready, runners of unrelated repositories
+	// do not wait for each other.
+	runners := make(map[string][]*process)
+	for _, p := range s.processes {
+		runners[p.state.Repository] = append(runners[p.state.Repository], p)
+	}
+	for _, level := range levels {
+		for _, repo := range level {
+			for _, name := range repo.DependsOn {
+				for _, dep := range runners[name] {
+					for _, p := range runners[repo.Name] {
+						if !slices.Contains(p.dependencies, dep) {
+							p.dependencies = append(p.dependencies, dep)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	if err := s.openLogs(args); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// openLogs creates the output sinks of every runner.
+func (s *Supervisor) openLogs(args SupervisorArgs) error {
+	dir := args.LogDir
+	if dir != "" && !filepath.IsAbs(files.ExpandPath(dir)) {
+		dir = filepath.Join(args.Workspace.GetAbsolutePath(), dir)
+	}
+
+	var console *logs.Multiplexer
+	if args.Console != nil {
+		labels := make([]string, 0, len(s.processes))
+		for _, p := range s.processes {
+			labels = append(labels, p.label)
+		}
+		console = logs.NewMultiplexer(args.Console, args.ConsoleColor, labels...)
+	}
+
+	for _, p := range s.processes {
+		p.recent = logs.NewRecent(args.RecentLines)
+		sinks := []io.Writer{p.recent}
+		if dir != "" {
+			file, err := logs.NewRotatingFile(logs.RotatingFileArgs{
+				Path:     filepath.Join(files.ExpandPath(dir), p.label+".log"),
+				MaxSize:  args.LogMaxSize,
+				MaxFiles: args.LogMaxFiles,
+			})
+			if err != nil {
+				s.closeLogs()
+				return fmt.Errorf("%s: %w", p.label, err)
+			}
+			p.logFile = file
+			sinks = append(sinks, file)
+		}
+		if console != nil {
+			sinks = append(sinks, console.Writer(p.label))
+			p.quiet = true
+		}
+		p.sink = logs.NewFanOut(p.label, sinks...)
+	}
+	return nil
+}
+
+func (s *Supervisor) closeLogs() {
+	for _, p := range s.processes {
+		if p.logFile != nil {
+			p.logFile.Close()
+		}
+	}
+}
+
+// Start starts every runner in the background. The runners of a repository
+// are started once the runners of the repositories it depends on are ready, or
+// started if they have no readiness probe, and a runner with dependsOn is only
+// started once the runners it depends on are ready. A runner whose dependency
+// stops before it is ready fails without being started.
+// The runners stop when the context is cancelled.
+//
+// Arguments:
+//   - ctx: The context for the runners.
+func (s *Supervisor) Start(ctx context.Context) {
+	for _, level := range s.levels {
+		for _, p := range level {
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				if err := p.supervise(ctx); err != nil {
+					s.mu.Lock()
+					s.errors = append(s.errors, fmt.Errorf("%s: %w", p.label, err))
+					s.mu.Unlock()
+				}
+			}()
+		}
+	}
+}
+
+// Wait blocks until every runner has stopped for good.
+//
+// Returns:
+//   - []error: The errors of runners that could not be supervised.
+func (s *Supervisor) Wait() []error {
+	s.wg.Wait()
+	s.closeLogs()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.errors
+}
+
+// States returns a snapshot of the state of every runner.
+//
+// Returns:
+//   - []RunnerState: The runner states in start order.
+func (s *Supervisor) States() []RunnerState {
+	states := make([]RunnerState, 0, len(s.processes))
+	for _, p := range s.processes {
+		states = append(states, p.State())
+	}
+	return states
+}
+
+// Tail returns the most recent lines of output of a runner.
+//
+// Arguments:
+//   - name: The runner name in the form "repository/runner".
+//   - n: The maximum number of lines, zero or less returns every line kept.
+//
+// Returns:
+//   - []string: The lines, oldest first.
+//   - bool: False if no runner has the name.
+func (s *Supervisor) Tail(name string, n int) ([]string, bool) {
+	for _, p := range s.processes {
+		if p.label == name {
+			return p.recent.Tail(n), true
+		}
+	}
+	return nil, false
+}
+
+// LogPath returns the path of the log file of a runner.
+//
+// Arguments:
+//   - name: The runner name in the form "repository/runner".
+//
+// Returns:
+//   - string: The path, empty if the runner does not exist or has no log file.
+func (s *Supervisor) LogPath(name string) string {
+	for _, p := range s.processes {
+		if p.label == name && p.logFile != nil {
+			return p.logFile.Path()
+		}
+	}
+	return ""
+}
+
+// State returns a snapshot of the state of a runner.
+//
+// Arguments:
+//   - name: The runner name in the form "repository/runner".
+//
+// Returns:
+//   - RunnerState: The runner state.
+//   - bool: False if no runner has the name.
+func (s *Supervisor) State(name string) (RunnerState, bool) {
+	for _, p := range s.processes {
+		if p.label == name {
+			return p.State(), true
+		}
+	}
+	return RunnerState{}, false
+}
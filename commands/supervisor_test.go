@@ -0,0 +1,288 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert"
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/logs"
+	"github.com/polyrepopro/api/test"
+	"github.com/stretchr/testify/suite"
+)
+
+type SupervisorSuite struct {
+	suite.Suite
+	workspace *config.Workspace
+}
+
+func TestSupervisor(t *testing.T) {
+	suite.Run(t, new(SupervisorSuite))
+}
+
+func (s *SupervisorSuite) SetupTest() {
+	test.Setup()
+
+	path := s.T().TempDir()
+	assert.NoError(s.T(), os.MkdirAll(filepath.Join(path, "api"), 0755))
+
+	s.workspace = &config.Workspace{
+		Name: "test",
+		Path: path,
+		Repositories: &[]config.Repository{
+			{
+				Name: "api",
+				Path: "api",
+				Runners: &[]config.Runner{
+					{
+						Name:         "crash",
+						Restart:      config.RestartOnFailure,
+						MaxRestarts:  2,
+						RestartDelay: 10 * time.Millisecond,
+						Commands: []config.Command{
+							{Name: "fail", Command: []string{"sh", "-c", "exit 1"}},
+						},
+					},
+					{
+						Name:    "once",
+						Restart: config.RestartOnFailure,
+						Commands: []config.Command{
+							{Name: "ok", Command: []string{"true"}},
+						},
+					},
+					{
+						Name:    "server",
+						Restart: config.RestartAlways,
+						Commands: []config.Command{
+							{Name: "sleep", Command: []string{"sleep", "30"}},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (s *SupervisorSuite) Test1RestartPolicies() {
+	supervisor, err := NewSupervisor(SupervisorArgs{Workspace: s.workspace})
+	assert.NoError(s.T(), err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	supervisor.Start(ctx)
+
+	s.Eventually(func() bool {
+		crash, _ := supervisor.State("api/crash")
+		once, _ := supervisor.State("api/once")
+		server, _ := supervisor.State("api/server")
+		return crash.Status == RunnerFailed && once.Status == RunnerExited && server.Status == RunnerRunning
+	}, 5*time.Second, 10*time.Millisecond)
+
+	crash, ok := supervisor.State("api/crash")
+	assert.True(s.T(), ok)
+	assert.Equal(s.T(), 2, crash.Restarts)
+	assert.NotEqual(s.T(), "", crash.LastError)
+
+	cancel()
+	assert.Equal(s.T(), 0, len(supervisor.Wait()))
+
+	server, _ := supervisor.State("api/server")
+	assert.Equal(s.T(), RunnerStopped, server.Status)
+}
+
+func (s *SupervisorSuite) Test2Readiness() {
+	path := s.T().TempDir()
+	s.workspace = &config.Workspace{
+		Name: "test",
+		Path: path,
+		Repositories: &[]config.Repository{
+			{
+				Name: "stack",
+				Path: ".",
+				Runners: &[]config.Runner{
+					{
+						Name: "api",
+						// Fails unless the database is ready when it starts.
+						DependsOn: []string{"db"},
+						Ready:     &config.Probe{Command: []string{"true"}, Interval: 10 * time.Millisecond},
+						Commands: []config.Command{
+							{Name: "serve", Command: []string{"sh", "-c", "test -f db.ready && sleep 30"}},
+						},
+					},
+					{
+						Name:  "db",
+						Ready: &config.Probe{Log: "^listening$"},
+						Commands: []config.Command{
+							{Name: "serve", Command: []string{"sh", "-c", "sleep 0.2; touch db.ready; echo listening; sleep 30"}},
+						},
+					},
+					{
+						Name:  "broken",
+						Ready: &config.Probe{TCP: "127.0.0.1:1", Interval: 10 * time.Millisecond, Timeout: 100 * time.Millisecond},
+						Commands: []config.Command{
+							{Name: "serve", Command: []string{"sleep", "30"}},
+						},
+					},
+					{
+						Name:      "web",
+						DependsOn: []string{"stack/broken"},
+						Commands: []config.Command{
+							{Name: "serve", Command: []string{"sleep", "30"}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	supervisor, err := NewSupervisor(SupervisorArgs{Workspace: s.workspace})
+	assert.NoError(s.T(), err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	supervisor.Start(ctx)
+
+	s.Eventually(func() bool {
+		api, _ := supervisor.State("stack/api")
+		db, _ := supervisor.State("stack/db")
+		return api.Status == RunnerRunning && api.Ready && db.Ready
+	}, 5*time.Second, 10*time.Millisecond)
+
+	s.Eventually(func() bool {
+		broken, _ := supervisor.State("stack/broken")
+		web, _ := supervisor.State("stack/web")
+		return broken.Status == RunnerFailed && web.Status == RunnerFailed
+	}, 5*time.Second, 10*time.Millisecond)
+
+	broken, _ := supervisor.State("stack/broken")
+	assert.Contains(s.T(), broken.LastError, "readiness probe failed")
+	web, _ := supervisor.State("stack/web")
+	assert.True(s.T(), web.StartedAt.IsZero())
+
+	cancel()
+	errs := supervisor.Wait()
+	assert.Equal(s.T(), 1, len(errs))
+	assert.Contains(s.T(), errs[0].Error(), "stack/broken stopped before it was ready")
+}
+
+func (s *SupervisorSuite) Test3UnknownRunnerDependency() {
+	(*s.workspace.Repositories)[0].DependsOn = nil
+	(*(*s.workspace.Repositories)[0].Runners)[0].DependsOn = []string{"missing"}
+
+	_, err := NewSupervisor(SupervisorArgs{Workspace: s.workspace})
+	assert.Error(s.T(), err)
+}
+
+func (s *SupervisorSuite) Test4Logs() {
+	(*s.workspace.Repositories)[0].Runners = &[]config.Runner{
+		{
+			Name: "server",
+			Commands: []config.Command{
+				{Name: "print", Shell: "echo started; echo token $API_TOKEN >&2", Env: map[string]string{"API_TOKEN": "s3cr3t-token"}},
+			},
+		},
+	}
+
+	var console bytes.Buffer
+	supervisor, err := NewSupervisor(SupervisorArgs{
+		Workspace: s.workspace,
+		LogDir:    ".polyrepo/logs",
+		Console:   &console,
+	})
+	assert.NoError(s.T(), err)
+
+	supervisor.Start(context.Background())
+	assert.Equal(s.T(), 0, len(supervisor.Wait()))
+
+	lines, ok := supervisor.Tail("api/server", 0)
+	assert.True(s.T(), ok)
+	assert.Equal(s.T(), 2, len(lines))
+	assert.Contains(s.T(), lines, "token ****")
+
+	path := supervisor.LogPath("api/server")
+	assert.Equal(s.T(), filepath.Join(s.workspace.Path, ".polyrepo", "logs", "api", "server.log"), path)
+	file, err := logs.Tail(path, 10)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), lines, file)
+
+	assert.Contains(s.T(), console.String(), "api/server | started\n")
+	assert.NotContains(s.T(), console.String(), "s3cr3t")
+}
+
+func (s *SupervisorSuite) Test5RepositoryOrder() {
+	path := s.T().TempDir()
+	for _, name := range []string{"db", "cache", "api", "web"} {
+		assert.NoError(s.T(), os.MkdirAll(filepath.Join(path, name), 0755))
+	}
+	s.workspace = &config.Workspace{
+		Name: "test",
+		Path: path,
+		Repositories: &[]config.Repository{
+			{
+				Name:      "web",
+				Path:      "web",
+				DependsOn: []string{"api"},
+				Runners: &[]config.Runner{{
+					Name: "serve",
+					// Fails unless the api runner has started.
+					Commands: []config.Command{{Name: "serve", Shell: "test -f ../api.started && sleep 30"}},
+				}},
+			},
+			{
+				Name:      "api",
+				Path:      "api",
+				DependsOn: []string{"db"},
+				Runners: &[]config.Runner{{
+					// Has no probe and exits right away, it is ready once started.
+					Name:     "migrate",
+					Commands: []config.Command{{Name: "migrate", Shell: "test -f ../db.ready && touch ../api.started"}},
+				}},
+			},
+			{
+				Name: "db",
+				Path: "db",
+				Runners: &[]config.Runner{{
+					Name:     "serve",
+					Ready:    &config.Probe{Log: "^listening$"},
+					Commands: []config.Command{{Name: "serve", Shell: "sleep 0.2; touch ../db.ready; echo listening; sleep 30"}},
+				}},
+			},
+			{
+				// Fails before it is ready, which does not hold back the unrelated api and web runners.
+				Name: "cache",
+				Path: "cache",
+				Runners: &[]config.Runner{{
+					Name:     "serve",
+					Ready:    &config.Probe{Log: "^listening$"},
+					Commands: []config.Command{{Name: "serve", Shell: "exit 1"}},
+				}},
+			},
+		},
+	}
+
+	supervisor, err := NewSupervisor(SupervisorArgs{Workspace: s.workspace})
+	assert.NoError(s.T(), err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	supervisor.Start(ctx)
+
+	s.Eventually(func() bool {
+		api, _ := supervisor.State("api/migrate")
+		web, _ := supervisor.State("web/serve")
+		return api.Status == RunnerExited && web.Status == RunnerRunning
+	}, 5*time.Second, 10*time.Millisecond)
+
+	db, _ := supervisor.State("db/serve")
+	cache, _ := supervisor.State("cache/serve")
+	api, _ := supervisor.State("api/migrate")
+	web, _ := supervisor.State("web/serve")
+	assert.True(s.T(), db.Ready)
+	assert.Equal(s.T(), RunnerFailed, cache.Status)
+	assert.False(s.T(), api.StartedAt.Before(db.StartedAt.Add(200*time.Millisecond)))
+	assert.False(s.T(), web.StartedAt.Before(api.StartedAt))
+
+	cancel()
+	assert.Equal(s.T(), 0, len(supervisor.Wait()))
+}
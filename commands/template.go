@@ -0,0 +1,264 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/git"
+)
+
+// Vars are the values available when expanding the templates of a command.
+//
+// Command, Env and Cwd values can use Go templates such as
+// "{{ .Repository.Name }}" or "{{ join .Repository.Tags \",\" }}", and ${VAR}
+// references that are resolved from Env. References to variables that are not
+// set are left as they are so a shell can still expand them.
+//
+// Shell scripts only expand templates and every value they produce is quoted
+// with ShellQuote, ${VAR} references are left for the shell to expand.
+type Vars struct {
+	Workspace  WorkspaceVars
+	Repository RepositoryVars
+	// Head is the hash of the repository HEAD commit, empty if it could not be resolved.
+	Head string
+	// Env is the environment of the user.
+	Env map[string]string
+}
+
+// WorkspaceVars describe the workspace a command runs for.
+type WorkspaceVars struct {
+	Name string
+	Path string
+}
+
+// RepositoryVars describe the repository a command runs for.
+type RepositoryVars struct {
+	Name   string
+	Path   string
+	URL    string
+	Branch string
+	Tags   []string
+}
+
+// NewVars returns the template values for a repository of a workspace.
+//
+// Arguments:
+//   - workspace: The workspace of the repository.
+//   - repository: The repository, nil when the command does not run for a repository.
+//
+// Returns:
+//   - *Vars: The template values.
+func NewVars(workspace *config.Workspace, repository *config.Repository) *Vars {
+	vars := &Vars{Env: make(map[string]string)}
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			vars.Env[k] = v
+		}
+	}
+
+	if workspace != nil {
+		vars.Workspace = WorkspaceVars{
+			Name: workspace.Name,
+			Path: workspace.GetAbsolutePath(),
+		}
+	}
+	if repository != nil {
+		vars.Repository = RepositoryVars{
+			Name:   repository.Name,
+			Path:   filepath.Join(vars.Workspace.Path, repository.Path),
+			URL:    repository.URL,
+			Branch: repository.Branch,
+			Tags:   repository.Tags,
+		}
+		vars.Head, _ = git.Head(vars.Repository.Path)
+	}
+
+	return vars
+}
+
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+var templateFuncs = template.FuncMap{
+	"join":       strings.Join,
+	"shellquote": func(value any) string { return ShellQuote(fmt.Sprint(value)) },
+}
+
+// shellQuoteCommand is appended to the pipeline of every action of a shell
+// script template, it is taken from a parsed template so it can report errors.
+var shellQuoteCommand = template.Must(template.New("").Funcs(templateFuncs).Parse("{{ . | shellquote }}")).
+	Tree.Root.Nodes[0].(*parse.ActionNode).Pipe.Cmds[1]
+
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// ShellQuote quotes a value so a POSIX shell reads it as a single word.
+// Values made only of characters without a special meaning are returned as is.
+//
+// Arguments:
+//   - value: The value to quote.
+//
+// Returns:
+//   - string: The quoted value.
+func ShellQuote(value string) string {
+	if shellSafe.MatchString(value) {
+		return value
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// Expand expands a single value.
+//
+// Arguments:
+//   - value: The value to expand.
+//
+// Returns:
+//   - string: The expanded value.
+//   - error: An error if the template is not valid or refers to an unknown field.
+func (v *Vars) Expand(value string) (string, error) {
+	value, err := v.expandTemplate(value, false)
+	if err != nil {
+		return "", err
+	}
+
+	return envReference.ReplaceAllStringFunc(value, func(ref string) string {
+		if value, ok := v.Env[ref[2:len(ref)-1]]; ok {
+			return value
+		}
+		return ref
+	}), nil
+}
+
+// ExpandShell expands the templates of a shell script, quoting every value
+// they produce so it cannot change the meaning of the script.
+//
+// Arguments:
+//   - script: The script to expand.
+//
+// Returns:
+//   - string: The expanded script.
+//   - error: An error if the template is not valid or refers to an unknown field.
+func (v *Vars) ExpandShell(script string) (string, error) {
+	return v.expandTemplate(script, true)
+}
+
+func (v *Vars) expandTemplate(value string, quote bool) (string, error) {
+	if !strings.Contains(value, "{{") {
+		return value, nil
+	}
+
+	tmpl, err := template.New("").Funcs(templateFuncs).Option("missingkey=zero").Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid template %q: %w", value, err)
+	}
+	if quote {
+		// Templates declared with define or block are separate trees invoked
+		// from the main tree, their actions are quoted as well.
+		for _, t := range tmpl.Templates() {
+			if t.Tree != nil {
+				quoteActions(t.Tree.Root)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, v); err != nil {
+		return "", fmt.Errorf("failed to expand template %q: %w", value, err)
+	}
+	return buf.String(), nil
+}
+
+// quoteActions pipes the output of every action in the tree through shellquote.
+func quoteActions(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			quoteActions(child)
+		}
+	case *parse.ActionNode:
+		// Actions that declare or assign variables produce no output.
+		if len(n.Pipe.Decl) == 0 {
+			n.Pipe.Cmds = append(n.Pipe.Cmds, shellQuoteCommand)
+		}
+	case *parse.IfNode:
+		quoteActions(n.List)
+		quoteActions(n.ElseList)
+	case *parse.RangeNode:
+		quoteActions(n.List)
+		quoteActions(n.ElseList)
+	case *parse.WithNode:
+		quoteActions(n.List)
+		quoteActions(n.ElseList)
+	}
+}
+
+// ExpandCommand returns a copy of the command with its command, shell, env and cwd expanded.
+// A nil Vars returns the command unchanged.
+//
+// Arguments:
+//   - command: The command to expand.
+//
+// Returns:
+//   - config.Command: The expanded command.
+//   - error: An error if a template could not be expanded.
+func (v *Vars) ExpandCommand(command config.Command) (config.Command, error) {
+	if v == nil {
+		return command, nil
+	}
+
+	var err error
+	expanded := command
+	expanded.Command = make([]string, len(command.Command))
+	for i, arg := range command.Command {
+		if expanded.Command[i], err = v.Expand(arg); err != nil {
+			return command, fmt.Errorf("command %q: %w", command.Name, err)
+		}
+	}
+	if expanded.Shell, err = v.ExpandShell(command.Shell); err != nil {
+		return command, fmt.Errorf("command %q: shell: %w", command.Name, err)
+	}
+	if command.Env != nil {
+		expanded.Env = make(map[string]string, len(command.Env))
+		for k, value := range command.Env {
+			if expanded.Env[k], err = v.Expand(value); err != nil {
+				return command, fmt.Errorf("command %q: env %s: %w", command.Name, k, err)
+			}
+		}
+	}
+	if expanded.Cwd, err = v.Expand(command.Cwd); err != nil {
+		return command, fmt.Errorf("command %q: cwd: %w", command.Name, err)
+	}
+
+	return expanded, nil
+}
+
+// ExpandCommands expands every command with ExpandCommand.
+//
+// Arguments:
+//   - commands: The commands to expand.
+//
+// Returns:
+//   - []config.Command: The expanded commands.
+//   - error: An error if a template could not be expanded.
+func (v *Vars) ExpandCommands(commands []config.Command) ([]config.Command, error) {
+	if v == nil {
+		return commands, nil
+	}
+
+	expanded := make([]config.Command, len(commands))
+	for i, command := range commands {
+		var err error
+		if expanded[i], err = v.ExpandCommand(command); err != nil {
+			return nil, err
+		}
+	}
+	return expanded, nil
+}
@@ -0,0 +1,76 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert"
+	"github.com/polyrepopro/api/config"
+)
+
+func TestVarsExpandCommand(t *testing.T) {
+	t.Setenv("POLYREPO_TEST_USER", "gopher")
+
+	workspace := &config.Workspace{Name: "dev", Path: "/tmp/dev"}
+	repository := &config.Repository{
+		Name:   "api",
+		Path:   "services/api",
+		URL:    "git@example.com:acme/api.git",
+		Branch: "main",
+		Tags:   []string{"go", "backend"},
+	}
+	vars := NewVars(workspace, repository)
+	assert.Equal(t, "/tmp/dev/services/api", vars.Repository.Path)
+	assert.Equal(t, "", vars.Head)
+
+	command, err := vars.ExpandCommand(config.Command{
+		Name:    "build",
+		Cwd:     "{{ .Repository.Path }}/cmd",
+		Command: []string{"docker", "build", "-t", "{{ .Repository.Name }}:{{ .Repository.Branch }}", "--label", "tags={{ join .Repository.Tags \",\" }}"},
+		Env: map[string]string{
+			"OWNER":   "${POLYREPO_TEST_USER}",
+			"UNKNOWN": "${POLYREPO_TEST_UNSET}",
+			"HOME":    "{{ .Env.POLYREPO_TEST_USER }}@{{ .Workspace.Name }}",
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "/tmp/dev/services/api/cmd", command.Cwd)
+	assert.Equal(t, []string{"docker", "build", "-t", "api:main", "--label", "tags=go,backend"}, command.Command)
+	assert.Equal(t, map[string]string{
+		"OWNER":   "gopher",
+		"UNKNOWN": "${POLYREPO_TEST_UNSET}",
+		"HOME":    "gopher@dev",
+	}, command.Env)
+
+	_, err = vars.ExpandCommand(config.Command{Command: []string{"{{ .Repository.Missing }}"}})
+	assert.Error(t, err)
+	_, err = vars.ExpandCommand(config.Command{Command: []string{"{{ .Repository.Name"}})
+	assert.Error(t, err)
+
+	var none *Vars
+	command, err = none.ExpandCommand(config.Command{Command: []string{"{{ .Repository.Name }}"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"{{ .Repository.Name }}"}, command.Command)
+}
+
+func TestVarsExpandShell(t *testing.T) {
+	vars := &Vars{
+		Repository: RepositoryVars{Name: "api", Branch: "feature/x; rm -rf ~", Tags: []string{"it's", "go"}},
+		Env:        map[string]string{"HOME": "/home/gopher"},
+	}
+
+	script, err := vars.ExpandShell(`echo {{ .Repository.Name }} {{ .Repository.Branch }} && echo ${HOME}{{ range .Repository.Tags }} {{ . }}{{ end }}`)
+	assert.NoError(t, err)
+	assert.Equal(t, `echo api 'feature/x; rm -rf ~' && echo ${HOME} 'it'\''s' go`, script)
+
+	script, err = vars.ExpandShell(`{{ $name := .Repository.Name }}echo {{ if $name }}{{ $name }}{{ end }}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "echo api", script)
+
+	script, err = vars.ExpandShell(`{{define "x"}}{{.Repository.Branch}}{{end}}echo {{template "x" .}} {{block "y" .}}{{.Repository.Name}}{{end}}`)
+	assert.NoError(t, err)
+	assert.Equal(t, `echo 'feature/x; rm -rf ~' api`, script)
+
+	assert.Equal(t, "''", ShellQuote(""))
+	assert.Equal(t, "a/b-c_d.e", ShellQuote("a/b-c_d.e"))
+	assert.Equal(t, `'$(id)'`, ShellQuote("$(id)"))
+}
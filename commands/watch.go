@@ -2,137 +2,258 @@ package commands
 
 import (
 	"context"
+	"fmt"
 	"io/fs"
+	"os"
 	"path/filepath"
-	"regexp"
+	"strings"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
 	"github.com/mateothegreat/go-multilog/multilog"
 	"github.com/mateothegreat/go-util/files"
 	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/git"
 )
 
-func Watch(ctx context.Context, label string, workspacePath string, runner config.Runner) {
-	for {
-		watcher, err := fsnotify.NewWatcher()
-		if err != nil {
-			multilog.Fatal(label, "failed to create watcher", map[string]interface{}{
-				"error": err,
-			})
-			return
+// Watch runs the commands of a runner and restarts them whenever a watched file changes.
+// It blocks until the context is cancelled or the watcher fails.
+//
+// Arguments:
+//   - ctx: The context for the runner, cancelling it stops the commands.
+//   - label: The label used when logging.
+//   - workspacePath: The directory the runner cwd is resolved against.
+//   - runner: The runner to watch.
+//
+// Returns:
+//   - error: An error if the files could not be watched.
+func Watch(ctx context.Context, label string, workspacePath string, runner config.Runner) error {
+	runner.Watch = true
+
+	p := newProcess(label, "", files.ExpandPath(filepath.Join(workspacePath, runner.Cwd)), runner)
+	return p.supervise(ctx)
+}
+
+const defaultDebounce = 250 * time.Millisecond
+
+// changeWatcher reports changes to the files matched by a runner.
+// Directories are watched recursively so files and directories created after
+// the watcher started are picked up, and bursts of events are coalesced into a
+// single change once no event has been seen for the debounce window.
+type changeWatcher struct {
+	label    string
+	root     string
+	matchers []*config.CompiledMatcher
+	ignore   gitignore.Matcher
+	watcher  *fsnotify.Watcher
+	Changes  chan string
+	Errors   chan error
+}
+
+// newChangeWatcher starts watching the directories selected by the runner matchers.
+// When the runner has no matchers every file below the base directory is watched.
+// The watcher stops when the context is cancelled.
+//
+// Arguments:
+//   - ctx: The context for the watcher.
+//   - label: The label used when logging.
+//   - base: The directory matcher paths are resolved against.
+//   - runner: The runner whose matchers select the files.
+//
+// Returns:
+//   - *changeWatcher: The watcher.
+//   - error: An error if the matchers are invalid or the directories could not be watched.
+func newChangeWatcher(ctx context.Context, label string, base string, runner config.Runner) (*changeWatcher, error) {
+	matchers, err := compileMatchers(base, runner.Matchers)
+	if err != nil {
+		return nil, err
+	}
+
+	// Paths are matched against the .gitignore of the repository containing the runner.
+	root := repositoryRoot(base)
+	patterns, err := git.AddGitignoreToWorktree(root)
+	if err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watcher: %w", err)
+	}
+
+	w := &changeWatcher{
+		label:    label,
+		root:     root,
+		matchers: matchers,
+		ignore:   gitignore.NewMatcher(patterns),
+		watcher:  watcher,
+		Changes:  make(chan string, 1),
+		Errors:   make(chan error, 1),
+	}
+
+	for _, matcher := range matchers {
+		if err := w.addTree(matcher.Root); err != nil {
+			watcher.Close()
+			return nil, err
 		}
+	}
 
-		for _, command := range runner.Commands {
-			var c context.Context
-			var cancel context.CancelFunc
+	debounce := runner.Debounce
+	if debounce <= 0 {
+		debounce = defaultDebounce
+	}
 
-			var base string
-			if runner.Cwd != "" {
-				base = files.ExpandPath(filepath.Join(workspacePath, runner.Cwd))
-			} else {
-				base = files.ExpandPath(filepath.Join(workspacePath, command.Cwd))
-			}
+	go w.loop(ctx, debounce)
 
-			var matches []string
-			for _, matcher := range runner.Matchers {
-				path := matcher.Path
-				if path == "" {
-					path = command.Cwd
-				}
+	return w, nil
+}
 
-				err := filepath.WalkDir(filepath.Join(base, path), func(path string, d fs.DirEntry, err error) error {
-					if err != nil {
-						return err
-					}
-					if d.IsDir() {
-						return nil
-					}
+func (w *changeWatcher) loop(ctx context.Context, debounce time.Duration) {
+	defer w.watcher.Close()
 
-					ignore := false
-					if matcher.Ignore != "" {
-						matched, err := regexp.MatchString(matcher.Ignore, path)
-						if err != nil {
-							multilog.Fatal(label, "failed to match path", map[string]interface{}{
-								"path":    path,
-								"error":   err,
-								"pattern": matcher.Ignore,
-							})
-							return err
-						}
-						if matched {
-							ignore = true
-						}
-					}
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	defer timer.Stop()
+	var pending string
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+				continue
+			}
 
-					matched, err := regexp.MatchString(matcher.Include, path)
-					if err != nil {
-						multilog.Fatal(label, "failed to match path", map[string]interface{}{
-							"path":    path,
-							"error":   err,
-							"pattern": matcher.Include,
+			isDir := false
+			if event.Op&fsnotify.Create == fsnotify.Create {
+				if stat, err := os.Stat(event.Name); err == nil && stat.IsDir() {
+					isDir = true
+					if err := w.addTree(event.Name); err != nil {
+						multilog.Warn(w.label, "failed to watch new directory", map[string]interface{}{
+							"path":  event.Name,
+							"error": err.Error(),
 						})
-						return err
-					}
-					if matched && !ignore {
-						matches = append(matches, path)
 					}
-
-					return nil
-				})
-				if err != nil {
-					multilog.Fatal(label, "failed to walk path", map[string]interface{}{
-						"path":  path,
-						"error": err,
-					})
 				}
 			}
+			if !w.relevant(event.Name, isDir) {
+				continue
+			}
 
-			for _, match := range matches {
-
-				err = watcher.Add(match)
-				if err != nil {
-					multilog.Fatal(label, "failed to add path to watcher", map[string]interface{}{
-						"path":  match,
-						"error": err,
-					})
+			multilog.Debug(w.label, "change detected", map[string]interface{}{
+				"path": event.Name,
+				"op":   event.Op.String(),
+			})
+			pending = event.Name
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
 				}
 			}
+			timer.Reset(debounce)
+		case <-timer.C:
+			multilog.Info(w.label, "change detected", map[string]interface{}{
+				"path": pending,
+			})
+			select {
+			case w.Changes <- pending:
+			default: // A restart is already pending.
+			}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			select {
+			case w.Errors <- fmt.Errorf("watcher error: %w", err):
+			default:
+			}
+		}
+	}
+}
 
-			c, cancel = context.WithCancel(context.Background())
-			go func() {
-				for {
-					select {
-					case <-ctx.Done():
-						println("received sigterm, canceling context")
-						cancel()
-						return
-					case <-c.Done():
-						return
-					case event, ok := <-watcher.Events:
-						if !ok {
-							multilog.Fatal(label, "watcher events channel closed", nil)
-						}
-						if event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create || event.Op&fsnotify.Remove == fsnotify.Remove {
-							multilog.Info(label, "change detected", map[string]interface{}{
-								"path": event.Name,
-								"op":   event.Op,
-							})
-							cancel()
-						}
-					case err, ok := <-watcher.Errors:
-						if !ok {
-							multilog.Fatal(label, "watcher errors channel closed", nil)
-						}
-						multilog.Fatal(label, "watcher error", map[string]interface{}{
-							"error": err,
-						})
-						cancel()
-					}
-				}
-			}()
-			Run(c, label, command, base)
-			<-c.Done()
-			watcher.Close()
+// addTree watches a directory and every directory below it that is not ignored.
+func (w *changeWatcher) addTree(root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path != root && os.IsNotExist(err) {
+				return nil // Removed while walking.
+			}
+			return fmt.Errorf("failed to walk path %q: %w", path, err)
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != root && (d.Name() == ".git" || w.ignored(path, true)) {
+			return filepath.SkipDir
+		}
+		if err := w.watcher.Add(path); err != nil {
+			return fmt.Errorf("failed to add path %q to watcher: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// ignored reports whether the .gitignore patterns exclude the path.
+func (w *changeWatcher) ignored(path string, isDir bool) bool {
+	rel, err := filepath.Rel(w.root, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	return w.ignore.Match(strings.Split(filepath.ToSlash(rel), "/"), isDir)
+}
+
+// relevant reports whether a change to the path should restart the runner.
+func (w *changeWatcher) relevant(path string, isDir bool) bool {
+	if w.ignored(path, isDir) {
+		return false
+	}
+	for _, part := range strings.Split(filepath.ToSlash(path), "/") {
+		if part == ".git" {
+			return false
+		}
+	}
+	for _, matcher := range w.matchers {
+		if matcher.Match(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileMatchers compiles the matcher patterns, a runner without matchers matches everything below base.
+func compileMatchers(base string, matchers []config.Matcher) ([]*config.CompiledMatcher, error) {
+	if len(matchers) == 0 {
+		matchers = []config.Matcher{{}}
+	}
+
+	var compiled []*config.CompiledMatcher
+	for _, matcher := range matchers {
+		c, err := matcher.Compile(base)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+// repositoryRoot returns the nearest directory at or above path that contains
+// a .git entry, or path itself when there is none.
+func repositoryRoot(path string) string {
+	for dir := path; ; {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return path
 		}
+		dir = parent
 	}
 }
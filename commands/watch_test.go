@@ -0,0 +1,69 @@
+package commands
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert"
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/test"
+)
+
+func TestChangeWatcher(t *testing.T) {
+	test.Setup()
+
+	base := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(base, ".git"), 0755))
+	assert.NoError(t, os.MkdirAll(filepath.Join(base, "build"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(base, ".gitignore"), []byte("# output\nbuild/\n"), 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	watcher, err := newChangeWatcher(ctx, "test", base, config.Runner{
+		Debounce: 100 * time.Millisecond,
+		Matchers: []config.Matcher{
+			{Include: config.Patterns{`\.go$`}},
+		},
+	})
+	assert.NoError(t, err)
+
+	expectNoChange := func() {
+		t.Helper()
+		select {
+		case path := <-watcher.Changes:
+			t.Fatalf("unexpected change %s", path)
+		case <-time.After(300 * time.Millisecond):
+		}
+	}
+
+	// Files that do not match or are ignored do not trigger a change.
+	assert.NoError(t, os.WriteFile(filepath.Join(base, "notes.txt"), []byte("x"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(base, "build", "gen.go"), []byte("x"), 0644))
+	expectNoChange()
+
+	// Files in directories created after the watcher started are picked up and
+	// a burst of writes is coalesced into one change.
+	dir := filepath.Join(base, "pkg", "sub")
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	time.Sleep(50 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte{byte(i)}, 0644))
+	}
+
+	select {
+	case path := <-watcher.Changes:
+		assert.Equal(t, filepath.Join(dir, "main.go"), path)
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a change")
+	}
+	expectNoChange()
+}
+
+func TestCompileMatchersInvalid(t *testing.T) {
+	_, err := compileMatchers("/", []config.Matcher{{Include: config.Patterns{"("}}})
+	assert.Error(t, err)
+}
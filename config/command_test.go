@@ -0,0 +1,22 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestCommandArgv(t *testing.T) {
+	assert.Equal(t, []string{"go", "test", "./..."}, (&Command{Command: []string{"go", "test", "./..."}}).Argv())
+	assert.Equal(t, []string{"sh", "-c", "go test ./... | tee out"}, (&Command{Shell: "go test ./... | tee out"}).Argv())
+	assert.Equal(t, []string{"bash", "-eo", "pipefail", "-c", "make"}, (&Command{Shell: "make", Interpreter: "bash -eo pipefail"}).Argv())
+	assert.Equal(t, 0, len((&Command{}).Argv()))
+}
+
+func TestCommandValidate(t *testing.T) {
+	assert.NoError(t, (&Command{Name: "build", Shell: "make", Interpreter: "bash"}).Validate())
+	assert.Error(t, (&Command{Name: "build"}).Validate())
+	assert.Error(t, (&Command{Name: "build", Shell: "make", Command: []string{"make"}}).Validate())
+	assert.Error(t, (&Command{Name: "build", Command: []string{"make"}, Interpreter: "bash"}).Validate())
+	assert.Error(t, (&Command{Name: "build", Command: []string{"make"}, Retries: -1}).Validate())
+}
@@ -4,13 +4,18 @@ import (
 	"bytes"
 	"fmt"
 	"log"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 	"github.com/mateothegreat/go-util/files"
 	"github.com/mateothegreat/go-util/validation"
+	"github.com/polyrepopro/api/logs"
 	"gopkg.in/yaml.v3"
 )
 
@@ -27,6 +32,9 @@ type Config struct {
 	Synced     time.Time    `yaml:"synced" required:"false"`
 	Auth       *Auth        `yaml:"auth,omitempty" required:"false"`
 	Workspaces *[]Workspace `yaml:"workspaces" required:"false"`
+	Tracing    *Tracing     `yaml:"tracing,omitempty" required:"false"`
+	Logging    *logs.Config `yaml:"logging,omitempty" required:"false"`
+	History    *History     `yaml:"history,omitempty" required:"false"`
 }
 
 // Defaults are the default values for the config.
@@ -37,15 +45,19 @@ type Defaults struct {
 
 // Repository is a repository in a workspace.
 type Repository struct {
-	Name    string    `yaml:"name" required:"true"`
-	URL     string    `yaml:"url" required:"true"`
-	Origin  string    `yaml:"origin,omitempty" required:"false"`
-	Branch  string    `yaml:"branch,omitempty" required:"false"`
-	Path    string    `yaml:"path" required:"true"`
-	Auth    *Auth     `yaml:"auth,omitempty" required:"false"`
-	Hooks   *[]Hook   `yaml:"hooks,omitempty" required:"false"`
-	Runners *[]Runner `yaml:"runners,omitempty" required:"false"`
-	Tags    []string  `yaml:"tags,omitempty" required:"false"`
+	Name      string    `yaml:"name" required:"true"`
+	URL       string    `yaml:"url" required:"true"`
+	Origin    string    `yaml:"origin,omitempty" required:"false"`
+	Branch    string    `yaml:"branch,omitempty" required:"false"`
+	Path      string    `yaml:"path" required:"true"`
+	Auth      *Auth     `yaml:"auth,omitempty" required:"false"`
+	Hooks     *[]Hook   `yaml:"hooks,omitempty" required:"false"`
+	Runners   *[]Runner `yaml:"runners,omitempty" required:"false"`
+	Tags      []string  `yaml:"tags,omitempty" required:"false"`
+	DependsOn []string  `yaml:"dependsOn,omitempty" required:"false"`
+	Synced    time.Time `yaml:"synced,omitempty" required:"false"`
+
+	Environment `yaml:",inline"`
 }
 
 // HookType is the type of hook.
@@ -66,9 +78,70 @@ const (
 type Command struct {
 	Name        string            `yaml:"name" required:"true"`
 	Cwd         string            `yaml:"cwd" required:"false"`
-	ExitOnError bool              `yaml:"exitOnError" required:"false"`
-	Command     []string          `yaml:"command" required:"true"`
+	ExitOnError *bool             `yaml:"exitOnError,omitempty" required:"false"`
+	Command     []string          `yaml:"command,omitempty" required:"false"`
+	Shell       string            `yaml:"shell,omitempty" required:"false"`
+	Interpreter string            `yaml:"interpreter,omitempty" required:"false"`
 	Env         map[string]string `yaml:"env" required:"false"`
+	StopSignal  string            `yaml:"stopSignal,omitempty" required:"false"`
+	StopTimeout time.Duration     `yaml:"stopTimeout,omitempty" required:"false"`
+	Timeout     time.Duration     `yaml:"timeout,omitempty" required:"false"`
+	Retries     int               `yaml:"retries,omitempty" required:"false"`
+	RetryDelay  time.Duration     `yaml:"retryDelay,omitempty" required:"false"`
+
+	Environment `yaml:",inline"`
+}
+
+// Validate checks the command settings that cannot be expressed with struct tags.
+//
+// Returns:
+//   - error: An error describing the first invalid setting.
+func (c *Command) Validate() error {
+	if len(c.Command) == 0 && c.Shell == "" {
+		return fmt.Errorf("command %s: command or shell must be set", c.Name)
+	}
+	if len(c.Command) > 0 && c.Shell != "" {
+		return fmt.Errorf("command %s: command and shell cannot both be set", c.Name)
+	}
+	if c.Interpreter != "" && c.Shell == "" {
+		return fmt.Errorf("command %s: interpreter requires shell", c.Name)
+	}
+	if c.Timeout < 0 || c.StopTimeout < 0 || c.RetryDelay < 0 {
+		return fmt.Errorf("command %s: durations must not be negative", c.Name)
+	}
+	if c.Retries < 0 {
+		return fmt.Errorf("command %s: retries must not be negative", c.Name)
+	}
+	return nil
+}
+
+// ExitsOnError reports whether a failure of the command skips the commands
+// after it, which is the default when exitOnError is not set.
+//
+// Returns:
+//   - bool: Whether the remaining commands are skipped when the command fails.
+func (c *Command) ExitsOnError() bool {
+	return c.ExitOnError == nil || *c.ExitOnError
+}
+
+// DefaultInterpreter is the interpreter shell scripts are run with when none is set.
+const DefaultInterpreter = "sh"
+
+// Argv returns the argv the command is started with. A shell script is run
+// with its interpreter, which may include arguments such as "bash -eo pipefail",
+// followed by "-c" and the script.
+//
+// Returns:
+//   - []string: The argv, empty if the command has nothing to run.
+func (c *Command) Argv() []string {
+	if c.Shell == "" {
+		return c.Command
+	}
+	interpreter := strings.Fields(c.Interpreter)
+	if len(interpreter) == 0 {
+		interpreter = []string{DefaultInterpreter}
+	}
+	return append(interpreter, "-c", c.Shell)
 }
 
 // Hook is a hook to run.
@@ -77,19 +150,116 @@ type Hook struct {
 	Commands []Command `yaml:"commands" required:"true"`
 }
 
+// RestartPolicy controls when a supervised runner is restarted after it exits.
+type RestartPolicy string
+
+const (
+	// RestartNever never restarts the runner.
+	RestartNever RestartPolicy = "never"
+	// RestartOnFailure restarts the runner when it exits with an error.
+	RestartOnFailure RestartPolicy = "on-failure"
+	// RestartAlways restarts the runner whenever it exits.
+	RestartAlways RestartPolicy = "always"
+)
+
 // Runner is a runner to run.
 type Runner struct {
-	Cwd      string    `yaml:"cwd" required:"false"`
-	Watch    bool      `yaml:"watch" required:"false"`
-	Matchers []Matcher `yaml:"matchers" required:"false"`
-	Commands []Command `yaml:"commands" required:"true"`
+	Name            string        `yaml:"name,omitempty" required:"false"`
+	Cwd             string        `yaml:"cwd" required:"false"`
+	Watch           bool          `yaml:"watch" required:"false"`
+	Matchers        []Matcher     `yaml:"matchers" required:"false"`
+	Commands        []Command     `yaml:"commands" required:"true"`
+	Restart         RestartPolicy `yaml:"restart,omitempty" required:"false"`
+	MaxRestarts     int           `yaml:"maxRestarts,omitempty" required:"false"`
+	RestartDelay    time.Duration `yaml:"restartDelay,omitempty" required:"false"`
+	MaxRestartDelay time.Duration `yaml:"maxRestartDelay,omitempty" required:"false"`
+	Debounce        time.Duration `yaml:"debounce,omitempty" required:"false"`
+	Ready           *Probe        `yaml:"ready,omitempty" required:"false"`
+	DependsOn       []string      `yaml:"dependsOn,omitempty" required:"false"`
+
+	Environment `yaml:",inline"`
+}
+
+// Probe is a readiness probe for a runner, exactly one check must be set.
+type Probe struct {
+	// TCP is a host:port that must accept connections.
+	TCP string `yaml:"tcp,omitempty" required:"false"`
+	// HTTP is a URL that must respond with a 2xx status.
+	HTTP string `yaml:"http,omitempty" required:"false"`
+	// Command is an argv that must exit with code 0.
+	Command []string `yaml:"command,omitempty" required:"false"`
+	// Log is a regular expression that a line of the runner output must match.
+	Log string `yaml:"log,omitempty" required:"false"`
+	// Interval is the time between checks.
+	Interval time.Duration `yaml:"interval,omitempty" required:"false"`
+	// Timeout is how long the runner may take to become ready, zero waits forever.
+	Timeout time.Duration `yaml:"timeout,omitempty" required:"false"`
+}
+
+// Validate checks that exactly one check is set and that it is valid.
+//
+// Returns:
+//   - error: An error describing the problem.
+func (p *Probe) Validate() error {
+	checks := 0
+	for _, set := range []bool{p.TCP != "", p.HTTP != "", len(p.Command) > 0, p.Log != ""} {
+		if set {
+			checks++
+		}
+	}
+	if checks != 1 {
+		return fmt.Errorf("readiness probe must set exactly one of tcp, http, command or log")
+	}
+	if p.TCP != "" {
+		if _, _, err := net.SplitHostPort(p.TCP); err != nil {
+			return fmt.Errorf("invalid tcp address %q: %w", p.TCP, err)
+		}
+	}
+	if p.HTTP != "" {
+		if u, err := url.Parse(p.HTTP); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid http url %q", p.HTTP)
+		}
+	}
+	if p.Log != "" {
+		if _, err := regexp.Compile(p.Log); err != nil {
+			return fmt.Errorf("invalid log pattern %q: %w", p.Log, err)
+		}
+	}
+	if p.Interval < 0 || p.Timeout < 0 {
+		return fmt.Errorf("readiness probe interval and timeout must not be negative")
+	}
+	return nil
 }
 
-// Matcher is a matcher to match.
-type Matcher struct {
-	Path    string `yaml:"path" required:"true"`
-	Include string `yaml:"include" required:"false"`
-	Ignore  string `yaml:"ignore" required:"false"`
+// Validate checks the runner settings that cannot be expressed with struct tags.
+//
+// Returns:
+//   - error: An error describing the first invalid setting.
+func (r *Runner) Validate() error {
+	switch r.Restart {
+	case "", RestartNever, RestartOnFailure, RestartAlways:
+	default:
+		return fmt.Errorf("runner %s: unknown restart policy %q", r.Name, r.Restart)
+	}
+	if r.MaxRestarts < 0 {
+		return fmt.Errorf("runner %s: maxRestarts must not be negative", r.Name)
+	}
+	if r.Ready != nil {
+		if err := r.Ready.Validate(); err != nil {
+			return fmt.Errorf("runner %s: %w", r.Name, err)
+		}
+	}
+	for _, command := range r.Commands {
+		if err := command.Validate(); err != nil {
+			return fmt.Errorf("runner %s: %w", r.Name, err)
+		}
+	}
+	for _, matcher := range r.Matchers {
+		if err := matcher.Validate(); err != nil {
+			return fmt.Errorf("runner %s: matcher %s: %w", r.Name, matcher.Path, err)
+		}
+	}
+	return nil
 }
 
 // Auth is the authentication for the config.
@@ -131,6 +301,62 @@ func (c *Config) GetWorkspaces(names []string) (*[]Workspace, error) {
 	return &workspaces, nil
 }
 
+// Validate checks the parts of the config that cannot be expressed with struct tags.
+//
+// Returns:
+//   - error: An error describing the first problem found.
+func (c *Config) Validate() error {
+	if c.Logging != nil {
+		if err := c.Logging.Validate(); err != nil {
+			return fmt.Errorf("invalid config: %w", err)
+		}
+	}
+	if c.Tracing != nil {
+		if err := c.Tracing.Validate(); err != nil {
+			return fmt.Errorf("invalid config: %w", err)
+		}
+	}
+	if c.Workspaces == nil {
+		return nil
+	}
+	for _, workspace := range *c.Workspaces {
+		if err := workspace.ValidateDependencies(); err != nil {
+			return fmt.Errorf("invalid config: %w", err)
+		}
+		if err := workspace.ValidateRunnerDependencies(); err != nil {
+			return fmt.Errorf("invalid config: %w", err)
+		}
+		if workspace.Daemon != nil {
+			if err := workspace.Daemon.Validate(); err != nil {
+				return fmt.Errorf("invalid config: workspace %s: %w", workspace.Name, err)
+			}
+		}
+		if workspace.Repositories == nil {
+			continue
+		}
+		for _, repo := range *workspace.Repositories {
+			if repo.Hooks != nil {
+				for _, hook := range *repo.Hooks {
+					for _, command := range hook.Commands {
+						if err := command.Validate(); err != nil {
+							return fmt.Errorf("invalid config: repository %s: %s hook: %w", repo.Name, hook.Type, err)
+						}
+					}
+				}
+			}
+			if repo.Runners == nil {
+				continue
+			}
+			for _, runner := range *repo.Runners {
+				if err := runner.Validate(); err != nil {
+					return fmt.Errorf("invalid config: repository %s: %w", repo.Name, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
 // SaveConfig saves the config to the path specified by the config.
 //
 // Returns:
@@ -261,6 +487,10 @@ func GetAbsoluteConfig(path string) (*Config, error) {
 		return nil, fmt.Errorf("failed to read config: %w", err)
 	}
 
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
 	return &config, nil
 }
 
@@ -304,5 +534,9 @@ func GetRelativeConfig() (*Config, error) {
 		return nil, fmt.Errorf("empty fields: %v", emptyFields)
 	}
 
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
 	return config, nil
 }
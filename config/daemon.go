@@ -0,0 +1,114 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultSyncInterval is the time between background syncs when none is set.
+	DefaultSyncInterval = 15 * time.Minute
+	// DefaultSyncParallelism is the number of repositories synced at once when none is set.
+	DefaultSyncParallelism = 4
+)
+
+// Daemon configures the background sync of a workspace.
+type Daemon struct {
+	// Disabled excludes the workspace from background syncs.
+	Disabled bool `yaml:"disabled,omitempty" required:"false"`
+	// Interval is the time between syncs.
+	Interval time.Duration `yaml:"interval,omitempty" required:"false"`
+	// Jitter is the maximum random delay added to every interval so that
+	// several workspaces or machines do not all hit the remotes at once.
+	Jitter time.Duration `yaml:"jitter,omitempty" required:"false"`
+	// QuietHours are local time windows such as "22:00-07:00" during which no
+	// syncs are run, a window may wrap around midnight.
+	QuietHours []string `yaml:"quietHours,omitempty" required:"false"`
+	// Parallelism is the number of repositories synced at once.
+	Parallelism int `yaml:"parallelism,omitempty" required:"false"`
+}
+
+// Validate checks the daemon settings.
+//
+// Returns:
+//   - error: An error describing the first invalid setting.
+func (d *Daemon) Validate() error {
+	if d.Interval < 0 || d.Jitter < 0 {
+		return fmt.Errorf("daemon interval and jitter must not be negative")
+	}
+	if d.Parallelism < 0 {
+		return fmt.Errorf("daemon parallelism must not be negative")
+	}
+	for _, window := range d.QuietHours {
+		if _, _, err := parseWindow(window); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetInterval returns the interval, falling back to DefaultSyncInterval.
+func (d *Daemon) GetInterval() time.Duration {
+	if d == nil || d.Interval <= 0 {
+		return DefaultSyncInterval
+	}
+	return d.Interval
+}
+
+// GetParallelism returns the parallelism, falling back to DefaultSyncParallelism.
+func (d *Daemon) GetParallelism() int {
+	if d == nil || d.Parallelism <= 0 {
+		return DefaultSyncParallelism
+	}
+	return d.Parallelism
+}
+
+// IsQuiet reports whether a time falls within one of the quiet hours.
+//
+// Arguments:
+//   - t: The time, its own location is used for the time of day.
+//
+// Returns:
+//   - bool: True if no sync should run at that time.
+func (d *Daemon) IsQuiet(t time.Time) bool {
+	if d == nil {
+		return false
+	}
+	hour, minute, _ := t.Clock()
+	now := time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute
+	for _, window := range d.QuietHours {
+		start, end, err := parseWindow(window)
+		if err != nil {
+			continue
+		}
+		if start <= end {
+			if now >= start && now < end {
+				return true
+			}
+		} else if now >= start || now < end {
+			return true
+		}
+	}
+	return false
+}
+
+// parseWindow parses a "HH:MM-HH:MM" window into offsets from midnight.
+func parseWindow(window string) (time.Duration, time.Duration, error) {
+	from, to, ok := strings.Cut(window, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid quiet hours %q: expected HH:MM-HH:MM", window)
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(from))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid quiet hours %q: %w", window, err)
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(to))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid quiet hours %q: %w", window, err)
+	}
+	offset := func(t time.Time) time.Duration {
+		return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	return offset(start), offset(end), nil
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestDaemonQuietHours(t *testing.T) {
+	at := func(clock string) time.Time {
+		parsed, err := time.Parse("15:04", clock)
+		assert.NoError(t, err)
+		return parsed
+	}
+
+	daemon := &Daemon{QuietHours: []string{"22:00-07:00", "12:00 - 13:30"}}
+	assert.NoError(t, daemon.Validate())
+	assert.True(t, daemon.IsQuiet(at("23:15")))
+	assert.True(t, daemon.IsQuiet(at("06:59")))
+	assert.False(t, daemon.IsQuiet(at("07:00")))
+	assert.True(t, daemon.IsQuiet(at("13:00")))
+	assert.False(t, daemon.IsQuiet(at("13:30")))
+
+	var unset *Daemon
+	assert.False(t, unset.IsQuiet(at("23:00")))
+	assert.Equal(t, DefaultSyncInterval, unset.GetInterval())
+	assert.Equal(t, DefaultSyncParallelism, unset.GetParallelism())
+
+	assert.Error(t, (&Daemon{QuietHours: []string{"22:00"}}).Validate())
+	assert.Error(t, (&Daemon{QuietHours: []string{"25:00-07:00"}}).Validate())
+	assert.Error(t, (&Daemon{Interval: -time.Second}).Validate())
+}
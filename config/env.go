@@ -0,0 +1,116 @@
+package config
+
+import (
+	"path/filepath"
+	"slices"
+
+	"github.com/mateothegreat/go-util/files"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvFiles is a list of dotenv files that can be written in yaml either as a
+// single path or as a list of paths.
+type EnvFiles []string
+
+// UnmarshalYAML decodes a single path or a list of paths.
+func (f *EnvFiles) UnmarshalYAML(value *yaml.Node) error {
+	list, err := decodeStringList(value)
+	if err != nil {
+		return err
+	}
+	*f = list
+	return nil
+}
+
+// Environment controls the environment commands are started with. It can be
+// set on a workspace, repository, runner or command, the settings of the more
+// specific levels are layered on top of the less specific ones.
+type Environment struct {
+	// EnvFile are dotenv files loaded in order, a later file overrides the
+	// variables of an earlier one. Relative paths are resolved against the
+	// workspace or repository path, or for runners and commands against the
+	// directory they are run from.
+	EnvFile EnvFiles `yaml:"envFile,omitempty" required:"false"`
+	// CleanEnv starts commands with an empty environment instead of the
+	// environment of the current process.
+	CleanEnv bool `yaml:"cleanEnv,omitempty" required:"false"`
+	// InheritEnv are the names of the variables, or glob patterns, that are
+	// inherited from the current process when CleanEnv is set.
+	InheritEnv []string `yaml:"inheritEnv,omitempty" required:"false"`
+	// Secrets are the names of the variables, or glob patterns, whose values
+	// are masked in logged output in addition to the default secret names.
+	Secrets []string `yaml:"secrets,omitempty" required:"false"`
+}
+
+// Resolve returns a copy of the environment with relative env files resolved against a directory.
+//
+// Arguments:
+//   - dir: The directory relative env files are resolved against.
+//
+// Returns:
+//   - Environment: The resolved environment.
+func (e Environment) Resolve(dir string) Environment {
+	resolved := e
+	resolved.EnvFile = make(EnvFiles, len(e.EnvFile))
+	for i, file := range e.EnvFile {
+		file = files.ExpandPath(file)
+		if !filepath.IsAbs(file) && dir != "" {
+			file = filepath.Join(dir, file)
+		}
+		resolved.EnvFile[i] = file
+	}
+	return resolved
+}
+
+// Inherit returns the environment layered on top of a parent environment.
+// The env files of the parent are loaded first so the variables of this
+// environment take precedence, the environment is clean if either is clean
+// and the inherited variables and secrets of both apply.
+//
+// Arguments:
+//   - parent: The environment of the less specific level.
+//
+// Returns:
+//   - Environment: The combined environment.
+func (e Environment) Inherit(parent Environment) Environment {
+	return Environment{
+		EnvFile:    slices.Concat(parent.EnvFile, e.EnvFile),
+		CleanEnv:   parent.CleanEnv || e.CleanEnv,
+		InheritEnv: slices.Concat(parent.InheritEnv, e.InheritEnv),
+		Secrets:    slices.Concat(parent.Secrets, e.Secrets),
+	}
+}
+
+// GetEnvironment returns the environment of a repository layered on top of the
+// environment of the workspace, with every env file resolved.
+//
+// Arguments:
+//   - repository: The repository.
+//
+// Returns:
+//   - Environment: The combined environment.
+func (w *Workspace) GetEnvironment(repository *Repository) Environment {
+	path := w.GetAbsolutePath()
+	return repository.Environment.Resolve(filepath.Join(path, repository.Path)).Inherit(w.Environment.Resolve(path))
+}
+
+// decodeStringList decodes a yaml scalar or sequence into a list of strings,
+// an empty scalar decodes into an empty list.
+func decodeStringList(value *yaml.Node) ([]string, error) {
+	if value.Kind == yaml.ScalarNode {
+		var s string
+		if err := value.Decode(&s); err != nil {
+			return nil, err
+		}
+		if s == "" {
+			return nil, nil
+		}
+		return []string{s}, nil
+	}
+
+	var list []string
+	if err := value.Decode(&list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
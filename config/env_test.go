@@ -0,0 +1,52 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestEnvironmentInherit(t *testing.T) {
+	workspace := Workspace{
+		Path: "/work",
+		Environment: Environment{
+			EnvFile:    EnvFiles{".env", "/etc/shared.env"},
+			InheritEnv: []string{"PATH"},
+		},
+	}
+	repository := Repository{
+		Path: "api",
+		Environment: Environment{
+			EnvFile:  EnvFiles{".env.local"},
+			CleanEnv: true,
+			Secrets:  []string{"DATABASE_URL"},
+		},
+	}
+
+	assert.Equal(t, Environment{
+		EnvFile:    EnvFiles{"/work/.env", "/etc/shared.env", "/work/api/.env.local"},
+		CleanEnv:   true,
+		InheritEnv: []string{"PATH"},
+		Secrets:    []string{"DATABASE_URL"},
+	}, workspace.GetEnvironment(&repository))
+}
+
+func TestEnvironmentUnmarshalYAML(t *testing.T) {
+	var runners []Runner
+	err := yaml.Unmarshal([]byte(`
+- name: api
+  envFile: .env
+  commands:
+    - name: serve
+      command: [go, run, .]
+      envFile: [.env.defaults, .env.local]
+      cleanEnv: true
+      inheritEnv: [PATH, HOME]
+`), &runners)
+	assert.NoError(t, err)
+	assert.Equal(t, EnvFiles{".env"}, runners[0].EnvFile)
+	assert.Equal(t, EnvFiles{".env.defaults", ".env.local"}, runners[0].Commands[0].EnvFile)
+	assert.True(t, runners[0].Commands[0].CleanEnv)
+	assert.Equal(t, []string{"PATH", "HOME"}, runners[0].Commands[0].InheritEnv)
+}
@@ -0,0 +1,236 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ValidateDependencies ensures that every repository dependency refers to a
+// repository in the workspace and that the dependencies do not form a cycle.
+//
+// Returns:
+//   - error: An error describing the first unknown dependency or cycle found.
+func (w *Workspace) ValidateDependencies() error {
+	if w.Repositories == nil {
+		return nil
+	}
+
+	byName := make(map[string]*Repository, len(*w.Repositories))
+	for i := range *w.Repositories {
+		repo := &(*w.Repositories)[i]
+		byName[repo.Name] = repo
+	}
+
+	for _, repo := range *w.Repositories {
+		for _, dep := range repo.DependsOn {
+			if dep == repo.Name {
+				return fmt.Errorf("workspace %s: repository %s depends on itself", w.Name, repo.Name)
+			}
+			if _, ok := byName[dep]; !ok {
+				return fmt.Errorf("workspace %s: repository %s depends on unknown repository %s", w.Name, repo.Name, dep)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(*w.Repositories))
+	edges := make(map[string][]string, len(*w.Repositories))
+	for _, repo := range *w.Repositories {
+		names = append(names, repo.Name)
+		edges[repo.Name] = repo.DependsOn
+	}
+	if cycle := findCycle(names, edges); cycle != nil {
+		return fmt.Errorf("workspace %s: dependency cycle %s", w.Name, strings.Join(cycle, " -> "))
+	}
+
+	return nil
+}
+
+// RunnerID returns the id other runners refer to a runner by in dependsOn,
+// "repository/runner", a runner without a name is referred to by its index.
+//
+// Arguments:
+//   - index: The index of the runner in the repository runners.
+//
+// Returns:
+//   - string: The runner id.
+func (r *Repository) RunnerID(index int) string {
+	name := fmt.Sprintf("%d", index)
+	if r.Runners != nil && index < len(*r.Runners) && (*r.Runners)[index].Name != "" {
+		name = (*r.Runners)[index].Name
+	}
+	return fmt.Sprintf("%s/%s", r.Name, name)
+}
+
+// ResolveRunnerDependency returns the id of the runner a dependsOn entry refers to.
+// An entry without a repository refers to a runner of the same repository.
+//
+// Arguments:
+//   - dep: The dependsOn entry, "runner" or "repository/runner".
+//
+// Returns:
+//   - string: The runner id.
+func (r *Repository) ResolveRunnerDependency(dep string) string {
+	if strings.Contains(dep, "/") {
+		return dep
+	}
+	return fmt.Sprintf("%s/%s", r.Name, dep)
+}
+
+// ValidateRunnerDependencies ensures that every runner dependency refers to a
+// runner in the workspace and that the dependencies do not form a cycle.
+//
+// Returns:
+//   - error: An error describing the first unknown dependency or cycle found.
+func (w *Workspace) ValidateRunnerDependencies() error {
+	if w.Repositories == nil {
+		return nil
+	}
+
+	var ids []string
+	edges := make(map[string][]string)
+	for _, repo := range *w.Repositories {
+		if repo.Runners == nil {
+			continue
+		}
+		for i, runner := range *repo.Runners {
+			id := repo.RunnerID(i)
+			ids = append(ids, id)
+			for _, dep := range runner.DependsOn {
+				edges[id] = append(edges[id], repo.ResolveRunnerDependency(dep))
+			}
+		}
+	}
+
+	for _, id := range ids {
+		for _, dep := range edges[id] {
+			if !slices.Contains(ids, dep) {
+				return fmt.Errorf("workspace %s: runner %s depends on unknown runner %s", w.Name, id, dep)
+			}
+		}
+	}
+	if cycle := findCycle(ids, edges); cycle != nil {
+		return fmt.Errorf("workspace %s: runner dependency cycle %s", w.Name, strings.Join(cycle, " -> "))
+	}
+
+	return nil
+}
+
+// findCycle returns the first dependency cycle found, starting and ending
+// with the same node, or nil when there is none.
+func findCycle(nodes []string, edges map[string][]string) []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(nodes))
+	var stack []string
+
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		switch state[name] {
+		case visiting:
+			start := 0
+			for i, n := range stack {
+				if n == name {
+					start = i
+					break
+				}
+			}
+			return append(append([]string{}, stack[start:]...), name)
+		case visited:
+			return nil
+		}
+
+		state[name] = visiting
+		stack = append(stack, name)
+		for _, dep := range edges[name] {
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = visited
+		return nil
+	}
+
+	for _, name := range nodes {
+		if cycle := visit(name); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// GetRepositoryLevels groups repositories into levels in topological order.
+// Every repository in a level only depends on repositories in earlier levels,
+// so the repositories within a level can be operated on in parallel.
+// Dependencies on repositories that are not in the given list are ignored.
+// Repositories keep their relative order within a level.
+//
+// Arguments:
+//   - repositories: The repositories to order.
+//
+// Returns:
+//   - [][]Repository: The repositories grouped by level.
+//   - error: An error if the dependencies form a cycle.
+func (w *Workspace) GetRepositoryLevels(repositories []Repository) ([][]Repository, error) {
+	included := make(map[string]bool, len(repositories))
+	for _, repo := range repositories {
+		included[repo.Name] = true
+	}
+
+	pending := make([]int, len(repositories))
+	for i, repo := range repositories {
+		for _, dep := range repo.DependsOn {
+			if included[dep] && dep != repo.Name {
+				pending[i]++
+			}
+		}
+	}
+
+	var levels [][]Repository
+	done := make([]bool, len(repositories))
+	remaining := len(repositories)
+	for remaining > 0 {
+		var level []int
+		for i := range repositories {
+			if !done[i] && pending[i] <= 0 {
+				level = append(level, i)
+			}
+		}
+		if len(level) == 0 {
+			var blocked []string
+			for i, repo := range repositories {
+				if !done[i] {
+					blocked = append(blocked, repo.Name)
+				}
+			}
+			return nil, fmt.Errorf("workspace %s: dependency cycle between %s", w.Name, strings.Join(blocked, ", "))
+		}
+
+		repos := make([]Repository, 0, len(level))
+		finished := make(map[string]bool, len(level))
+		for _, i := range level {
+			done[i] = true
+			finished[repositories[i].Name] = true
+			repos = append(repos, repositories[i])
+		}
+		remaining -= len(level)
+
+		for i, repo := range repositories {
+			if done[i] {
+				continue
+			}
+			for _, dep := range repo.DependsOn {
+				if finished[dep] && dep != repo.Name {
+					pending[i]--
+				}
+			}
+		}
+		levels = append(levels, repos)
+	}
+
+	return levels, nil
+}
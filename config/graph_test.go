@@ -0,0 +1,122 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert"
+)
+
+func names(levels [][]Repository) [][]string {
+	var result [][]string
+	for _, level := range levels {
+		var levelNames []string
+		for _, repo := range level {
+			levelNames = append(levelNames, repo.Name)
+		}
+		result = append(result, levelNames)
+	}
+	return result
+}
+
+func TestGetRepositoryLevels(t *testing.T) {
+	workspace := Workspace{
+		Name: "test",
+		Repositories: &[]Repository{
+			{Name: "api", DependsOn: []string{"lib", "proto"}},
+			{Name: "web", DependsOn: []string{"api"}},
+			{Name: "lib"},
+			{Name: "proto", DependsOn: []string{"lib"}},
+			{Name: "docs"},
+		},
+	}
+	assert.NoError(t, workspace.ValidateDependencies())
+
+	levels, err := workspace.GetRepositoryLevels(*workspace.Repositories)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"lib", "docs"},
+		{"proto"},
+		{"api"},
+		{"web"},
+	}, names(levels))
+}
+
+func TestGetRepositoryLevelsSubset(t *testing.T) {
+	workspace := Workspace{
+		Name: "test",
+		Repositories: &[]Repository{
+			{Name: "lib"},
+			{Name: "api", DependsOn: []string{"lib"}},
+			{Name: "web", DependsOn: []string{"api"}},
+		},
+	}
+
+	levels, err := workspace.GetRepositoryLevels((*workspace.Repositories)[1:])
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"api"}, {"web"}}, names(levels))
+}
+
+func TestValidateDependenciesCycle(t *testing.T) {
+	workspace := Workspace{
+		Name: "test",
+		Repositories: &[]Repository{
+			{Name: "a", DependsOn: []string{"b"}},
+			{Name: "b", DependsOn: []string{"c"}},
+			{Name: "c", DependsOn: []string{"a"}},
+		},
+	}
+
+	err := workspace.ValidateDependencies()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "a -> b -> c -> a")
+
+	_, err = workspace.GetRepositoryLevels(*workspace.Repositories)
+	assert.Error(t, err)
+}
+
+func TestValidateDependenciesUnknown(t *testing.T) {
+	workspace := Workspace{
+		Name: "test",
+		Repositories: &[]Repository{
+			{Name: "a", DependsOn: []string{"missing"}},
+		},
+	}
+
+	assert.Error(t, workspace.ValidateDependencies())
+}
+
+func TestValidateRunnerDependencies(t *testing.T) {
+	workspace := Workspace{
+		Name: "test",
+		Repositories: &[]Repository{
+			{Name: "db", Runners: &[]Runner{{Name: "postgres"}, {Name: "migrate", DependsOn: []string{"postgres"}}}},
+			{Name: "api", Runners: &[]Runner{{Name: "serve", DependsOn: []string{"db/migrate"}}, {}}},
+		},
+	}
+	assert.NoError(t, workspace.ValidateRunnerDependencies())
+	assert.Equal(t, "api/1", (*workspace.Repositories)[1].RunnerID(1))
+
+	(*(*workspace.Repositories)[1].Runners)[1].DependsOn = []string{"db/redis"}
+	err := workspace.ValidateRunnerDependencies()
+	assert.EqualError(t, err, "workspace test: runner api/1 depends on unknown runner db/redis")
+
+	(*(*workspace.Repositories)[1].Runners)[1].DependsOn = nil
+	(*(*workspace.Repositories)[0].Runners)[0].DependsOn = []string{"api/serve"}
+	err = workspace.ValidateRunnerDependencies()
+	assert.EqualError(t, err, "workspace test: runner dependency cycle db/postgres -> api/serve -> db/migrate -> db/postgres")
+}
+
+func TestProbeValidate(t *testing.T) {
+	assert.NoError(t, (&Probe{TCP: "localhost:5432"}).Validate())
+	assert.NoError(t, (&Probe{HTTP: "http://localhost:8080/healthz"}).Validate())
+	assert.NoError(t, (&Probe{Command: []string{"pg_isready"}}).Validate())
+	assert.NoError(t, (&Probe{Log: "listening on"}).Validate())
+
+	assert.Error(t, (&Probe{}).Validate())
+	assert.Error(t, (&Probe{TCP: "localhost:5432", Log: "ready"}).Validate())
+	assert.Error(t, (&Probe{TCP: "localhost"}).Validate())
+	assert.Error(t, (&Probe{HTTP: "localhost:8080"}).Validate())
+	assert.Error(t, (&Probe{Log: "("}).Validate())
+	assert.Error(t, (&Probe{Log: "ready", Timeout: -time.Second}).Validate())
+}
@@ -0,0 +1,10 @@
+package config
+
+// History configures the history of the operations that change repositories,
+// which is what undo restores repositories from.
+type History struct {
+	// Path is the history file, empty uses history.DefaultPath.
+	Path string `yaml:"path,omitempty" required:"false"`
+	// Disabled stops operations from being recorded.
+	Disabled bool `yaml:"disabled,omitempty" required:"false"`
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"gopkg.in/yaml.v3"
+)
+
+// Patterns is a list of patterns that can be written in yaml either as a
+// single string or as a list of strings.
+type Patterns []string
+
+// UnmarshalYAML decodes a single pattern or a list of patterns.
+func (p *Patterns) UnmarshalYAML(value *yaml.Node) error {
+	list, err := decodeStringList(value)
+	if err != nil {
+		return err
+	}
+	*p = list
+	return nil
+}
+
+// Matcher selects the files below a path.
+//
+// Include and Ignore are regular expressions matched against the absolute path
+// of a file. Globs are doublestar patterns such as "**/*.go" matched against the
+// path relative to Path, a glob starting with "!" excludes the files it matches.
+type Matcher struct {
+	Path    string   `yaml:"path" required:"true"`
+	Include Patterns `yaml:"include,omitempty" required:"false"`
+	Ignore  Patterns `yaml:"ignore,omitempty" required:"false"`
+	Globs   Patterns `yaml:"globs,omitempty" required:"false"`
+}
+
+// CompiledMatcher is a Matcher with its patterns compiled, ready to match paths.
+type CompiledMatcher struct {
+	// Root is the absolute directory the matcher selects files below.
+	Root    string
+	include []*regexp.Regexp
+	ignore  []*regexp.Regexp
+	globs   []string
+	negated []string
+}
+
+// Validate checks that every pattern of the matcher compiles.
+//
+// Returns:
+//   - error: An error describing the first invalid pattern.
+func (m *Matcher) Validate() error {
+	_, err := m.Compile("")
+	return err
+}
+
+// Compile compiles the matcher patterns.
+//
+// Arguments:
+//   - base: The directory the matcher path is resolved against.
+//
+// Returns:
+//   - *CompiledMatcher: The compiled matcher.
+//   - error: An error if a pattern is not valid.
+func (m *Matcher) Compile(base string) (*CompiledMatcher, error) {
+	c := &CompiledMatcher{
+		Root: filepath.Clean(filepath.Join(base, m.Path)),
+	}
+
+	for _, pattern := range m.Include {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include pattern %q: %w", pattern, err)
+		}
+		c.include = append(c.include, re)
+	}
+	for _, pattern := range m.Ignore {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ignore pattern %q: %w", pattern, err)
+		}
+		c.ignore = append(c.ignore, re)
+	}
+	for _, glob := range m.Globs {
+		pattern, negated := strings.CutPrefix(glob, "!")
+		if pattern == "" || !doublestar.ValidatePattern(pattern) {
+			return nil, fmt.Errorf("invalid glob %q", glob)
+		}
+		if negated {
+			c.negated = append(c.negated, pattern)
+		} else {
+			c.globs = append(c.globs, pattern)
+		}
+	}
+
+	return c, nil
+}
+
+// Match reports whether the matcher selects the path.
+// A path is selected when it is below Root, matches any include pattern or
+// glob (or there are none), and matches no ignore pattern or negated glob.
+//
+// Arguments:
+//   - path: The absolute path to match.
+//
+// Returns:
+//   - bool: True if the path is selected.
+func (c *CompiledMatcher) Match(path string) bool {
+	rel, err := filepath.Rel(c.Root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+
+	for _, re := range c.ignore {
+		if re.MatchString(path) {
+			return false
+		}
+	}
+	for _, pattern := range c.negated {
+		if doublestar.MatchUnvalidated(pattern, rel) {
+			return false
+		}
+	}
+
+	if len(c.include) == 0 && len(c.globs) == 0 {
+		return true
+	}
+	for _, re := range c.include {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	for _, pattern := range c.globs {
+		if doublestar.MatchUnvalidated(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestMatcherGlobs(t *testing.T) {
+	matcher := Matcher{Path: "src", Globs: Patterns{"**/*.go", "!vendor/**"}}
+	compiled, err := matcher.Compile("/repo")
+	assert.NoError(t, err)
+
+	assert.True(t, compiled.Match("/repo/src/main.go"))
+	assert.True(t, compiled.Match("/repo/src/pkg/sub/file.go"))
+	assert.False(t, compiled.Match("/repo/src/gopher.txt"))
+	assert.False(t, compiled.Match("/repo/src/vendor/lib/lib.go"))
+	assert.False(t, compiled.Match("/repo/other/main.go"))
+	assert.False(t, compiled.Match("/repo/srcx/main.go"))
+}
+
+func TestMatcherRegexAndGlobs(t *testing.T) {
+	// A bare ".go" regex matches more than intended, a glob does not.
+	regex, err := (&Matcher{Include: Patterns{".go"}}).Compile("/repo")
+	assert.NoError(t, err)
+	assert.True(t, regex.Match("/repo/gopher.txt"))
+
+	glob, err := (&Matcher{Globs: Patterns{"**/*.go"}}).Compile("/repo")
+	assert.NoError(t, err)
+	assert.False(t, glob.Match("/repo/gopher.txt"))
+
+	// Any include pattern or glob selects a file, any ignore pattern excludes it.
+	mixed, err := (&Matcher{
+		Include: Patterns{`\.proto$`},
+		Ignore:  Patterns{`_test\.go$`, `/gen/`},
+		Globs:   Patterns{"*.go"},
+	}).Compile("/repo")
+	assert.NoError(t, err)
+	assert.True(t, mixed.Match("/repo/api.proto"))
+	assert.True(t, mixed.Match("/repo/main.go"))
+	assert.False(t, mixed.Match("/repo/main_test.go"))
+	assert.False(t, mixed.Match("/repo/gen/api.proto"))
+
+	// Without patterns everything below the path matches.
+	all, err := (&Matcher{}).Compile("/repo")
+	assert.NoError(t, err)
+	assert.True(t, all.Match("/repo/any/file"))
+}
+
+func TestMatcherValidate(t *testing.T) {
+	assert.NoError(t, (&Matcher{Include: Patterns{`\.go$`}, Globs: Patterns{"**/*.go", "!vendor/**"}}).Validate())
+	assert.Error(t, (&Matcher{Include: Patterns{"("}}).Validate())
+	assert.Error(t, (&Matcher{Ignore: Patterns{"[a-"}}).Validate())
+	assert.Error(t, (&Matcher{Globs: Patterns{"src/[a-"}}).Validate())
+	assert.Error(t, (&Matcher{Globs: Patterns{"!"}}).Validate())
+
+	runner := Runner{Name: "dev", Matchers: []Matcher{{Path: "src", Globs: Patterns{"{a,b"}}}}
+	assert.Error(t, runner.Validate())
+}
+
+func TestPatternsUnmarshalYAML(t *testing.T) {
+	var matchers []Matcher
+	err := yaml.Unmarshal([]byte(`
+- path: src
+  include: \.go$
+  globs:
+    - "**/*.go"
+    - "!vendor/**"
+- path: docs
+  ignore: [\.tmp$, \.bak$]
+`), &matchers)
+	assert.NoError(t, err)
+	assert.Equal(t, Patterns{`\.go$`}, matchers[0].Include)
+	assert.Equal(t, Patterns{"**/*.go", "!vendor/**"}, matchers[0].Globs)
+	assert.Equal(t, Patterns{`\.tmp$`, `\.bak$`}, matchers[1].Ignore)
+}
@@ -0,0 +1,334 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Selector is a parsed boolean expression that selects repositories.
+//
+// A selector is made of terms combined with && (and), || (or), ! (not) and
+// parentheses. A bare word matches a repository tag, while field terms match
+// a repository attribute:
+//
+//   - name=api-*      glob match against the name (also path, url, branch, tag)
+//   - name!=api-*     negated glob match
+//   - path~^services/ regular expression match
+//
+// Values containing spaces or operator characters can be quoted with single
+// or double quotes, for example path~"^(api|web)/".
+type Selector struct {
+	expr string
+	root selectorNode
+}
+
+type selectorNode interface {
+	match(repo *Repository) bool
+}
+
+type selectorAnd struct{ left, right selectorNode }
+type selectorOr struct{ left, right selectorNode }
+type selectorNot struct{ node selectorNode }
+type selectorTag string
+
+type selectorTerm struct {
+	field   string
+	op      string
+	value   string
+	pattern *regexp.Regexp
+}
+
+func (n selectorAnd) match(repo *Repository) bool { return n.left.match(repo) && n.right.match(repo) }
+func (n selectorOr) match(repo *Repository) bool  { return n.left.match(repo) || n.right.match(repo) }
+func (n selectorNot) match(repo *Repository) bool { return !n.node.match(repo) }
+func (n selectorTag) match(repo *Repository) bool { return slices.Contains(repo.Tags, string(n)) }
+
+func (n selectorTerm) match(repo *Repository) bool {
+	var values []string
+	switch n.field {
+	case "name":
+		values = []string{repo.Name}
+	case "path":
+		values = []string{repo.Path}
+	case "url":
+		values = []string{repo.URL}
+	case "branch":
+		values = []string{repo.Branch}
+	case "tag":
+		values = repo.Tags
+	}
+
+	matched := slices.ContainsFunc(values, func(value string) bool {
+		if n.pattern != nil {
+			return n.pattern.MatchString(value)
+		}
+		ok, _ := path.Match(n.value, value)
+		return ok
+	})
+	if n.op == "!=" {
+		return !matched
+	}
+	return matched
+}
+
+var selectorFields = []string{"name", "path", "url", "branch", "tag"}
+
+// ParseSelector parses a selector expression.
+// An empty expression returns a selector that matches every repository.
+//
+// Arguments:
+//   - expr: The selector expression.
+//
+// Returns:
+//   - *Selector: The parsed selector.
+//   - error: An error if the expression is not valid.
+func ParseSelector(expr string) (*Selector, error) {
+	s := &Selector{expr: strings.TrimSpace(expr)}
+	if s.expr == "" {
+		return s, nil
+	}
+
+	p := &selectorParser{input: s.expr}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector %q: %w", expr, err)
+	}
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return nil, fmt.Errorf("invalid selector %q: unexpected %q at position %d", expr, p.input[p.pos:], p.pos)
+	}
+	s.root = root
+
+	return s, nil
+}
+
+// MustParseSelector is like ParseSelector but panics if the expression is not valid.
+//
+// Arguments:
+//   - expr: The selector expression.
+//
+// Returns:
+//   - *Selector: The parsed selector.
+func MustParseSelector(expr string) *Selector {
+	s, err := ParseSelector(expr)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// TagSelector returns a selector matching repositories that have any of the tags.
+// No tags returns a selector that matches every repository.
+//
+// Arguments:
+//   - tags: The tags to match exactly.
+//
+// Returns:
+//   - *Selector: The selector.
+func TagSelector(tags []string) *Selector {
+	s := &Selector{expr: strings.Join(tags, " || ")}
+	for _, tag := range tags {
+		if s.root == nil {
+			s.root = selectorTag(tag)
+		} else {
+			s.root = selectorOr{s.root, selectorTag(tag)}
+		}
+	}
+	return s
+}
+
+// Match reports whether the repository is selected.
+// A nil or empty selector matches every repository.
+//
+// Arguments:
+//   - repo: The repository to match.
+//
+// Returns:
+//   - bool: True if the repository is selected.
+func (s *Selector) Match(repo *Repository) bool {
+	if s == nil || s.root == nil {
+		return true
+	}
+	return s.root.match(repo)
+}
+
+// String returns the expression the selector was parsed from.
+func (s *Selector) String() string {
+	if s == nil {
+		return ""
+	}
+	return s.expr
+}
+
+// Filter returns the repositories that match the selector.
+// Each repository is returned at most once, in the order given.
+//
+// Arguments:
+//   - repositories: The repositories to filter.
+//
+// Returns:
+//   - []Repository: The selected repositories.
+func (s *Selector) Filter(repositories []Repository) []Repository {
+	var selected []Repository
+	for i := range repositories {
+		if s.Match(&repositories[i]) {
+			selected = append(selected, repositories[i])
+		}
+	}
+	return selected
+}
+
+type selectorParser struct {
+	input string
+	pos   int
+}
+
+func (p *selectorParser) skipSpace() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *selectorParser) consume(token string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.input[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *selectorParser) parseOr() (selectorNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.consume("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = selectorOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *selectorParser) parseAnd() (selectorNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.consume("&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = selectorAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *selectorParser) parseUnary() (selectorNode, error) {
+	if p.consume("!") {
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return selectorNot{node}, nil
+	}
+	if p.consume("(") {
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(")") {
+			return nil, fmt.Errorf("missing closing parenthesis at position %d", p.pos)
+		}
+		return node, nil
+	}
+	return p.parseTerm()
+}
+
+func (p *selectorParser) parseTerm() (selectorNode, error) {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.input) {
+		c := rune(p.input[p.pos])
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && !strings.ContainsRune("-_./*?[]:@", c) {
+			break
+		}
+		p.pos++
+	}
+	word := p.input[start:p.pos]
+	if word == "" {
+		if p.pos >= len(p.input) {
+			return nil, fmt.Errorf("unexpected end of expression")
+		}
+		return nil, fmt.Errorf("unexpected %q at position %d", p.input[p.pos], p.pos)
+	}
+
+	var op string
+	for _, candidate := range []string{"!=", "=", "~"} {
+		if strings.HasPrefix(p.input[p.pos:], candidate) {
+			op = candidate
+			p.pos += len(candidate)
+			break
+		}
+	}
+	if op == "" {
+		if _, err := path.Match(word, ""); err != nil {
+			return nil, fmt.Errorf("invalid tag pattern %q: %w", word, err)
+		}
+		return selectorTerm{field: "tag", op: "=", value: word}, nil
+	}
+
+	if !slices.Contains(selectorFields, word) {
+		return nil, fmt.Errorf("unknown field %q, expected one of %s", word, strings.Join(selectorFields, ", "))
+	}
+
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	term := selectorTerm{field: word, op: op, value: value}
+	if op == "~" {
+		term.pattern, err = regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %w", value, err)
+		}
+	} else if _, err := path.Match(value, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", value, err)
+	}
+	return term, nil
+}
+
+func (p *selectorParser) parseValue() (string, error) {
+	if p.pos < len(p.input) && (p.input[p.pos] == '"' || p.input[p.pos] == '\'') {
+		quote := p.input[p.pos]
+		end := strings.IndexByte(p.input[p.pos+1:], quote)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated quote at position %d", p.pos)
+		}
+		value := p.input[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return value, nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.input) {
+		rest := p.input[p.pos:]
+		if unicode.IsSpace(rune(rest[0])) || rest[0] == ')' || strings.HasPrefix(rest, "&&") || strings.HasPrefix(rest, "||") {
+			break
+		}
+		p.pos++
+	}
+	if p.pos == start {
+		return "", fmt.Errorf("missing value at position %d", p.pos)
+	}
+	return p.input[start:p.pos], nil
+}
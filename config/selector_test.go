@@ -0,0 +1,72 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+var selectorRepositories = []Repository{
+	{Name: "api-users", Path: "services/users", Tags: []string{"backend"}},
+	{Name: "api-legacy", Path: "services/legacy", Tags: []string{"backend", "legacy"}},
+	{Name: "web", Path: "apps/web", Tags: []string{"frontend"}},
+	{Name: "proto", Path: "libs/proto", Tags: []string{"backend", "frontend"}},
+}
+
+func selectNames(t *testing.T, expr string) []string {
+	t.Helper()
+	selector, err := ParseSelector(expr)
+	assert.NoError(t, err)
+
+	var names []string
+	for _, repo := range selector.Filter(selectorRepositories) {
+		names = append(names, repo.Name)
+	}
+	return names
+}
+
+func TestSelectorExpressions(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected []string
+	}{
+		{"", []string{"api-users", "api-legacy", "web", "proto"}},
+		{"backend", []string{"api-users", "api-legacy", "proto"}},
+		{"backend && !legacy", []string{"api-users", "proto"}},
+		{"name=api-*", []string{"api-users", "api-legacy"}},
+		{"name!=api-*", []string{"web", "proto"}},
+		{"path~^services/", []string{"api-users", "api-legacy"}},
+		{`path~"^(apps|libs)/"`, []string{"web", "proto"}},
+		{"frontend || legacy", []string{"api-legacy", "web", "proto"}},
+		{"!(backend || frontend)", nil},
+		{"tag=front*", []string{"web", "proto"}},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, selectNames(t, tt.expr), tt.expr)
+	}
+}
+
+func TestSelectorErrors(t *testing.T) {
+	for _, expr := range []string{
+		"backend &&",
+		"(backend",
+		"owner=me",
+		"path~(",
+		"name=",
+		"backend frontend",
+		`name="api`,
+	} {
+		_, err := ParseSelector(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestGetRepositoriesDeduplicates(t *testing.T) {
+	workspace := Workspace{Repositories: &selectorRepositories}
+
+	repositories := workspace.GetRepositories([]string{"backend", "frontend"})
+	assert.Equal(t, 4, len(*repositories))
+	assert.Equal(t, "api-users", (*repositories)[0].Name)
+	assert.Equal(t, "proto", (*repositories)[3].Name)
+}
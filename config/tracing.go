@@ -0,0 +1,81 @@
+package config
+
+import (
+	"fmt"
+	"os"
+)
+
+// TracingExporter is where the spans of traced operations are sent.
+type TracingExporter string
+
+const (
+	// OTLPExporter sends spans to an OpenTelemetry collector with OTLP over HTTP.
+	OTLPExporter TracingExporter = "otlp"
+	// StdoutExporter writes spans to standard output as JSON, for local debugging.
+	StdoutExporter TracingExporter = "stdout"
+	// FileExporter appends spans to a file as JSON, for local debugging.
+	FileExporter TracingExporter = "file"
+)
+
+const (
+	// DefaultOTLPEndpoint is the OTLP/HTTP endpoint spans are sent to when none is set.
+	DefaultOTLPEndpoint = "http://localhost:4318"
+	// DefaultServiceName is the service name spans are reported with when none is set.
+	DefaultServiceName = "polyrepo"
+)
+
+// Tracing configures the OpenTelemetry traces of workspace operations.
+type Tracing struct {
+	// Exporter is where spans are sent, tracing is disabled when it is empty.
+	Exporter TracingExporter `yaml:"exporter,omitempty" required:"false"`
+	// Endpoint is the base URL of the OTLP/HTTP receiver, spans are posted to its /v1/traces path.
+	// It falls back to the OTEL_EXPORTER_OTLP_ENDPOINT environment variable and then DefaultOTLPEndpoint.
+	Endpoint string `yaml:"endpoint,omitempty" required:"false"`
+	// Headers are sent with every OTLP request, for example to authenticate with a hosted collector.
+	Headers map[string]string `yaml:"headers,omitempty" required:"false"`
+	// File is the path spans are appended to by the file exporter.
+	File string `yaml:"file,omitempty" required:"false"`
+	// ServiceName is the service.name resource attribute of the spans.
+	ServiceName string `yaml:"serviceName,omitempty" required:"false"`
+	// SampleRatio is the fraction of traces recorded, zero records every trace.
+	SampleRatio float64 `yaml:"sampleRatio,omitempty" required:"false"`
+}
+
+// Validate checks the tracing settings.
+//
+// Returns:
+//   - error: An error describing the first invalid setting.
+func (t *Tracing) Validate() error {
+	switch t.Exporter {
+	case "", OTLPExporter, StdoutExporter:
+	case FileExporter:
+		if t.File == "" {
+			return fmt.Errorf("tracing file exporter requires a file")
+		}
+	default:
+		return fmt.Errorf("unknown tracing exporter %q", t.Exporter)
+	}
+	if t.SampleRatio < 0 || t.SampleRatio > 1 {
+		return fmt.Errorf("tracing sample ratio must be between 0 and 1")
+	}
+	return nil
+}
+
+// GetEndpoint returns the OTLP endpoint, falling back to OTEL_EXPORTER_OTLP_ENDPOINT and DefaultOTLPEndpoint.
+func (t *Tracing) GetEndpoint() string {
+	if t.Endpoint != "" {
+		return t.Endpoint
+	}
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	return DefaultOTLPEndpoint
+}
+
+// GetServiceName returns the service name, falling back to DefaultServiceName.
+func (t *Tracing) GetServiceName() string {
+	if t.ServiceName == "" {
+		return DefaultServiceName
+	}
+	return t.ServiceName
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"net/url"
+	"strings"
+)
+
+// RepositoryRef is a repository together with the workspace it is configured in.
+type RepositoryRef struct {
+	Workspace  *Workspace
+	Repository *Repository
+}
+
+// NormalizeURL reduces a git remote URL to its lower case host and path so
+// that the HTTPS, SSH and scp-like forms of the same remote compare equal,
+// for example "https://github.com/org/repo.git" and "git@github.com:org/repo"
+// both normalize to "github.com/org/repo".
+//
+// Arguments:
+//   - raw: The URL to normalize.
+//
+// Returns:
+//   - string: The normalized URL, empty if raw is empty.
+func NormalizeURL(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+
+	var host, path string
+	if strings.Contains(raw, "://") {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return strings.ToLower(raw)
+		}
+		host, path = u.Hostname(), u.Path
+	} else if i := strings.Index(raw, ":"); i >= 0 && !strings.Contains(raw[:i], "/") {
+		// scp-like syntax: [user@]host:path
+		host, path = raw[:i], raw[i+1:]
+		if j := strings.LastIndex(host, "@"); j >= 0 {
+			host = host[j+1:]
+		}
+	} else {
+		path = raw
+	}
+
+	path = strings.Trim(path, "/")
+	path = strings.TrimSuffix(path, ".git")
+	if host == "" {
+		return strings.ToLower(path)
+	}
+	return strings.ToLower(host + "/" + path)
+}
+
+// FindRepositoriesByURL returns the repositories whose URL matches any of the
+// given URLs once normalized with NormalizeURL, across every workspace.
+//
+// Arguments:
+//   - urls: The URLs to look for, such as the clone and SSH URLs of a remote.
+//
+// Returns:
+//   - []RepositoryRef: The matching repositories in the order they are configured.
+func (c *Config) FindRepositoriesByURL(urls ...string) []RepositoryRef {
+	wanted := make(map[string]bool, len(urls))
+	for _, u := range urls {
+		if normalized := NormalizeURL(u); normalized != "" {
+			wanted[normalized] = true
+		}
+	}
+	if len(wanted) == 0 || c.Workspaces == nil {
+		return nil
+	}
+
+	var refs []RepositoryRef
+	for i := range *c.Workspaces {
+		workspace := &(*c.Workspaces)[i]
+		if workspace.Repositories == nil {
+			continue
+		}
+		for j := range *workspace.Repositories {
+			repo := &(*workspace.Repositories)[j]
+			if wanted[NormalizeURL(repo.URL)] {
+				refs = append(refs, RepositoryRef{Workspace: workspace, Repository: repo})
+			}
+		}
+	}
+	return refs
+}
@@ -1,9 +1,5 @@
 package config
 
-import (
-	"slices"
-)
-
 // Workspace allows you to group repositories together.
 type Workspace struct {
 	Name         string        `yaml:"name"`
@@ -11,11 +7,15 @@ type Workspace struct {
 	Repositories *[]Repository `yaml:"repositories" required:"false"`
 	Auth         *Auth         `yaml:"auth,omitempty" required:"false"`
 	Tags         []string      `yaml:"tags" required:"false"`
+	Daemon       *Daemon       `yaml:"daemon,omitempty" required:"false"`
+
+	Environment `yaml:",inline"`
 }
 
 // GetRepositories returns the repositories for the workspace.
 // If no tags are provided, all repositories are returned.
-// If tags are provided, only repositories with the tags are returned.
+// If tags are provided, only repositories with any of the tags are returned.
+// Each repository is returned once, in the order it is configured.
 //
 // Arguments:
 //   - tags: The tags to filter the repositories by.
@@ -23,17 +23,21 @@ type Workspace struct {
 // Returns:
 //   - *[]Repository: The repositories.
 func (w *Workspace) GetRepositories(tags []string) *[]Repository {
-	var repositories []Repository
-	for _, repository := range *w.Repositories {
-		if len(tags) == 0 {
-			repositories = append(repositories, repository)
-			continue
-		}
-		for _, tag := range tags {
-			if slices.Contains(repository.Tags, tag) {
-				repositories = append(repositories, repository)
-			}
-		}
-	}
+	repositories := w.SelectRepositories(TagSelector(tags))
 	return &repositories
 }
+
+// SelectRepositories returns the repositories matched by a selector.
+// A nil selector matches every repository.
+//
+// Arguments:
+//   - selector: The selector to filter the repositories by.
+//
+// Returns:
+//   - []Repository: The selected repositories in the order they are configured.
+func (w *Workspace) SelectRepositories(selector *Selector) []Repository {
+	if w.Repositories == nil {
+		return nil
+	}
+	return selector.Filter(*w.Repositories)
+}
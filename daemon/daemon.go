@@ -0,0 +1,393 @@
+// Package daemon keeps the repositories of workspaces up to date in the
+// background by periodically fetching them and fast-forwarding clean ones.
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mateothegreat/go-multilog/multilog"
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/git"
+	"github.com/polyrepopro/api/repositories"
+	"github.com/polyrepopro/api/workspaces"
+)
+
+// EventType is the type of an event emitted by the daemon.
+type EventType string
+
+const (
+	// EventUpdated is emitted when a repository was fast-forwarded.
+	EventUpdated EventType = "updated"
+	// EventSkipped is emitted when a repository was fetched but could not be fast-forwarded.
+	EventSkipped EventType = "skipped"
+	// EventFailed is emitted when a repository could not be fetched or updated.
+	EventFailed EventType = "failed"
+)
+
+// Event describes the outcome of syncing a repository that is worth reporting.
+type Event struct {
+	Time       time.Time `json:"time"`
+	Type       EventType `json:"type"`
+	Workspace  string    `json:"workspace"`
+	Repository string    `json:"repository"`
+	// State is the outcome of the fast-forward, empty if the repository could not be fetched.
+	State   git.FastForwardState `json:"state,omitempty"`
+	Message string               `json:"message"`
+	Before  string               `json:"before,omitempty"`
+	After   string               `json:"after,omitempty"`
+}
+
+// RepositoryStatus is the sync status of a repository.
+type RepositoryStatus struct {
+	Workspace  string `json:"workspace"`
+	Repository string `json:"repository"`
+	// Synced is the last time the repository was fetched and its branch was up to date afterwards.
+	Synced time.Time `json:"synced"`
+	// Checked is the last time a sync of the repository was attempted.
+	Checked time.Time            `json:"checked"`
+	State   git.FastForwardState `json:"state,omitempty"`
+	Error   string               `json:"error,omitempty"`
+}
+
+// DaemonArgs are the arguments for creating a daemon.
+type DaemonArgs struct {
+	Config *config.Config
+	// Workspaces are the names of the workspaces to sync, empty syncs every
+	// workspace whose daemon is not disabled.
+	Workspaces []string
+	// Save writes the sync times back to the config file after every sync.
+	Save bool
+	// OnEvent is called for every event, calls are never concurrent.
+	OnEvent func(Event)
+}
+
+// Daemon periodically syncs the repositories of workspaces.
+type Daemon struct {
+	config     *config.Config
+	workspaces []*config.Workspace
+	save       bool
+	onEvent    func(Event)
+
+	mu       sync.Mutex
+	statuses map[string]*RepositoryStatus
+
+	eventMu sync.Mutex
+}
+
+// NewDaemon creates a daemon for the workspaces of a config.
+//
+// Arguments:
+//   - args: The arguments for the daemon.
+//
+// Returns:
+//   - *Daemon: The daemon, call Run to start syncing.
+//   - error: An error if a workspace could not be found or its daemon settings are invalid.
+func NewDaemon(args DaemonArgs) (*Daemon, error) {
+	if args.Config == nil || args.Config.Workspaces == nil {
+		return nil, fmt.Errorf("no workspaces found in config")
+	}
+
+	d := &Daemon{
+		config:   args.Config,
+		save:     args.Save,
+		onEvent:  args.OnEvent,
+		statuses: make(map[string]*RepositoryStatus),
+	}
+
+	for i := range *args.Config.Workspaces {
+		workspace := &(*args.Config.Workspaces)[i]
+		if len(args.Workspaces) == 0 && workspace.Daemon != nil && workspace.Daemon.Disabled {
+			continue
+		}
+		if len(args.Workspaces) > 0 && !slices.Contains(args.Workspaces, workspace.Name) {
+			continue
+		}
+		if workspace.Daemon != nil {
+			if err := workspace.Daemon.Validate(); err != nil {
+				return nil, fmt.Errorf("workspace %s: %w", workspace.Name, err)
+			}
+		}
+		d.workspaces = append(d.workspaces, workspace)
+
+		if workspace.Repositories == nil {
+			continue
+		}
+		for _, repo := range *workspace.Repositories {
+			d.statuses[key(workspace.Name, repo.Name)] = &RepositoryStatus{
+				Workspace:  workspace.Name,
+				Repository: repo.Name,
+				Synced:     repo.Synced,
+			}
+		}
+	}
+
+	for _, name := range args.Workspaces {
+		if d.workspace(name) == nil {
+			return nil, fmt.Errorf("workspace %s not found", name)
+		}
+	}
+
+	return d, nil
+}
+
+// Run syncs every workspace immediately and then after every interval until
+// the context is cancelled. Syncs that would start during the quiet hours of
+// a workspace are skipped.
+//
+// Arguments:
+//   - ctx: The context, cancelling it stops the daemon.
+func (d *Daemon) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, workspace := range d.workspaces {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.loop(ctx, workspace)
+		}()
+	}
+	wg.Wait()
+}
+
+func (d *Daemon) loop(ctx context.Context, workspace *config.Workspace) {
+	for {
+		if workspace.Daemon.IsQuiet(time.Now()) {
+			multilog.Debug("daemon", "skipping sync during quiet hours", map[string]interface{}{
+				"workspace": workspace.Name,
+			})
+		} else {
+			d.sync(ctx, workspace)
+		}
+
+		delay := workspace.Daemon.GetInterval()
+		if workspace.Daemon != nil && workspace.Daemon.Jitter > 0 {
+			delay += rand.N(workspace.Daemon.Jitter)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// SyncWorkspace syncs the repositories of a workspace once, regardless of its quiet hours.
+//
+// Arguments:
+//   - ctx: The context, cancelling it aborts running fetches.
+//   - name: The name of the workspace.
+//
+// Returns:
+//   - []RepositoryStatus: The status of every repository of the workspace after the sync.
+//   - error: An error if the workspace is not synced by this daemon.
+func (d *Daemon) SyncWorkspace(ctx context.Context, name string) ([]RepositoryStatus, error) {
+	workspace := d.workspace(name)
+	if workspace == nil {
+		return nil, fmt.Errorf("workspace %s not found", name)
+	}
+	d.sync(ctx, workspace)
+
+	var statuses []RepositoryStatus
+	for _, status := range d.Status() {
+		if status.Workspace == name {
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses, nil
+}
+
+// Status returns the sync status of every repository, ordered by workspace and repository as configured.
+//
+// Returns:
+//   - []RepositoryStatus: The statuses.
+func (d *Daemon) Status() []RepositoryStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var statuses []RepositoryStatus
+	for _, workspace := range d.workspaces {
+		if workspace.Repositories == nil {
+			continue
+		}
+		for _, repo := range *workspace.Repositories {
+			if status, ok := d.statuses[key(workspace.Name, repo.Name)]; ok {
+				statuses = append(statuses, *status)
+			}
+		}
+	}
+	return statuses
+}
+
+func (d *Daemon) sync(ctx context.Context, workspace *config.Workspace) {
+	multilog.Debug("daemon", "syncing workspace", map[string]interface{}{
+		"workspace": workspace.Name,
+	})
+
+	// The sync times are written to the configured repositories while the
+	// sync runs, so it works on a copy of them.
+	d.mu.Lock()
+	repositories := slices.Clone(workspace.SelectRepositories(nil))
+	d.mu.Unlock()
+
+	workspaces.ExecuteContext(workspaces.ExecuteArgs{
+		Workspace:    workspace,
+		Repositories: repositories,
+		Parallelism:  workspace.Daemon.GetParallelism(),
+		Operation:    "sync",
+		Context:      ctx,
+	}, func(ctx context.Context, repo *config.Repository) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return d.syncRepository(ctx, workspace, repo)
+	})
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.config.Synced = time.Now()
+	if d.save && d.config.Path != "" {
+		if err := d.config.SaveConfig(); err != nil {
+			multilog.Error("daemon", "failed to save config", map[string]interface{}{
+				"workspace": workspace.Name,
+				"error":     err.Error(),
+			})
+		}
+	}
+}
+
+func (d *Daemon) syncRepository(ctx context.Context, workspace *config.Workspace, repo *config.Repository) error {
+	path := filepath.Join(workspace.GetAbsolutePath(), repo.Path)
+	event := Event{
+		Workspace:  workspace.Name,
+		Repository: repo.Name,
+	}
+
+	if _, err := os.Stat(filepath.Join(path, ".git")); err != nil {
+		event.Type = EventSkipped
+		event.Message = "repository is not cloned"
+		d.record(workspace, repo, "", nil, &event)
+		return nil
+	}
+
+	result, err := repositories.FastForward(ctx, repositories.FastForwardArgs{
+		Workspace:  workspace,
+		Repository: repo,
+		Operation:  "sync",
+	})
+	event.State = result.State
+	event.Before = result.Before
+	event.After = result.After
+	if err != nil {
+		event.Type = EventFailed
+		event.Message = err.Error()
+		d.record(workspace, repo, result.State, err, &event)
+		return err
+	}
+
+	switch result.State {
+	case git.FastForwardUpdated:
+		event.Type = EventUpdated
+		event.Message = fmt.Sprintf("fast-forwarded %s from %.7s to %.7s", result.Branch, result.Before, result.After)
+		d.record(workspace, repo, result.State, nil, &event)
+	case git.FastForwardUpToDate:
+		d.record(workspace, repo, result.State, nil, nil)
+	default:
+		event.Type = EventSkipped
+		event.Message = skipMessage(result, repo.Branch)
+		d.record(workspace, repo, result.State, nil, &event)
+	}
+	return nil
+}
+
+// record stores the outcome of syncing a repository and emits its event if there is one.
+func (d *Daemon) record(workspace *config.Workspace, repo *config.Repository, state git.FastForwardState, err error, event *Event) {
+	now := time.Now()
+
+	d.mu.Lock()
+	status, ok := d.statuses[key(workspace.Name, repo.Name)]
+	if !ok {
+		status = &RepositoryStatus{Workspace: workspace.Name, Repository: repo.Name}
+		d.statuses[key(workspace.Name, repo.Name)] = status
+	}
+	status.Checked = now
+	status.State = state
+	status.Error = ""
+	if err != nil {
+		status.Error = err.Error()
+	}
+	if state == git.FastForwardUpdated || state == git.FastForwardUpToDate {
+		status.Synced = now
+		if workspace.Repositories != nil {
+			for i := range *workspace.Repositories {
+				if (*workspace.Repositories)[i].Name == repo.Name {
+					(*workspace.Repositories)[i].Synced = now
+				}
+			}
+		}
+	}
+	d.mu.Unlock()
+
+	if event == nil {
+		return
+	}
+	event.Time = now
+
+	fields := map[string]interface{}{
+		"workspace":  event.Workspace,
+		"repository": event.Repository,
+		"message":    event.Message,
+	}
+	switch event.Type {
+	case EventFailed:
+		multilog.Error("daemon", "failed to sync repository", fields)
+	case EventSkipped:
+		multilog.Warn("daemon", "repository not updated", fields)
+	default:
+		multilog.Info("daemon", "repository updated", fields)
+	}
+
+	if d.onEvent != nil {
+		d.eventMu.Lock()
+		defer d.eventMu.Unlock()
+		d.onEvent(*event)
+	}
+}
+
+func (d *Daemon) workspace(name string) *config.Workspace {
+	for _, workspace := range d.workspaces {
+		if workspace.Name == name {
+			return workspace
+		}
+	}
+	return nil
+}
+
+func skipMessage(result git.FastForwardResult, branch string) string {
+	switch result.State {
+	case git.FastForwardDirty:
+		return "worktree has uncommitted changes"
+	case git.FastForwardDetached:
+		return "HEAD is detached"
+	case git.FastForwardWrongBranch:
+		return fmt.Sprintf("on branch %q but configured for %q", result.Branch, branch)
+	case git.FastForwardNoUpstream:
+		return fmt.Sprintf("branch %q has no remote branch", result.Branch)
+	case git.FastForwardDiverged:
+		return fmt.Sprintf("branch %q has diverged from its remote branch", result.Branch)
+	}
+	return string(result.State)
+}
+
+func key(workspace, repository string) string {
+	return workspace + "/" + repository
+}
@@ -0,0 +1,196 @@
+package daemon
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert"
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/git"
+	"github.com/polyrepopro/api/test"
+	"github.com/stretchr/testify/suite"
+)
+
+type DaemonSuite struct {
+	suite.Suite
+	upstream string
+	cfg      *config.Config
+	events   []Event
+}
+
+func TestDaemon(t *testing.T) {
+	suite.Run(t, new(DaemonSuite))
+}
+
+func (s *DaemonSuite) SetupTest() {
+	test.Setup()
+
+	base := s.T().TempDir()
+	s.upstream = filepath.Join(base, "upstream")
+	s.git("", "init", "-q", "-b", "main", s.upstream)
+	s.commit("README.md", "one")
+	s.git(s.upstream, "branch", "stable")
+
+	workspace := filepath.Join(base, "workspace")
+	for _, name := range []string{"clean", "dirty", "feature"} {
+		s.git("", "clone", "-q", s.upstream, filepath.Join(workspace, name))
+	}
+	s.git(filepath.Join(workspace, "feature"), "checkout", "-q", "-b", "feature")
+	assert.NoError(s.T(), os.WriteFile(filepath.Join(workspace, "dirty", "README.md"), []byte("local"), 0644))
+
+	s.events = nil
+	s.cfg = &config.Config{
+		Path: filepath.Join(base, "polyrepo.yaml"),
+		Workspaces: &[]config.Workspace{
+			{
+				Name: "test",
+				Path: workspace,
+				Repositories: &[]config.Repository{
+					{Name: "clean", URL: s.upstream, Path: "clean", Branch: "main"},
+					{Name: "dirty", URL: s.upstream, Path: "dirty"},
+					{Name: "feature", URL: s.upstream, Path: "feature", Branch: "main"},
+					{Name: "missing", URL: s.upstream, Path: "missing"},
+				},
+			},
+			{
+				Name:   "disabled",
+				Path:   filepath.Join(base, "disabled"),
+				Daemon: &config.Daemon{Disabled: true},
+			},
+		},
+	}
+}
+
+func (s *DaemonSuite) git(dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com", "GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+	out, err := cmd.CombinedOutput()
+	assert.NoError(s.T(), err, string(out))
+	return strings.TrimSpace(string(out))
+}
+
+func (s *DaemonSuite) commit(file, content string) string {
+	assert.NoError(s.T(), os.WriteFile(filepath.Join(s.upstream, file), []byte(content), 0644))
+	s.git(s.upstream, "add", file)
+	s.git(s.upstream, "commit", "-q", "-m", content)
+	return s.git(s.upstream, "rev-parse", "HEAD")
+}
+
+func (s *DaemonSuite) daemon() *Daemon {
+	d, err := NewDaemon(DaemonArgs{
+		Config:  s.cfg,
+		Save:    true,
+		OnEvent: func(event Event) { s.events = append(s.events, event) },
+	})
+	assert.NoError(s.T(), err)
+	return d
+}
+
+func (s *DaemonSuite) event(repository string) Event {
+	for _, event := range s.events {
+		if event.Repository == repository {
+			return event
+		}
+	}
+	return Event{}
+}
+
+func (s *DaemonSuite) Test1SyncWorkspace() {
+	head := s.commit("CHANGELOG.md", "two")
+	d := s.daemon()
+
+	statuses, err := d.SyncWorkspace(context.Background(), "test")
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), 4, len(statuses))
+
+	clean := filepath.Join((*s.cfg.Workspaces)[0].Path, "clean")
+	assert.Equal(s.T(), head, s.git(clean, "rev-parse", "HEAD"))
+	_, err = os.Stat(filepath.Join(clean, "CHANGELOG.md"))
+	assert.NoError(s.T(), err)
+	s.git(clean, "fsck", "--no-progress")
+	// Only the remote branch the fetch updated is moved out of packed-refs.
+	_, err = os.Stat(filepath.Join(clean, ".git", "refs", "remotes", "origin", "main"))
+	assert.NoError(s.T(), err)
+	_, err = os.Stat(filepath.Join(clean, ".git", "refs", "remotes", "origin", "stable"))
+	assert.True(s.T(), os.IsNotExist(err))
+
+	assert.Equal(s.T(), EventUpdated, s.event("clean").Type)
+	assert.Equal(s.T(), head, s.event("clean").After)
+	assert.Equal(s.T(), git.FastForwardDirty, s.event("dirty").State)
+	assert.Equal(s.T(), git.FastForwardWrongBranch, s.event("feature").State)
+	assert.Equal(s.T(), EventSkipped, s.event("missing").Type)
+
+	assert.Equal(s.T(), git.FastForwardUpdated, statuses[0].State)
+	assert.False(s.T(), statuses[0].Synced.IsZero())
+	assert.True(s.T(), statuses[1].Synced.IsZero())
+	assert.False(s.T(), (*(*s.cfg.Workspaces)[0].Repositories)[0].Synced.IsZero())
+
+	// The sync times are written back to the config.
+	saved, err := os.ReadFile(s.cfg.Path)
+	assert.NoError(s.T(), err)
+	assert.Contains(s.T(), string(saved), "synced:")
+
+	// A second sync finds the clean repository up to date and does not report it.
+	s.events = nil
+	statuses, err = d.SyncWorkspace(context.Background(), "test")
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), git.FastForwardUpToDate, statuses[0].State)
+	assert.Equal(s.T(), "", string(s.event("clean").Type))
+}
+
+func (s *DaemonSuite) Test2Diverged() {
+	clean := filepath.Join((*s.cfg.Workspaces)[0].Path, "clean")
+	assert.NoError(s.T(), os.WriteFile(filepath.Join(clean, "local.txt"), []byte("local"), 0644))
+	s.git(clean, "add", "local.txt")
+	s.git(clean, "commit", "-q", "-m", "local")
+	before := s.git(clean, "rev-parse", "HEAD")
+	s.commit("CHANGELOG.md", "two")
+
+	_, err := s.daemon().SyncWorkspace(context.Background(), "test")
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), git.FastForwardDiverged, s.event("clean").State)
+	assert.Equal(s.T(), before, s.git(clean, "rev-parse", "HEAD"))
+}
+
+func (s *DaemonSuite) Test3FetchFailure() {
+	assert.NoError(s.T(), os.RemoveAll(s.upstream))
+
+	statuses, err := s.daemon().SyncWorkspace(context.Background(), "test")
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), EventFailed, s.event("clean").Type)
+	assert.NotEqual(s.T(), "", statuses[0].Error)
+}
+
+func (s *DaemonSuite) Test4Run() {
+	(*s.cfg.Workspaces)[0].Daemon = &config.Daemon{Interval: 50 * time.Millisecond}
+	d := s.daemon()
+
+	_, err := d.SyncWorkspace(context.Background(), "disabled")
+	assert.Error(s.T(), err)
+
+	head := s.commit("CHANGELOG.md", "two")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.Run(ctx)
+		close(done)
+	}()
+
+	clean := filepath.Join((*s.cfg.Workspaces)[0].Path, "clean")
+	s.Eventually(func() bool {
+		return d.Status()[0].State == git.FastForwardUpdated
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(s.T(), head, s.git(clean, "rev-parse", "HEAD"))
+
+	cancel()
+	<-done
+
+	_, err = NewDaemon(DaemonArgs{Config: s.cfg, Workspaces: []string{"unknown"}})
+	assert.Error(s.T(), err)
+}
@@ -0,0 +1,175 @@
+// Package events publishes what polyrepo operations are doing as typed events
+// that callers can subscribe to, for example to drive a live UI.
+//
+// Operations publish to the Default bus, subscribe to it with Subscribe.
+package events
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Type is the type of an event.
+type Type string
+
+const (
+	// OperationStarted is published when an operation starts, for the workspace
+	// as a whole (without a repository) and for each repository.
+	OperationStarted Type = "operation.started"
+	// OperationProgress is published with the phase and percentage reported by git while cloning, fetching, pulling or pushing,
+	// and with the state a sync or pull left the repository in.
+	OperationProgress Type = "operation.progress"
+	// OperationFinished is published when an operation finished, with the error if it failed.
+	OperationFinished Type = "operation.finished"
+	// HookOutput is published for every line of output of a hook command, with secret values masked.
+	HookOutput Type = "hook.output"
+	// RunnerState is published when a supervised runner changes status or becomes ready.
+	RunnerState Type = "runner.state"
+)
+
+// Event is something that happened during an operation. Fields that do not
+// apply to the type of the event are left empty.
+type Event struct {
+	// ID increases with every event published on a bus.
+	ID   uint64    `json:"id"`
+	Time time.Time `json:"time"`
+	Type Type      `json:"type"`
+	// Operation is the operation, such as "pull", or the type of the hook for HookOutput.
+	Operation  string `json:"operation,omitempty"`
+	Workspace  string `json:"workspace,omitempty"`
+	Repository string `json:"repository,omitempty"`
+	// Runner is the runner name in the form "repository/runner".
+	Runner string `json:"runner,omitempty"`
+	// Phase is the git progress phase, such as "Receiving objects".
+	Phase   string `json:"phase,omitempty"`
+	Percent int    `json:"percent,omitempty"`
+	// Bytes is the number of bytes an operation received, reported once it completed.
+	Bytes int64 `json:"bytes,omitempty"`
+	// State is the state a sync or pull left a repository in, such as "updated"
+	// or "diverged", see git.FastForwardState.
+	State string `json:"state,omitempty"`
+	// Status is the status of a runner.
+	Status string `json:"status,omitempty"`
+	Ready  bool   `json:"ready,omitempty"`
+	// Restarts is the number of times a runner was restarted.
+	Restarts int `json:"restarts,omitempty"`
+	// Message is the progress text or the output line.
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// DefaultBuffer is the number of events buffered for a subscriber when none is set.
+const DefaultBuffer = 256
+
+// Bus delivers published events to its subscribers. Publishing never blocks,
+// a subscriber that does not keep up misses the events that do not fit its buffer.
+// It is safe for concurrent use.
+type Bus struct {
+	id atomic.Uint64
+
+	mu   sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+// Subscription receives the events of a bus.
+type Subscription struct {
+	// C receives the events, it is closed by Close.
+	C <-chan Event
+
+	bus     *Bus
+	c       chan Event
+	types   []Type
+	once    sync.Once
+	dropped atomic.Uint64
+}
+
+// NewBus creates an event bus.
+//
+// Returns:
+//   - *Bus: The bus.
+func NewBus() *Bus {
+	return &Bus{subs: make(map[*Subscription]struct{})}
+}
+
+// Default is the bus operations publish their events to.
+var Default = NewBus()
+
+// Publish sends an event to every subscriber of the Default bus.
+func Publish(event Event) {
+	Default.Publish(event)
+}
+
+// Subscribe subscribes to the Default bus.
+//
+// Arguments:
+//   - buffer: The number of events buffered, zero uses DefaultBuffer.
+//   - types: The types of events to receive, none receives every event.
+//
+// Returns:
+//   - *Subscription: The subscription, it must be closed when no longer needed.
+func Subscribe(buffer int, types ...Type) *Subscription {
+	return Default.Subscribe(buffer, types...)
+}
+
+// Publish sends an event to every subscriber, setting its ID and, if unset, its time.
+//
+// Arguments:
+//   - event: The event.
+func (b *Bus) Publish(event Event) {
+	event.ID = b.id.Add(1)
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subs {
+		if len(sub.types) > 0 && !slices.Contains(sub.types, event.Type) {
+			continue
+		}
+		select {
+		case sub.c <- event:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// Subscribe returns a subscription to the events published from now on.
+//
+// Arguments:
+//   - buffer: The number of events buffered, zero uses DefaultBuffer.
+//   - types: The types of events to receive, none receives every event.
+//
+// Returns:
+//   - *Subscription: The subscription, it must be closed when no longer needed.
+func (b *Bus) Subscribe(buffer int, types ...Type) *Subscription {
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+	c := make(chan Event, buffer)
+	sub := &Subscription{C: c, bus: b, c: c, types: types}
+
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub
+}
+
+// Close unsubscribes and closes C, it is safe to call more than once.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		delete(s.bus.subs, s)
+		s.bus.mu.Unlock()
+		close(s.c)
+	})
+}
+
+// Dropped returns the number of events that were not delivered because the buffer was full.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
@@ -0,0 +1,65 @@
+package events
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestBus(t *testing.T) {
+	bus := NewBus()
+	all := bus.Subscribe(0)
+	runners := bus.Subscribe(1, RunnerState)
+
+	bus.Publish(Event{Type: OperationStarted, Operation: "pull"})
+	bus.Publish(Event{Type: RunnerState, Runner: "api/server", Status: "running"})
+	bus.Publish(Event{Type: RunnerState, Runner: "api/server", Status: "exited"})
+
+	started := <-all.C
+	assert.Equal(t, uint64(1), started.ID)
+	assert.Equal(t, OperationStarted, started.Type)
+	assert.False(t, started.Time.IsZero())
+	assert.Equal(t, RunnerState, (<-all.C).Type)
+
+	// The second runner event did not fit the buffer of one.
+	assert.Equal(t, "running", (<-runners.C).Status)
+	assert.Equal(t, uint64(1), runners.Dropped())
+
+	runners.Close()
+	runners.Close()
+	_, ok := <-runners.C
+	assert.False(t, ok)
+	bus.Publish(Event{Type: RunnerState})
+	assert.Equal(t, 2, len(all.C))
+	all.Close()
+}
+
+func TestProgress(t *testing.T) {
+	bus := NewBus()
+	sub := bus.Subscribe(0)
+	defer sub.Close()
+
+	progress := bus.NewProgress("clone", "test", "api")
+	fmt.Fprint(progress, "Enumerating objects: 20, done.\nCounting objects:   5% (1/20)\rCounting objects:   5% (1/20)\r")
+	fmt.Fprint(progress, "Counting objects: 100% (20/20), done.\nReceiving obj")
+	fmt.Fprint(progress, "ects:  50% (10/20)\r")
+
+	var received []Event
+	for len(sub.C) > 0 {
+		received = append(received, <-sub.C)
+	}
+	assert.Equal(t, 4, len(received))
+	assert.Equal(t, "Enumerating objects: 20, done.", received[0].Message)
+	assert.Equal(t, "", received[0].Phase)
+	assert.Equal(t, "Counting objects", received[1].Phase)
+	assert.Equal(t, 5, received[1].Percent)
+	assert.Equal(t, 100, received[2].Percent)
+	assert.Equal(t, "Receiving objects", received[3].Phase)
+	assert.Equal(t, 50, received[3].Percent)
+	for _, event := range received {
+		assert.Equal(t, OperationProgress, event.Type)
+		assert.Equal(t, "clone", event.Operation)
+		assert.Equal(t, "api", event.Repository)
+	}
+}
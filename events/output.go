@@ -0,0 +1,32 @@
+package events
+
+import "strings"
+
+// Output is a writer that publishes every line written to it as an event.
+// Each write must hold complete lines, a trailing line without a newline is
+// published as it is.
+type Output struct {
+	bus      *Bus
+	template Event
+}
+
+// NewOutput creates an output writer publishing to the Default bus.
+//
+// Arguments:
+//   - template: The event published for every line, with the line as its Message.
+//
+// Returns:
+//   - *Output: The writer.
+func NewOutput(template Event) *Output {
+	return &Output{bus: Default, template: template}
+}
+
+// Write publishes every line in p.
+func (o *Output) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimSuffix(string(p), "\n"), "\n") {
+		event := o.template
+		event.Message = strings.TrimSuffix(line, "\r")
+		o.bus.Publish(event)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,117 @@
+package events
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// progressPattern matches git progress lines such as "Receiving objects:  45% (9/20)".
+var progressPattern = regexp.MustCompile(`^(?:remote:\s*)?([A-Za-z][A-Za-z ]*?):\s+(\d{1,3})%`)
+
+// Progress is a writer for git progress output that publishes every update
+// as an OperationProgress event.
+type Progress struct {
+	bus        *Bus
+	operation  string
+	workspace  string
+	repository string
+
+	mu      sync.Mutex
+	buf     []byte
+	phase   string
+	percent int
+}
+
+// NewProgress creates a progress writer publishing to the Default bus.
+//
+// Arguments:
+//   - operation: The operation, such as "clone".
+//   - workspace: The name of the workspace.
+//   - repository: The name of the repository.
+//
+// Returns:
+//   - *Progress: The writer, pass it as the Progress of a git operation.
+func NewProgress(operation string, workspace string, repository string) *Progress {
+	return Default.NewProgress(operation, workspace, repository)
+}
+
+// NewProgress creates a progress writer publishing to the bus.
+//
+// Arguments:
+//   - operation: The operation, such as "clone".
+//   - workspace: The name of the workspace.
+//   - repository: The name of the repository.
+//
+// Returns:
+//   - *Progress: The writer, pass it as the Progress of a git operation.
+func (b *Bus) NewProgress(operation string, workspace string, repository string) *Progress {
+	return &Progress{bus: b, operation: operation, workspace: workspace, repository: repository, percent: -1}
+}
+
+// Write publishes every complete progress line. Git rewrites a line in place
+// by ending it with a carriage return, so both "\r" and "\n" end a line.
+func (p *Progress) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexAny(p.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		p.publish(strings.TrimSpace(string(p.buf[:i])))
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// Transferred publishes the number of bytes received by the operation.
+func (p *Progress) Transferred(bytes int64) {
+	p.bus.Publish(Event{
+		Type:       OperationProgress,
+		Operation:  p.operation,
+		Workspace:  p.workspace,
+		Repository: p.repository,
+		Bytes:      bytes,
+	})
+}
+
+// State publishes the state the operation left the repository in, such as "updated".
+func (p *Progress) State(state string) {
+	p.bus.Publish(Event{
+		Type:       OperationProgress,
+		Operation:  p.operation,
+		Workspace:  p.workspace,
+		Repository: p.repository,
+		State:      state,
+	})
+}
+
+func (p *Progress) publish(line string) {
+	if line == "" {
+		return
+	}
+
+	event := Event{
+		Type:       OperationProgress,
+		Operation:  p.operation,
+		Workspace:  p.workspace,
+		Repository: p.repository,
+		Message:    line,
+	}
+	if match := progressPattern.FindStringSubmatch(line); match != nil {
+		percent, _ := strconv.Atoi(match[2])
+		// Git reports most phases many times per percent, only changes are published.
+		if match[1] == p.phase && percent == p.percent {
+			return
+		}
+		p.phase, p.percent = match[1], percent
+		event.Phase = match[1]
+		event.Percent = percent
+	}
+	p.bus.Publish(event)
+}
@@ -60,7 +60,7 @@ func getCredentialsFromHelper(url string) (username, password string, err error)
 func GetAuth(url string, auth *config.Auth) transport.AuthMethod {
 	if auth == nil {
 		protocol := urls.GetProtocol(url)
-		multilog.Debug("GetAuth", "protocol detection", map[string]interface{}{
+		multilog.Debug("git.auth", "protocol detection", map[string]interface{}{
 			"url":      url,
 			"protocol": protocol,
 		})
@@ -73,7 +73,7 @@ func GetAuth(url string, auth *config.Auth) transport.AuthMethod {
 					// Default SSH key exists, use it
 					sshAuth, err := ssh.NewPublicKeysFromFile("git", defaultSSHKey, "")
 					if err != nil {
-						multilog.Debug("git.getauth", "failed to create SSH auth with default key", map[string]interface{}{
+						multilog.Debug("git.auth", "failed to create SSH auth with default key", map[string]interface{}{
 							"error": err.Error(),
 							"key":   defaultSSHKey,
 						})
@@ -83,7 +83,7 @@ func GetAuth(url string, auth *config.Auth) transport.AuthMethod {
 					// Set up host key callback to accept any host key (less secure but more compatible)
 					sshAuth.HostKeyCallback = gossh.InsecureIgnoreHostKey()
 
-					multilog.Debug("GetAuth", "using SSH key file", map[string]interface{}{
+					multilog.Debug("git.auth", "using SSH key file", map[string]interface{}{
 						"publicKey": defaultSSHKey,
 						"url":       url,
 					})
@@ -95,7 +95,7 @@ func GetAuth(url string, auth *config.Auth) transport.AuthMethod {
 			// Try Git credential helpers for HTTPS URLs
 			username, password, err := getCredentialsFromHelper(url)
 			if err == nil {
-				multilog.Debug("GetAuth", "using credential helper", map[string]interface{}{
+				multilog.Debug("git.auth", "using credential helper", map[string]interface{}{
 					"url":      url,
 					"username": username,
 				})
@@ -105,7 +105,7 @@ func GetAuth(url string, auth *config.Auth) transport.AuthMethod {
 				}
 			}
 			
-			multilog.Debug("GetAuth", "credential helper failed", map[string]interface{}{
+			multilog.Debug("git.auth", "credential helper failed", map[string]interface{}{
 				"url":   url,
 				"error": err.Error(),
 			})
@@ -114,14 +114,14 @@ func GetAuth(url string, auth *config.Auth) transport.AuthMethod {
 		// Try SSH agent as fallback
 		sshAuth, err := ssh.NewSSHAgentAuth("git")
 		if err == nil {
-			multilog.Debug("GetAuth", "using SSH agent as fallback", map[string]interface{}{
+			multilog.Debug("git.auth", "using SSH agent as fallback", map[string]interface{}{
 				"url": url,
 			})
 			return sshAuth
 		}
 
 		// No valid SSH keys found
-		multilog.Debug("git.getauth", "no auth provided and no valid SSH keys or agent found", map[string]interface{}{
+		multilog.Debug("git.auth", "no auth provided and no valid SSH keys or agent found", map[string]interface{}{
 			"keys":        defaultKeys,
 			"agent_error": err.Error(),
 		})
@@ -139,14 +139,14 @@ func GetAuth(url string, auth *config.Auth) transport.AuthMethod {
 		// Set up host key callback to accept any host key (less secure but more compatible)
 		sshAuth.HostKeyCallback = gossh.InsecureIgnoreHostKey()
 
-		multilog.Debug("GetAuth", "using provided SSH key", map[string]interface{}{
+		multilog.Debug("git.auth", "using provided SSH key", map[string]interface{}{
 			"publicKey": auth.Key,
 			"url":       url,
 		})
 
 		return sshAuth
 	} else if auth != nil && auth.Env.Username != "" && auth.Env.Password != "" {
-		multilog.Debug("GetAuth", "using HTTP auth", map[string]interface{}{
+		multilog.Debug("git.auth", "using HTTP auth", map[string]interface{}{
 			"username": auth.Env.Username,
 			"password": auth.Env.Password,
 			"url":      url,
@@ -158,7 +158,7 @@ func GetAuth(url string, auth *config.Auth) transport.AuthMethod {
 		}
 	}
 
-	multilog.Debug("git.getauth", "no auth could be found", map[string]interface{}{
+	multilog.Debug("git.auth", "no auth could be found", map[string]interface{}{
 		"url": url,
 	})
 	return nil
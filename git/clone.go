@@ -1,6 +1,9 @@
 package git
 
 import (
+	"context"
+	"io"
+
 	"github.com/go-git/go-billy/v5/memfs"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/storage/memory"
@@ -12,19 +15,29 @@ type CloneArgs struct {
 	URL  string
 	Path string
 	Auth *config.Auth
+	// Progress receives the progress output of git, when set.
+	Progress io.Writer
+	// Context carries the trace the clone is part of and cancels it, nil uses context.Background().
+	Context context.Context
 }
 
-type progress struct{}
+type progress struct {
+	w io.Writer
+}
 
 func (h *progress) Write(p []byte) (n int, err error) {
-	multilog.Info("git.clone", "cloning progress", map[string]interface{}{
+	multilog.Debug("git.clone", "cloning progress", map[string]interface{}{
 		"message": string(p),
 	})
+	if h.w != nil {
+		h.w.Write(p)
+	}
 	return len(p), nil
 }
 
-func Clone(args CloneArgs) error {
-	var err error
+func Clone(args CloneArgs) (err error) {
+	ctx, span := startSpan(args.Context, "git.clone", args.Path)
+	defer func() { endSpan(span, err) }()
 
 	multilog.Info("git.clone", "cloning repository", map[string]interface{}{
 		"url":  args.URL,
@@ -32,12 +45,12 @@ func Clone(args CloneArgs) error {
 	})
 
 	opts := &git.CloneOptions{
-		URL: args.URL,
-		// Progress:          &progress{},
+		URL:               args.URL,
+		Progress:          &progress{w: args.Progress},
 		RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
 	}
 
-	auth := GetAuth(args.URL, args.Auth)
+	auth := getAuth(ctx, args.URL, args.Auth)
 	if auth != nil && auth.Name() != "" {
 		opts.Auth = auth
 	}
@@ -50,7 +63,7 @@ func Clone(args CloneArgs) error {
 		storer := memory.NewStorage()
 		fs := memfs.New()
 
-		_, err := git.Clone(storer, fs, &git.CloneOptions{
+		_, err := git.CloneContext(ctx, storer, fs, &git.CloneOptions{
 			URL:   args.URL,
 			Auth:  auth,
 			Depth: 1,
@@ -69,7 +82,7 @@ func Clone(args CloneArgs) error {
 		})
 	}
 
-	_, err = git.PlainClone(args.Path, false, opts)
+	_, err = git.PlainCloneContext(ctx, args.Path, false, opts)
 	if err != nil {
 		multilog.Error("git.clone", "failed to clone repository", map[string]interface{}{
 			"url":   args.URL,
@@ -78,6 +91,7 @@ func Clone(args CloneArgs) error {
 		})
 		return err
 	}
+	reportTransfer(args.Progress, args.Path, 0)
 
 	return nil
 }
@@ -97,10 +97,10 @@ func GetGitUser(path string) (*object.Signature, error) {
 }
 
 // AddGitignoreToWorktree parses and adds gitignore patterns to the worktree excludes.
+// Paths without a .gitignore file are skipped, as are blank lines and comments.
 //
 // Arguments:
-// - wt: the git worktree instance
-// - path: the repository path containing the .gitignore file
+// - paths: the directories containing the .gitignore files
 //
 // Returns:
 // - []gitignore.Pattern: the parsed gitignore patterns
@@ -110,22 +110,25 @@ func AddGitignoreToWorktree(paths ...string) ([]gitignore.Pattern, error) {
 
 	for _, path := range paths {
 		if !files.FileExists(filepath.Join(path, ".gitignore")) {
-			return nil, nil
+			continue
 		}
 
 		f, err := os.Open(filepath.Join(path, ".gitignore"))
 		if err != nil {
 			return nil, fmt.Errorf("failed to read .gitignore: %w", err)
 		}
-		defer f.Close()
 
 		fileScanner := bufio.NewScanner(f)
 		fileScanner.Split(bufio.ScanLines)
 
 		for fileScanner.Scan() {
-			patterns = append(patterns, gitignore.ParsePattern(fileScanner.Text(), nil))
+			line := fileScanner.Text()
+			if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+				continue
+			}
+			patterns = append(patterns, gitignore.ParsePattern(line, nil))
 		}
-
+		f.Close()
 	}
 
 	return patterns, nil
@@ -0,0 +1,255 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/mateothegreat/go-multilog/multilog"
+	"github.com/polyrepopro/api/config"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// FetchArgs are the arguments for fetching a remote.
+type FetchArgs struct {
+	URL    string
+	Remote string
+	Path   string
+	Auth   *config.Auth
+	// Progress receives the progress output of git, when set.
+	Progress io.Writer
+}
+
+// Fetch fetches the branches and tags of a remote without touching the worktree.
+//
+// Arguments:
+// - ctx: the context, cancelling it aborts the fetch
+// - args: the fetch arguments
+//
+// Returns:
+// - error: any error encountered while fetching, an up to date remote is not an error
+func Fetch(ctx context.Context, args FetchArgs) (err error) {
+	ctx, span := startSpan(ctx, "git.fetch", args.Path)
+	defer func() { endSpan(span, err) }()
+
+	repo, err := git.PlainOpen(args.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	opts := &git.FetchOptions{
+		RemoteName: args.Remote,
+		Progress:   args.Progress,
+	}
+
+	auth := getAuth(ctx, args.URL, args.Auth)
+	if auth != nil && auth.Name() != "" {
+		opts.Auth = auth
+	}
+
+	multilog.Debug("git.fetch", "fetching", map[string]interface{}{
+		"url":    args.URL,
+		"remote": args.Remote,
+		"path":   args.Path,
+	})
+
+	if err := unpackUpdatedReferences(ctx, repo, args.Remote, opts.Auth); err != nil {
+		return err
+	}
+
+	before := packSize(args.Path)
+	err = repo.FetchContext(ctx, opts)
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return fmt.Errorf("failed to fetch remote %q: %w", args.Remote, err)
+	}
+	reportTransfer(args.Progress, args.Path, before)
+
+	return nil
+}
+
+// unpackUpdatedReferences works around the filesystem storage of go-git, which
+// updates a reference by truncating its loose file after checking that the file
+// still holds the old hash (dotgit.checkReferenceAndTruncate). A remote branch
+// that only exists in packed-refs, as in repositories cloned with the git
+// command line, has no loose file, so a fetch that updates it reads an empty
+// file, fails with "reference has changed concurrently" and leaves the empty
+// file behind. The packed remote branches the fetch is about to update are
+// written as loose references first, every other reference is left alone.
+func unpackUpdatedReferences(ctx context.Context, repo *git.Repository, name string, auth transport.AuthMethod) error {
+	storage, ok := repo.Storer.(*filesystem.Storage)
+	if !ok {
+		return nil
+	}
+	remote, err := repo.Remote(name)
+	if err != nil {
+		return fmt.Errorf("failed to get remote %q: %w", name, err)
+	}
+	advertised, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list remote %q: %w", name, err)
+	}
+
+	for _, ref := range advertised {
+		if ref.Type() != plumbing.HashReference {
+			continue
+		}
+		for _, spec := range remote.Config().Fetch {
+			if !spec.Match(ref.Name()) {
+				continue
+			}
+			local, err := repo.Reference(spec.Dst(ref.Name()), false)
+			if err != nil || local.Hash() == ref.Hash() {
+				// New branches are created and unchanged branches are not written by the fetch.
+				continue
+			}
+			if _, err := storage.Filesystem().Stat(local.Name().String()); err == nil {
+				continue
+			}
+			if err := storage.SetReference(local); err != nil {
+				return fmt.Errorf("failed to write reference %s: %w", local.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// FastForwardState is the outcome of a fast-forward.
+type FastForwardState string
+
+const (
+	// FastForwardUpdated means the branch was moved to the remote branch.
+	FastForwardUpdated FastForwardState = "updated"
+	// FastForwardUpToDate means the branch already contains the remote branch.
+	FastForwardUpToDate FastForwardState = "up-to-date"
+	// FastForwardDirty means the worktree has changes and was left alone.
+	FastForwardDirty FastForwardState = "dirty"
+	// FastForwardDetached means HEAD is not on a branch.
+	FastForwardDetached FastForwardState = "detached"
+	// FastForwardWrongBranch means another branch than the expected one is checked out.
+	FastForwardWrongBranch FastForwardState = "wrong-branch"
+	// FastForwardNoUpstream means the remote has no branch of the same name.
+	FastForwardNoUpstream FastForwardState = "no-upstream"
+	// FastForwardDiverged means the branch and the remote branch both have commits the other lacks.
+	FastForwardDiverged FastForwardState = "diverged"
+)
+
+// FastForwardArgs are the arguments for fast-forwarding a branch.
+type FastForwardArgs struct {
+	Path   string
+	Remote string
+	// Branch is the branch that must be checked out, empty accepts any branch.
+	Branch string
+	// Context carries the trace the fast-forward is part of, nil starts a new trace.
+	Context context.Context
+}
+
+// FastForwardResult describes what a fast-forward did.
+type FastForwardResult struct {
+	State  FastForwardState
+	Branch string
+	// Before and After are the commit hashes of the branch before and after the fast-forward.
+	Before string
+	After  string
+}
+
+// FastForward moves the checked out branch to its already fetched remote
+// branch when that is possible without a merge and the worktree is clean.
+// A repository that cannot be fast-forwarded is left untouched and the reason
+// is returned as the state.
+//
+// Arguments:
+// - args: the fast-forward arguments
+//
+// Returns:
+// - FastForwardResult: the outcome of the fast-forward
+// - error: any error encountered while reading or updating the repository
+func FastForward(args FastForwardArgs) (FastForwardResult, error) {
+	_, span := startSpan(args.Context, "git.fast-forward", args.Path)
+	result, err := fastForward(args)
+	span.SetAttributes(attribute.String("git.fast-forward.state", string(result.State)))
+	endSpan(span, err)
+	return result, err
+}
+
+func fastForward(args FastForwardArgs) (FastForwardResult, error) {
+	repo, err := git.PlainOpen(args.Path)
+	if err != nil {
+		return FastForwardResult{}, fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return FastForwardResult{}, fmt.Errorf("failed to get HEAD: %w", err)
+	}
+	result := FastForwardResult{Before: head.Hash().String(), After: head.Hash().String()}
+	if !head.Name().IsBranch() {
+		result.State = FastForwardDetached
+		return result, nil
+	}
+	result.Branch = head.Name().Short()
+	if args.Branch != "" && result.Branch != args.Branch {
+		result.State = FastForwardWrongBranch
+		return result, nil
+	}
+
+	remote, err := repo.Reference(plumbing.NewRemoteReferenceName(args.Remote, result.Branch), true)
+	if err != nil {
+		result.State = FastForwardNoUpstream
+		return result, nil
+	}
+	if remote.Hash() == head.Hash() {
+		result.State = FastForwardUpToDate
+		return result, nil
+	}
+
+	local, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return result, fmt.Errorf("failed to read commit %s: %w", head.Hash(), err)
+	}
+	upstream, err := repo.CommitObject(remote.Hash())
+	if err != nil {
+		return result, fmt.Errorf("failed to read commit %s: %w", remote.Hash(), err)
+	}
+	if ahead, err := upstream.IsAncestor(local); err != nil {
+		return result, fmt.Errorf("failed to compare commits: %w", err)
+	} else if ahead {
+		result.State = FastForwardUpToDate
+		return result, nil
+	}
+	if behind, err := local.IsAncestor(upstream); err != nil {
+		return result, fmt.Errorf("failed to compare commits: %w", err)
+	} else if !behind {
+		result.State = FastForwardDiverged
+		return result, nil
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return result, fmt.Errorf("failed to get worktree: %w", err)
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		return result, fmt.Errorf("failed to get worktree status: %w", err)
+	}
+	if !status.IsClean() {
+		result.State = FastForwardDirty
+		return result, nil
+	}
+
+	// The worktree is clean and the remote branch descends from HEAD, so a
+	// hard reset is a fast-forward of the branch, index and files.
+	if err := worktree.Reset(&git.ResetOptions{Commit: remote.Hash(), Mode: git.HardReset}); err != nil {
+		return result, fmt.Errorf("failed to fast-forward %s: %w", result.Branch, err)
+	}
+	result.State = FastForwardUpdated
+	result.After = remote.Hash().String()
+	return result, nil
+}
@@ -0,0 +1,48 @@
+package git
+
+import (
+	"fmt"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/mateothegreat/go-util/files"
+)
+
+// Head returns the hash of the commit HEAD points at.
+//
+// Arguments:
+// - path: the path to the repository
+//
+// Returns:
+// - string: the hash of the HEAD commit
+// - error: any error encountered while opening the repository or resolving HEAD
+func Head(path string) (string, error) {
+	_, commit, err := HeadRef(path)
+	return commit, err
+}
+
+// HeadRef returns the branch HEAD is on and the hash of the commit it points at.
+//
+// Arguments:
+// - path: the path to the repository
+//
+// Returns:
+// - string: the name of the branch, empty when HEAD is detached
+// - string: the hash of the HEAD commit
+// - error: any error encountered while opening the repository or resolving HEAD
+func HeadRef(path string) (string, string, error) {
+	repo, err := git.PlainOpen(files.ExpandPath(path))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get HEAD: %w", err)
+	}
+
+	branch := ""
+	if head.Name().IsBranch() {
+		branch = head.Name().Short()
+	}
+	return branch, head.Hash().String(), nil
+}
@@ -1,7 +1,9 @@
 package git
 
 import (
+	"context"
 	"fmt"
+	"io"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/mateothegreat/go-multilog/multilog"
@@ -13,18 +15,30 @@ type PullArgs struct {
 	Remote string
 	Path   string
 	Auth   *config.Auth
+	// Progress receives the progress output of git, when set.
+	Progress io.Writer
+	// Context carries the trace the pull is part of and cancels it, nil uses context.Background().
+	Context context.Context
 }
 
-type pullProgress struct{}
+type pullProgress struct {
+	w io.Writer
+}
 
 func (h *pullProgress) Write(p []byte) (n int, err error) {
 	multilog.Debug("git.pull", "pulling progress", map[string]interface{}{
 		"message": string(p),
 	})
+	if h.w != nil {
+		h.w.Write(p)
+	}
 	return len(p), nil
 }
 
-func Pull(args PullArgs) error {
+func Pull(args PullArgs) (err error) {
+	ctx, span := startSpan(args.Context, "git.pull", args.Path)
+	defer func() { endSpan(span, err) }()
+
 	repo, err := git.PlainOpen(args.Path)
 	if err != nil {
 		return fmt.Errorf("failed to open repository: %w", err)
@@ -38,8 +52,8 @@ func Pull(args PullArgs) error {
 	opts := &git.PullOptions{
 		RemoteName:        args.Remote,
 		RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
-		// Progress:          &pullProgress{},
-		Force: true, // Allow non-fast-forward updates
+		Progress:          &pullProgress{w: args.Progress},
+		Force:             true, // Allow non-fast-forward updates
 	}
 
 	multilog.Debug("git.pull", "pulling", map[string]interface{}{
@@ -48,15 +62,17 @@ func Pull(args PullArgs) error {
 		"path":   args.Path,
 	})
 
-	auth := GetAuth(args.URL, args.Auth)
-	if auth.Name() != "" {
+	auth := getAuth(ctx, args.URL, args.Auth)
+	if auth != nil && auth.Name() != "" {
 		opts.Auth = auth
 	}
 
-	err = worktree.Pull(opts)
+	before := packSize(args.Path)
+	err = worktree.PullContext(ctx, opts)
 	if err != nil && err != git.NoErrAlreadyUpToDate {
 		return fmt.Errorf("failed to pull changes: %w for %q", err, args.Path)
 	}
+	reportTransfer(args.Progress, args.Path, before)
 
 	return nil
 }
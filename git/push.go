@@ -1,9 +1,12 @@
 package git
 
 import (
+	"context"
 	"fmt"
+	"io"
 
 	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
 	"github.com/mateothegreat/go-multilog/multilog"
 	"github.com/polyrepopro/api/config"
 	"github.com/polyrepopro/api/utils"
@@ -15,10 +18,18 @@ type PushArgs struct {
 	Remote string
 	Path   string
 	Auth   *config.Auth
+	// RefSpecs overrides the refspecs to push, when empty the remote's configured refspecs are used.
+	RefSpecs []string
+	// Progress receives the progress output of git, when set.
+	Progress io.Writer
+	// Context carries the trace the push is part of and cancels it, nil uses context.Background().
+	Context context.Context
 }
 
 // pushProgress represents the progress of a push operation.
-type pushProgress struct{}
+type pushProgress struct {
+	w io.Writer
+}
 
 // Write writes the progress of a push operation.
 //
@@ -31,6 +42,9 @@ func (h *pushProgress) Write(p []byte) (n int, err error) {
 	multilog.Debug("git.push", "pushing progress", map[string]interface{}{
 		"message": string(p),
 	})
+	if h.w != nil {
+		h.w.Write(p)
+	}
 	return len(p), nil
 }
 
@@ -41,7 +55,10 @@ func (h *pushProgress) Write(p []byte) (n int, err error) {
 //
 // Returns:
 // - error: any error encountered during the push process
-func Push(args PushArgs) error {
+func Push(args PushArgs) (err error) {
+	ctx, span := startSpan(args.Context, "git.push", args.Path)
+	defer func() { endSpan(span, err) }()
+
 	expandedPath, err := utils.ExpandPath(args.Path)
 	if err != nil {
 		return fmt.Errorf("failed to expand path %q: %w", args.Path, err)
@@ -54,7 +71,10 @@ func Push(args PushArgs) error {
 
 	opts := &git.PushOptions{
 		RemoteName: args.Remote,
-		Progress:   &pushProgress{},
+		Progress:   &pushProgress{w: args.Progress},
+	}
+	for _, refSpec := range args.RefSpecs {
+		opts.RefSpecs = append(opts.RefSpecs, gitconfig.RefSpec(refSpec))
 	}
 
 	// Get the actual remote URL from the repository, not from config
@@ -77,7 +97,7 @@ func Push(args PushArgs) error {
 		return fmt.Errorf("remote %q not found in repository", args.Remote)
 	}
 
-	auth := GetAuth(actualRemoteURL, args.Auth)
+	auth := getAuth(ctx, actualRemoteURL, args.Auth)
 	if auth != nil {
 		opts.Auth = auth
 		multilog.Debug("git.push", "using auth", map[string]interface{}{
@@ -87,7 +107,7 @@ func Push(args PushArgs) error {
 		})
 	}
 
-	err = repo.Push(opts)
+	err = repo.PushContext(ctx, opts)
 	if err != nil {
 		if err == git.NoErrAlreadyUpToDate {
 			return nil
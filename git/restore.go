@@ -0,0 +1,80 @@
+package git
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// RestoreArgs are the arguments for restoring where HEAD of a repository points.
+type RestoreArgs struct {
+	Path string
+	// Branch is checked out and reset to Commit, it is created if it no longer
+	// exists. When empty, Commit is checked out as a detached HEAD.
+	Branch string
+	Commit string
+	// Context carries the trace the restore is part of, nil starts a new trace.
+	Context context.Context
+}
+
+// Restore checks out a branch and resets it to a commit. Uncommitted changes
+// would be lost by the reset, so a worktree that is not clean is left alone.
+//
+// Arguments:
+//   - args: The arguments for the restore.
+//
+// Returns:
+//   - error: An error if the worktree is not clean or the commit could not be checked out.
+func Restore(args *RestoreArgs) (err error) {
+	_, span := startSpan(args.Context, "git.restore", args.Path)
+	span.SetAttributes(attribute.String("git.branch", args.Branch), attribute.String("git.commit", args.Commit))
+	defer func() { endSpan(span, err) }()
+
+	repo, err := git.PlainOpen(args.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	status, err := worktree.Status()
+	if err != nil {
+		return fmt.Errorf("failed to get status: %w", err)
+	}
+	if !status.IsClean() {
+		return fmt.Errorf("worktree has uncommitted changes")
+	}
+
+	hash := plumbing.NewHash(args.Commit)
+	if _, err := repo.CommitObject(hash); err != nil {
+		return fmt.Errorf("failed to find commit %s: %w", args.Commit, err)
+	}
+
+	if args.Branch == "" {
+		if err := worktree.Checkout(&git.CheckoutOptions{Hash: hash}); err != nil {
+			return fmt.Errorf("failed to checkout commit %s: %w", args.Commit, err)
+		}
+		return nil
+	}
+
+	branch := plumbing.NewBranchReferenceName(args.Branch)
+	if _, err := repo.Reference(branch, false); err != nil {
+		if err := worktree.Checkout(&git.CheckoutOptions{Branch: branch, Hash: hash, Create: true}); err != nil {
+			return fmt.Errorf("failed to create branch %q: %w", args.Branch, err)
+		}
+		return nil
+	}
+	if err := worktree.Checkout(&git.CheckoutOptions{Branch: branch}); err != nil {
+		return fmt.Errorf("failed to checkout branch %q: %w", args.Branch, err)
+	}
+	if err := worktree.Reset(&git.ResetOptions{Commit: hash, Mode: git.HardReset}); err != nil {
+		return fmt.Errorf("failed to reset branch %q to %s: %w", args.Branch, args.Commit, err)
+	}
+	return nil
+}
@@ -1,18 +1,26 @@
 package git
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type SwitchArgs struct {
 	Path   string
 	Branch string
+	// Context carries the trace the checkout is part of, nil starts a new trace.
+	Context context.Context
 }
 
-func Switch(args *SwitchArgs) error {
+func Switch(args *SwitchArgs) (err error) {
+	_, span := startSpan(args.Context, "git.checkout", args.Path)
+	span.SetAttributes(attribute.String("git.branch", args.Branch))
+	defer func() { endSpan(span, err) }()
+
 	repo, err := git.PlainOpen(args.Path)
 	if err != nil {
 		return fmt.Errorf("failed to open repository: %w", err)
@@ -0,0 +1,54 @@
+package git
+
+import (
+	"fmt"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// TagArgs represents the arguments for tagging the HEAD of a repository.
+type TagArgs struct {
+	Path    string
+	Name    string
+	Message string
+}
+
+// Tag creates a tag pointing at the HEAD of the repository.
+// An annotated tag is created when a message is provided, otherwise a lightweight tag is created.
+//
+// Arguments:
+// - args: the tag arguments including path, name, and message
+//
+// Returns:
+// - string: the hash the tag points at
+// - error: any error encountered while creating the tag
+func Tag(args TagArgs) (string, error) {
+	repo, err := git.PlainOpen(args.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("failed to get HEAD: %w", err)
+	}
+
+	var opts *git.CreateTagOptions
+	if args.Message != "" {
+		signature, err := GetGitUser(args.Path)
+		if err != nil {
+			return "", fmt.Errorf("failed to get git user information: %w", err)
+		}
+		opts = &git.CreateTagOptions{
+			Tagger:  signature,
+			Message: args.Message,
+		}
+	}
+
+	_, err = repo.CreateTag(args.Name, head.Hash(), opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to create tag %q: %w", args.Name, err)
+	}
+
+	return head.Hash().String(), nil
+}
@@ -0,0 +1,49 @@
+package git
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/polyrepopro/api/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer returns the tracer of git steps from the global tracer provider, which
+// records nothing until monitoring.SetupTracing installs an exporter.
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/polyrepopro/api/git")
+}
+
+// startSpan starts the span of a git step as a child of the span in ctx, a nil ctx starts a new trace.
+func startSpan(ctx context.Context, name string, path string) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return tracer().Start(ctx, name, trace.WithAttributes(attribute.String("git.path", path)))
+}
+
+// endSpan ends a span, recording the error if the step failed.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// getAuth resolves the auth method for a URL with GetAuth in a span, since
+// credential helpers and SSH agents can make it a slow step.
+func getAuth(ctx context.Context, url string, auth *config.Auth) transport.AuthMethod {
+	_, span := tracer().Start(ctx, "git.auth", trace.WithAttributes(attribute.String("git.url", url)))
+	defer span.End()
+
+	method := GetAuth(url, auth)
+	if method != nil {
+		span.SetAttributes(attribute.String("git.auth.method", method.Name()), attribute.String("git.auth.type", fmt.Sprintf("%T", method)))
+	}
+	return method
+}
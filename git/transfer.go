@@ -0,0 +1,38 @@
+package git
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// TransferReporter is implemented by progress writers that want to know how
+// many bytes an operation received. go-git does not report transfer sizes, so
+// they are measured as the growth of the pack files of the repository.
+type TransferReporter interface {
+	Transferred(bytes int64)
+}
+
+// packSize returns the total size of the pack files of the repository at path.
+func packSize(path string) int64 {
+	matches, _ := filepath.Glob(filepath.Join(path, ".git", "objects", "pack", "*.pack"))
+	var size int64
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+// reportTransfer reports the bytes received since the pack files had the size
+// before to w, if it is a TransferReporter and anything was received.
+func reportTransfer(w io.Writer, path string, before int64) {
+	reporter, ok := w.(TransferReporter)
+	if !ok {
+		return
+	}
+	if received := packSize(path) - before; received > 0 {
+		reporter.Transferred(received)
+	}
+}
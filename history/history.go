@@ -0,0 +1,241 @@
+// Package history records the mutating operations run on repositories in an
+// append-only JSON lines file and lists them back filtered by repository,
+// operation and time.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mateothegreat/go-util/files"
+)
+
+// DefaultPath is the history file used when none is set.
+const DefaultPath = "~/.polyrepo/history.jsonl"
+
+// Outcome is how the operation on a repository ended.
+type Outcome string
+
+const (
+	Succeeded Outcome = "succeeded"
+	Failed    Outcome = "failed"
+	// Skipped repositories were not operated on because a dependency failed.
+	Skipped Outcome = "skipped"
+)
+
+// Ref is where HEAD of a repository pointed.
+type Ref struct {
+	// Branch is the checked out branch, empty when HEAD is detached.
+	Branch string `json:"branch,omitempty"`
+	Commit string `json:"commit,omitempty"`
+}
+
+// Entry records the operation on one repository.
+type Entry struct {
+	// ID is shared by the entries of the repositories of one workspace operation.
+	ID string `json:"id"`
+	// Time is when the operation on the repository started.
+	Time       time.Time `json:"time"`
+	User       string    `json:"user,omitempty"`
+	Operation  string    `json:"operation"`
+	Workspace  string    `json:"workspace,omitempty"`
+	Repository string    `json:"repository"`
+	// Path is the absolute path of the repository.
+	Path    string  `json:"path,omitempty"`
+	Before  Ref     `json:"before"`
+	After   Ref     `json:"after"`
+	Outcome Outcome `json:"outcome"`
+	Error   string  `json:"error,omitempty"`
+}
+
+var (
+	defaultMu sync.RWMutex
+	// defaultStore is the store workspace operations are recorded in.
+	defaultStore *Store
+)
+
+// Default returns the store workspace operations are recorded in.
+//
+// Returns:
+//   - *Store: The store, nil while no history is set up.
+func Default() *Store {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultStore
+}
+
+// SetDefault replaces the store workspace operations are recorded in.
+//
+// Arguments:
+//   - store: The store, nil stops recording operations.
+func SetDefault(store *Store) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultStore = store
+}
+
+// Store is an append-only history file. It is safe for concurrent use.
+type Store struct {
+	path string
+	user string
+	mu   sync.Mutex
+}
+
+// Open opens a history file, creating its directory if needed.
+//
+// Arguments:
+//   - path: The path of the history file, DefaultPath when empty.
+//
+// Returns:
+//   - *Store: The store.
+//   - error: An error if the directory could not be created.
+func Open(path string) (*Store, error) {
+	if path == "" {
+		path = DefaultPath
+	}
+	path = files.ExpandPath(path)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+	return &Store{path: path, user: currentUser()}, nil
+}
+
+// Path returns the path of the history file.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Append adds entries to the end of the history, entries without a user get
+// the user running the process.
+//
+// Arguments:
+//   - entries: The entries to add.
+//
+// Returns:
+//   - error: An error if the history file could not be written.
+func (s *Store) Append(entries ...Entry) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, entry := range entries {
+		if entry.User == "" {
+			entry.User = s.user
+		}
+		if err := encoder.Encode(entry); err != nil {
+			return fmt.Errorf("failed to encode history entry: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+	return nil
+}
+
+// ListArgs are the filters for listing the history, empty fields match every entry.
+type ListArgs struct {
+	ID         string
+	Workspace  string
+	Repository string
+	Operation  string
+	// Since excludes the entries before this time.
+	Since time.Time
+	// Until excludes the entries at or after this time.
+	Until time.Time
+	// Limit keeps only the most recent matching entries, zero keeps all of them.
+	Limit int
+}
+
+func (args ListArgs) matches(entry Entry) bool {
+	switch {
+	case args.ID != "" && entry.ID != args.ID:
+		return false
+	case args.Workspace != "" && entry.Workspace != args.Workspace:
+		return false
+	case args.Repository != "" && entry.Repository != args.Repository:
+		return false
+	case args.Operation != "" && entry.Operation != args.Operation:
+		return false
+	case !args.Since.IsZero() && entry.Time.Before(args.Since):
+		return false
+	case !args.Until.IsZero() && !entry.Time.Before(args.Until):
+		return false
+	}
+	return true
+}
+
+// List returns the matching entries, oldest first.
+//
+// Arguments:
+//   - args: The filters for the entries.
+//
+// Returns:
+//   - []Entry: The matching entries.
+//   - error: An error if the history file could not be read.
+func (s *Store) List(args ListArgs) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse line %d of the history file: %w", line, err)
+		}
+		if args.matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history file: %w", err)
+	}
+
+	if args.Limit > 0 && len(entries) > args.Limit {
+		entries = entries[len(entries)-args.Limit:]
+	}
+	return entries, nil
+}
+
+// NewID returns a random ID for the entries of an operation.
+func NewID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
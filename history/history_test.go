@@ -0,0 +1,72 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestStore(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "state", "history.jsonl"))
+	assert.NoError(t, err)
+
+	entries, err := store.List(ListArgs{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(entries))
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	pull := NewID()
+	assert.NoError(t, store.Append(
+		Entry{ID: pull, Time: start, Operation: "pull", Workspace: "test", Repository: "api", Before: Ref{Branch: "main", Commit: "a"}, After: Ref{Branch: "main", Commit: "b"}, Outcome: Succeeded},
+		Entry{ID: pull, Time: start, Operation: "pull", Workspace: "test", Repository: "web", Before: Ref{Branch: "main", Commit: "c"}, After: Ref{Branch: "main", Commit: "c"}, Outcome: Failed, Error: "conflict"},
+	))
+	assert.NoError(t, store.Append(
+		Entry{ID: NewID(), Time: start.Add(time.Hour), User: "ci", Operation: "push", Workspace: "test", Repository: "api", Before: Ref{Branch: "main", Commit: "b"}, After: Ref{Branch: "main", Commit: "b"}, Outcome: Succeeded},
+	))
+
+	entries, err = store.List(ListArgs{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(entries))
+	assert.Equal(t, currentUser(), entries[0].User)
+	assert.Equal(t, "ci", entries[2].User)
+	assert.Equal(t, Ref{Branch: "main", Commit: "b"}, entries[0].After)
+	assert.True(t, entries[0].Time.Equal(start))
+
+	entries, err = store.List(ListArgs{Repository: "api"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pull", "push"}, []string{entries[0].Operation, entries[1].Operation})
+
+	entries, err = store.List(ListArgs{Operation: "pull", Repository: "web"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, "conflict", entries[0].Error)
+
+	entries, err = store.List(ListArgs{ID: pull})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(entries))
+
+	entries, err = store.List(ListArgs{Since: start.Add(time.Minute)})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, "push", entries[0].Operation)
+
+	entries, err = store.List(ListArgs{Until: start.Add(time.Hour)})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(entries))
+
+	entries, err = store.List(ListArgs{Limit: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"web", "api"}, []string{entries[0].Repository, entries[1].Repository})
+
+	// The history file is append-only JSON lines, a corrupt line is reported.
+	f, err := os.OpenFile(store.Path(), os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = f.WriteString("{\n")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	_, err = store.List(ListArgs{})
+	assert.EqualError(t, err, "failed to parse line 4 of the history file: unexpected end of JSON input")
+}
@@ -5,13 +5,61 @@ import (
 
 	"github.com/polyrepopro/api/commands"
 	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/events"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func Run(ctx context.Context, hook *config.Hook) error {
-	for _, command := range hook.Commands {
-		if err := commands.Run(ctx, command.Name, command, command.Cwd); err != nil {
-			return err
+// Run runs the commands of a hook in order with their timeouts and retries.
+// A failed command stops the hook unless it has exitOnError set to false, in
+// which case the remaining commands still run. Every line of output is published as a
+// HookOutput event with the values of secret variables masked.
+//
+// Arguments:
+//   - ctx: The context for the commands.
+//   - hook: The hook to run.
+//   - cwd: The directory to run commands in, relative command cwd values are resolved against it.
+//   - vars: The values the command templates are expanded with, nil runs the commands as written.
+//
+// Returns:
+//   - []commands.Outcome: The outcome of every command in order, including the tail of its output.
+//   - error: The errors of the commands that failed.
+func Run(ctx context.Context, hook *config.Hook, cwd string, vars *commands.Vars) (outcomes []commands.Outcome, err error) {
+	ctx, span := tracer().Start(ctx, "hook."+string(hook.Type), trace.WithAttributes(
+		attribute.String("hook.type", string(hook.Type)),
+		attribute.Int("hook.commands", len(hook.Commands)),
+	))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
 		}
+		span.End()
+	}()
+
+	expanded, err := vars.ExpandCommands(hook.Commands)
+	if err != nil {
+		return nil, err
+	}
+
+	template := events.Event{Type: events.HookOutput, Operation: string(hook.Type)}
+	if vars != nil {
+		template.Workspace = vars.Workspace.Name
+		template.Repository = vars.Repository.Name
 	}
-	return nil
+	output := events.NewOutput(template)
+
+	return commands.ExecuteAll(ctx, string(hook.Type), expanded, cwd, &commands.Output{
+		Stdout:  output,
+		Stderr:  output,
+		Mask:    true,
+		Capture: commands.DefaultCapture,
+	})
+}
+
+// tracer returns the tracer of hooks from the global tracer provider.
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/polyrepopro/api/hooks")
 }
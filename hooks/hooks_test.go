@@ -4,7 +4,10 @@ import (
 	"context"
 	"testing"
 
+	"github.com/alecthomas/assert"
+	"github.com/polyrepopro/api/commands"
 	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/events"
 	"github.com/polyrepopro/api/test"
 )
 
@@ -39,8 +42,38 @@ func TestRun(t *testing.T) {
 			},
 		},
 	}
-	err := Run(ctx, hook)
+	_, err := Run(ctx, hook, ".", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 }
+
+func TestRunPublishesOutput(t *testing.T) {
+	test.Setup()
+	sub := events.Subscribe(0, events.HookOutput)
+	defer sub.Close()
+
+	hook := &config.Hook{
+		Type: config.PullHook,
+		Commands: []config.Command{
+			{Name: "print", Shell: "echo hello; echo token=$API_TOKEN >&2", Env: map[string]string{"API_TOKEN": "s3cr3t-token"}},
+		},
+	}
+	vars := &commands.Vars{
+		Workspace:  commands.WorkspaceVars{Name: "test"},
+		Repository: commands.RepositoryVars{Name: "api"},
+	}
+	_, err := Run(context.Background(), hook, t.TempDir(), vars)
+	assert.NoError(t, err)
+
+	var lines []string
+	for len(lines) < 2 {
+		event := <-sub.C
+		assert.Equal(t, "pull", event.Operation)
+		assert.Equal(t, "test", event.Workspace)
+		assert.Equal(t, "api", event.Repository)
+		lines = append(lines, event.Message)
+	}
+	assert.Contains(t, lines, "hello")
+	assert.Contains(t, lines, "token=****")
+}
@@ -0,0 +1,58 @@
+package logs
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/mateothegreat/go-multilog/multilog"
+)
+
+// FanOut writes to every sink. Unlike io.MultiWriter a failing sink does not
+// stop the sinks after it: the failure is logged when the sink starts failing
+// and the sink is skipped for that write. It is safe for concurrent use.
+type FanOut struct {
+	mu      sync.Mutex
+	name    string
+	sinks   []io.Writer
+	failing []bool
+}
+
+// NewFanOut creates a writer that writes to every sink.
+//
+// Arguments:
+//   - name: The name failures are logged with, such as the label of a runner.
+//   - sinks: The writers written to, in order.
+//
+// Returns:
+//   - *FanOut: The writer.
+func NewFanOut(name string, sinks ...io.Writer) *FanOut {
+	return &FanOut{name: name, sinks: sinks, failing: make([]bool, len(sinks))}
+}
+
+// Write writes p to every sink and always reports the whole of p as written.
+func (f *FanOut) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, sink := range f.sinks {
+		n, err := sink.Write(p)
+		if err == nil && n < len(p) {
+			err = io.ErrShortWrite
+		}
+		switch {
+		case err != nil && !f.failing[i]:
+			f.failing[i] = true
+			multilog.Error(f.name, "log sink failed, skipping it until it recovers", map[string]interface{}{
+				"sink":  fmt.Sprintf("%T", sink),
+				"error": err.Error(),
+			})
+		case err == nil && f.failing[i]:
+			f.failing[i] = false
+			multilog.Info(f.name, "log sink recovered", map[string]interface{}{
+				"sink": fmt.Sprintf("%T", sink),
+			})
+		}
+	}
+	return len(p), nil
+}
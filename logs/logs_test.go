@@ -0,0 +1,120 @@
+package logs
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api", "server.log")
+	file, err := NewRotatingFile(RotatingFileArgs{Path: path, MaxSize: 20, MaxFiles: 2})
+	assert.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		_, err := fmt.Fprintf(file, "line %02d\n", i)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, file.Close())
+
+	// Each file holds two 8 byte lines, only two rotated files are kept.
+	current, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "line 08\nline 09\n", string(current))
+	rotated, err := os.ReadFile(path + ".2")
+	assert.NoError(t, err)
+	assert.Equal(t, "line 04\nline 05\n", string(rotated))
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+
+	lines, err := Tail(path, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"line 05", "line 06", "line 07", "line 08", "line 09"}, lines)
+
+	// Reopening appends to the existing file.
+	file, err = NewRotatingFile(RotatingFileArgs{Path: path, MaxSize: 100})
+	assert.NoError(t, err)
+	fmt.Fprintln(file, "line 10")
+	assert.NoError(t, file.Close())
+	lines, err = Tail(path, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"line 09", "line 10"}, lines)
+
+	_, err = Tail(filepath.Join(t.TempDir(), "missing.log"), 1)
+	assert.Error(t, err)
+}
+
+func TestMultiplexer(t *testing.T) {
+	var out bytes.Buffer
+	m := NewMultiplexer(&out, false, "api/server", "web")
+	web := m.Writer("web")
+	api := m.Writer("api/server")
+
+	fmt.Fprint(api, "listening")
+	fmt.Fprint(web, "compiled\nwatching\n")
+	fmt.Fprint(api, " on :8080\n")
+
+	assert.Equal(t, strings.Join([]string{
+		"web        | compiled",
+		"web        | watching",
+		"api/server | listening on :8080",
+		"",
+	}, "\n"), out.String())
+
+	// A name the multiplexer was not created with is not padded.
+	out.Reset()
+	fmt.Fprintln(m.Writer("worker/queue"), "started")
+	assert.Equal(t, "worker/queue | started\n", out.String())
+
+	out.Reset()
+	colored := NewMultiplexer(&out, true, "web")
+	fmt.Fprintln(colored.Writer("web"), "ready")
+	assert.Equal(t, Color("web")+"web |"+colorReset+" ready\n", out.String())
+	assert.Equal(t, Color("web"), Color("web"))
+}
+
+func TestRecent(t *testing.T) {
+	r := NewRecent(3)
+	assert.Equal(t, 0, len(r.Tail(0)))
+
+	fmt.Fprint(r, "one\ntwo\n")
+	assert.Equal(t, []string{"one", "two"}, r.Tail(0))
+
+	fmt.Fprint(r, "three\nfour\nfi")
+	assert.Equal(t, []string{"two", "three", "four"}, r.Tail(0))
+	assert.Equal(t, []string{"four"}, r.Tail(1))
+
+	var out bytes.Buffer
+	assert.NoError(t, r.Replay(&out, 2))
+	assert.Equal(t, "three\nfour\n", out.String())
+}
+
+// failingWriter fails every write while failing is set.
+type failingWriter struct{ failing bool }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.failing {
+		return 0, os.ErrClosed
+	}
+	return len(p), nil
+}
+
+func TestFanOut(t *testing.T) {
+	var first, last bytes.Buffer
+	broken := &failingWriter{failing: true}
+	f := NewFanOut("api/server", &first, broken, &last)
+
+	n, err := fmt.Fprint(f, "one\n")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+	broken.failing = false
+	fmt.Fprint(f, "two\n")
+
+	assert.Equal(t, "one\ntwo\n", first.String())
+	assert.Equal(t, "one\ntwo\n", last.String())
+}
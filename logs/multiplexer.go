@@ -0,0 +1,126 @@
+package logs
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sync"
+)
+
+// colors are the ANSI foreground colors runner names are printed in.
+var colors = []string{
+	"\033[36m", // cyan
+	"\033[33m", // yellow
+	"\033[32m", // green
+	"\033[35m", // magenta
+	"\033[34m", // blue
+	"\033[96m", // bright cyan
+	"\033[93m", // bright yellow
+	"\033[92m", // bright green
+	"\033[95m", // bright magenta
+	"\033[94m", // bright blue
+}
+
+const colorReset = "\033[0m"
+
+// Color returns the ANSI color of a name, the same name always gets the same color.
+//
+// Arguments:
+//   - name: The name.
+//
+// Returns:
+//   - string: The ANSI escape sequence of the color.
+func Color(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return colors[h.Sum32()%uint32(len(colors))]
+}
+
+// Multiplexer interleaves the output of several runners on one writer, each
+// line prefixed with the name of the runner that produced it and padded to the
+// longest name it was created with. It is safe for concurrent use.
+type Multiplexer struct {
+	w     io.Writer
+	color bool
+	width int
+
+	// mu keeps the lines of concurrent writers from interleaving.
+	mu sync.Mutex
+}
+
+// NewMultiplexer creates a multiplexer writing to w.
+//
+// Arguments:
+//   - w: The writer, usually os.Stdout.
+//   - color: Whether the runner names are colored.
+//   - names: The names of the runners, the prefixes are padded to the longest
+//     so that every line lines up from the first one.
+//
+// Returns:
+//   - *Multiplexer: The multiplexer.
+func NewMultiplexer(w io.Writer, color bool, names ...string) *Multiplexer {
+	width := 0
+	for _, name := range names {
+		width = max(width, len(name))
+	}
+	return &Multiplexer{w: w, color: color, width: width}
+}
+
+// Writer returns a writer whose lines are written prefixed with the name.
+// A name longer than the names the multiplexer was created with is not padded.
+//
+// Arguments:
+//   - name: The name of the runner.
+//
+// Returns:
+//   - *PrefixWriter: The writer, it buffers partial lines until they are complete.
+func (m *Multiplexer) Writer(name string) *PrefixWriter {
+	return &PrefixWriter{m: m, name: name}
+}
+
+func (m *Multiplexer) writeLine(name string, line []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	prefix := fmt.Sprintf("%-*s |", m.width, name)
+	if m.color {
+		prefix = Color(name) + prefix + colorReset
+	}
+	fmt.Fprintf(m.w, "%s %s\n", prefix, line)
+}
+
+// PrefixWriter writes the complete lines written to it to a multiplexer.
+type PrefixWriter struct {
+	m    *Multiplexer
+	name string
+	mu   sync.Mutex
+	buf  []byte
+}
+
+func (p *PrefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		p.m.writeLine(p.name, bytes.TrimSuffix(p.buf[:i], []byte("\r")))
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// Flush writes any buffered partial line.
+func (p *PrefixWriter) Flush() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.buf) > 0 {
+		p.m.writeLine(p.name, bytes.TrimSuffix(p.buf, []byte("\r")))
+		p.buf = nil
+	}
+}
@@ -0,0 +1,144 @@
+package logs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// DefaultRecentLines is the number of lines a Recent buffer keeps when none is set.
+const DefaultRecentLines = 1000
+
+// Recent keeps the most recent lines written to it so the output of a runner
+// can be tailed or replayed. It is safe for concurrent use.
+type Recent struct {
+	mu    sync.Mutex
+	lines []string
+	next  int
+	full  bool
+	buf   []byte
+}
+
+// NewRecent creates a buffer of recent lines.
+//
+// Arguments:
+//   - size: The number of lines kept, zero uses DefaultRecentLines.
+//
+// Returns:
+//   - *Recent: The buffer.
+func NewRecent(size int) *Recent {
+	if size <= 0 {
+		size = DefaultRecentLines
+	}
+	return &Recent{lines: make([]string, size)}
+}
+
+// Write adds every complete line to the buffer, a partial line is kept until it is completed.
+func (r *Recent) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.buf = append(r.buf, p...)
+	for {
+		i := bytes.IndexByte(r.buf, '\n')
+		if i < 0 {
+			break
+		}
+		r.lines[r.next] = string(r.buf[:i])
+		r.next = (r.next + 1) % len(r.lines)
+		r.full = r.full || r.next == 0
+		r.buf = r.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Tail returns the most recent lines, oldest first.
+//
+// Arguments:
+//   - n: The maximum number of lines, zero or less returns every line kept.
+//
+// Returns:
+//   - []string: The lines.
+func (r *Recent) Tail(n int) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var lines []string
+	if r.full {
+		lines = append(lines, r.lines[r.next:]...)
+	}
+	lines = append(lines, r.lines[:r.next]...)
+	if n > 0 && len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
+
+// Replay writes the most recent lines to w.
+//
+// Arguments:
+//   - w: The writer.
+//   - n: The maximum number of lines, zero or less replays every line kept.
+//
+// Returns:
+//   - error: An error if writing failed.
+func (r *Recent) Replay(w io.Writer, n int) error {
+	for _, line := range r.Tail(n) {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tail returns the last lines of a log file, reading rotated files when the
+// current file has fewer lines.
+//
+// Arguments:
+//   - path: The path of the current log file.
+//   - n: The number of lines.
+//
+// Returns:
+//   - []string: The lines, oldest first.
+//   - error: An error if the current log file could not be read.
+func Tail(path string, n int) ([]string, error) {
+	var lines []string
+	for i := 0; len(lines) < n; i++ {
+		name := path
+		if i > 0 {
+			name = rotatedPath(path, i)
+		}
+		file, err := readLines(name)
+		if err != nil {
+			if i > 0 && os.IsNotExist(err) {
+				break
+			}
+			return nil, fmt.Errorf("failed to read log file: %w", err)
+		}
+		lines = append(file, lines...)
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, nil
+}
+
+func readLines(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimSuffix(scanner.Text(), "\r"))
+	}
+	return lines, scanner.Err()
+}
@@ -0,0 +1,147 @@
+// Package logs sets up the logging of the library and provides sinks for the
+// output of runners: rotating log files, a color-coded console multiplexer and
+// buffers of recent output.
+package logs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// DefaultMaxSize is the size a log file is rotated at when none is set.
+	DefaultMaxSize = 10 * 1024 * 1024
+	// DefaultMaxFiles is the number of rotated log files kept when none is set.
+	DefaultMaxFiles = 3
+)
+
+// RotatingFileArgs are the arguments for opening a rotating log file.
+type RotatingFileArgs struct {
+	// Path is the path of the current log file, rotated files get a numeric suffix such as ".1".
+	Path string
+	// MaxSize is the size in bytes at which the file is rotated.
+	MaxSize int64
+	// MaxFiles is the number of rotated files kept, older files are removed.
+	MaxFiles int
+}
+
+// RotatingFile is a log file that is rotated once it reaches a maximum size.
+// It is safe for concurrent use.
+type RotatingFile struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewRotatingFile opens a log file for appending, creating its directory if needed.
+//
+// Arguments:
+//   - args: The arguments for the log file.
+//
+// Returns:
+//   - *RotatingFile: The log file.
+//   - error: An error if the file could not be opened.
+func NewRotatingFile(args RotatingFileArgs) (*RotatingFile, error) {
+	f := &RotatingFile{
+		path:     args.Path,
+		maxSize:  args.MaxSize,
+		maxFiles: args.MaxFiles,
+	}
+	if f.maxSize <= 0 {
+		f.maxSize = DefaultMaxSize
+	}
+	if f.maxFiles <= 0 {
+		f.maxFiles = DefaultMaxFiles
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+	f.file = file
+	f.size = stat.Size()
+	return nil
+}
+
+// Write appends to the log file, rotating it first if the write would exceed the maximum size.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate renames the current file to ".1", shifting older files up and
+// removing the ones beyond the retention, and opens a new current file.
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+	f.file = nil
+
+	os.Remove(rotatedPath(f.path, f.maxFiles))
+	for i := f.maxFiles - 1; i >= 1; i-- {
+		if err := os.Rename(rotatedPath(f.path, i), rotatedPath(f.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to rotate log file: %w", err)
+		}
+	}
+	if err := os.Rename(f.path, rotatedPath(f.path, 1)); err != nil {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+
+	return f.open()
+}
+
+// Close closes the log file.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// Path returns the path of the current log file.
+func (f *RotatingFile) Path() string {
+	return f.path
+}
+
+func rotatedPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
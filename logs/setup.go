@@ -0,0 +1,357 @@
+package logs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mateothegreat/go-multilog/multilog"
+	"github.com/mateothegreat/go-util/files"
+)
+
+// Level is the minimum severity of the entries that are logged.
+type Level string
+
+const (
+	TraceLevel Level = "trace"
+	DebugLevel Level = "debug"
+	InfoLevel  Level = "info"
+	WarnLevel  Level = "warn"
+	ErrorLevel Level = "error"
+	FatalLevel Level = "fatal"
+)
+
+// DefaultLevel is the level used when none is set.
+const DefaultLevel = DebugLevel
+
+// Format is how log entries are written.
+type Format string
+
+const (
+	// TextFormat writes entries as key=value pairs.
+	TextFormat Format = "text"
+	// JSONFormat writes entries as one JSON object per line.
+	JSONFormat Format = "json"
+)
+
+// DestinationType is where log entries are written.
+type DestinationType string
+
+const (
+	// ConsoleDestination writes entries to standard error.
+	ConsoleDestination DestinationType = "console"
+	// FileDestination appends entries to a rotating log file.
+	FileDestination DestinationType = "file"
+)
+
+// LogMethod is the multilog method the configured logger is registered under.
+const LogMethod multilog.LogMethod = "polyrepo"
+
+// Destination is one place log entries are written to.
+type Destination struct {
+	// Type is where the entries are written.
+	Type DestinationType `yaml:"type" required:"true"`
+	// Format overrides the format of the logging config for this destination.
+	Format Format `yaml:"format,omitempty" required:"false"`
+	// Path is the log file of a file destination.
+	Path string `yaml:"path,omitempty" required:"false"`
+	// MaxSize is the size in bytes at which the log file is rotated, DefaultMaxSize when zero.
+	MaxSize int64 `yaml:"maxSize,omitempty" required:"false"`
+	// MaxFiles is the number of rotated log files kept, DefaultMaxFiles when zero.
+	MaxFiles int `yaml:"maxFiles,omitempty" required:"false"`
+}
+
+// Config configures the logging of the library.
+type Config struct {
+	// Level is the minimum level logged, DefaultLevel when empty.
+	Level Level `yaml:"level,omitempty" required:"false"`
+	// Format is how entries are written, TextFormat when empty.
+	Format Format `yaml:"format,omitempty" required:"false"`
+	// Destinations are where entries are written, the console when empty.
+	Destinations []Destination `yaml:"destinations,omitempty" required:"false"`
+	// Components overrides the level per component, keyed by the group an entry is
+	// logged with such as "git.auth". A key also applies to the groups below it,
+	// so "git" covers "git.clone" unless a longer key matches.
+	Components map[string]Level `yaml:"components,omitempty" required:"false"`
+	// Drop are regular expressions, entries whose group or message match one are not logged.
+	Drop []string `yaml:"drop,omitempty" required:"false"`
+}
+
+// Validate checks the levels, formats, destinations and drop patterns of the config.
+//
+// Returns:
+//   - error: An error describing the first problem found.
+func (c *Config) Validate() error {
+	if _, err := parseLevel(c.Level); err != nil {
+		return err
+	}
+	if err := validateFormat(c.Format); err != nil {
+		return err
+	}
+	for i, destination := range c.Destinations {
+		switch destination.Type {
+		case ConsoleDestination:
+		case FileDestination:
+			if destination.Path == "" {
+				return fmt.Errorf("logging destination %d: a file destination requires a path", i)
+			}
+		default:
+			return fmt.Errorf("logging destination %d: unknown type %q, expected %q or %q", i, destination.Type, ConsoleDestination, FileDestination)
+		}
+		if err := validateFormat(destination.Format); err != nil {
+			return fmt.Errorf("logging destination %d: %w", i, err)
+		}
+	}
+	for component, level := range c.Components {
+		if _, err := parseLevel(level); err != nil {
+			return fmt.Errorf("logging component %q: %w", component, err)
+		}
+	}
+	for _, pattern := range c.Drop {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid logging drop pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+func parseLevel(level Level) (multilog.LogLevel, error) {
+	if level == "" {
+		level = DefaultLevel
+	}
+	switch Level(strings.ToLower(string(level))) {
+	case TraceLevel:
+		return multilog.TRACE, nil
+	case DebugLevel:
+		return multilog.DEBUG, nil
+	case InfoLevel:
+		return multilog.INFO, nil
+	case WarnLevel, "warning":
+		return multilog.WARN, nil
+	case ErrorLevel:
+		return multilog.ERROR, nil
+	case FatalLevel:
+		return multilog.FATAL, nil
+	}
+	return 0, fmt.Errorf("unknown logging level %q", level)
+}
+
+func validateFormat(format Format) error {
+	switch format {
+	case "", TextFormat, JSONFormat:
+		return nil
+	}
+	return fmt.Errorf("unknown logging format %q, expected %q or %q", format, TextFormat, JSONFormat)
+}
+
+var (
+	// console is where console destinations write, replaced in tests.
+	console io.Writer = os.Stderr
+
+	register sync.Once
+	mu       sync.RWMutex
+	current  *logger
+)
+
+// Setup configures the logging of the library, it is used by both the
+// library and the tests. It can be called again to apply a changed config,
+// the previous destinations are closed once the new ones are in place.
+//
+// Arguments:
+//   - cfg: The logging config, a nil config logs everything from DefaultLevel up to the console as text.
+//
+// Returns:
+//   - error: An error if the config is invalid or a log file could not be opened.
+func Setup(cfg *Config) error {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	l, err := newLogger(cfg)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	previous := current
+	current = l
+	mu.Unlock()
+
+	register.Do(func() {
+		multilog.RegisterLogger(LogMethod, &multilog.CustomLogger{Log: write})
+	})
+
+	if previous != nil {
+		return previous.close()
+	}
+	return nil
+}
+
+// write is the multilog logger function, it hands the entry to the current logger.
+func write(level multilog.LogLevel, group string, message string, v map[string]interface{}) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if current != nil {
+		current.log(level, group, message, v)
+	}
+}
+
+type component struct {
+	name  string
+	level multilog.LogLevel
+}
+
+type sink struct {
+	handler slog.Handler
+	closer  io.Closer
+}
+
+type logger struct {
+	level      multilog.LogLevel
+	components []component
+	drop       []*regexp.Regexp
+	sinks      []sink
+}
+
+func newLogger(cfg *Config) (*logger, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	l := &logger{}
+	l.level, _ = parseLevel(cfg.Level)
+	for name, level := range cfg.Components {
+		parsed, _ := parseLevel(level)
+		l.components = append(l.components, component{name: strings.ToLower(name), level: parsed})
+	}
+	// The most specific component is matched first.
+	sort.Slice(l.components, func(i, j int) bool {
+		return len(l.components[i].name) > len(l.components[j].name)
+	})
+	for _, pattern := range cfg.Drop {
+		l.drop = append(l.drop, regexp.MustCompile(pattern))
+	}
+
+	destinations := cfg.Destinations
+	if len(destinations) == 0 {
+		destinations = []Destination{{Type: ConsoleDestination}}
+	}
+	for _, destination := range destinations {
+		format := destination.Format
+		if format == "" {
+			format = cfg.Format
+		}
+		switch destination.Type {
+		case ConsoleDestination:
+			l.sinks = append(l.sinks, sink{handler: newHandler(console, format)})
+		case FileDestination:
+			file, err := NewRotatingFile(RotatingFileArgs{
+				Path:     files.ExpandPath(destination.Path),
+				MaxSize:  destination.MaxSize,
+				MaxFiles: destination.MaxFiles,
+			})
+			if err != nil {
+				l.close()
+				return nil, err
+			}
+			l.sinks = append(l.sinks, sink{handler: newHandler(file, format), closer: file})
+		}
+	}
+	return l, nil
+}
+
+func newHandler(w io.Writer, format Format) slog.Handler {
+	opts := &slog.HandlerOptions{
+		// Levels are filtered before entries reach the handler.
+		Level: slog.Level(-8),
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.LevelKey && len(groups) == 0 {
+				a.Value = slog.StringValue(levelName(a.Value.Any().(slog.Level)))
+			}
+			return a
+		},
+	}
+	if format == JSONFormat {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+func slogLevel(level multilog.LogLevel) slog.Level {
+	switch level {
+	case multilog.TRACE:
+		return slog.Level(-8)
+	case multilog.DEBUG:
+		return slog.LevelDebug
+	case multilog.WARN:
+		return slog.LevelWarn
+	case multilog.ERROR:
+		return slog.LevelError
+	case multilog.FATAL:
+		return slog.Level(12)
+	}
+	return slog.LevelInfo
+}
+
+func levelName(level slog.Level) string {
+	switch {
+	case level < slog.LevelDebug:
+		return "TRACE"
+	case level > slog.LevelError:
+		return "FATAL"
+	}
+	return level.String()
+}
+
+// levelOf returns the level of the most specific component matching the group.
+func (l *logger) levelOf(group string) multilog.LogLevel {
+	group = strings.ToLower(group)
+	for _, c := range l.components {
+		if group == c.name || strings.HasPrefix(group, c.name+".") {
+			return c.level
+		}
+	}
+	return l.level
+}
+
+func (l *logger) log(level multilog.LogLevel, group string, message string, v map[string]interface{}) {
+	if level < l.levelOf(group) {
+		return
+	}
+	for _, pattern := range l.drop {
+		if pattern.MatchString(group) || pattern.MatchString(message) {
+			return
+		}
+	}
+
+	record := slog.NewRecord(time.Now(), slogLevel(level), message, 0)
+	record.AddAttrs(slog.String("group", group))
+	keys := make([]string, 0, len(v))
+	for key := range v {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		record.AddAttrs(slog.Any(key, v[key]))
+	}
+	for _, s := range l.sinks {
+		s.handler.Handle(context.Background(), record)
+	}
+}
+
+func (l *logger) close() error {
+	var err error
+	for _, s := range l.sinks {
+		if s.closer != nil {
+			err = errors.Join(err, s.closer.Close())
+		}
+	}
+	return err
+}
@@ -0,0 +1,87 @@
+package logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert"
+	"github.com/mateothegreat/go-multilog/multilog"
+)
+
+func TestSetup(t *testing.T) {
+	defer Setup(nil)
+	var stderr bytes.Buffer
+	console = &stderr
+	defer func() { console = os.Stderr }()
+
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "polyrepo.json")
+	assert.NoError(t, Setup(&Config{
+		Level:  InfoLevel,
+		Format: TextFormat,
+		Destinations: []Destination{
+			{Type: ConsoleDestination},
+			{Type: FileDestination, Path: jsonPath, Format: JSONFormat},
+		},
+		Components: map[string]Level{"git": WarnLevel, "git.auth": DebugLevel},
+		Drop:       []string{"^noisy$"},
+	}))
+
+	multilog.Debug("git.auth", "using SSH agent", map[string]interface{}{"url": "git@github.com:polyrepopro/api.git"})
+	multilog.Info("git.clone", "cloning", nil)
+	multilog.Warn("git.clone", "clone failed", map[string]interface{}{"error": os.ErrNotExist})
+	multilog.Debug("server", "request", nil)
+	multilog.Info("server", "listening", map[string]interface{}{"address": ":8080"})
+	multilog.Error("noisy", "dropped", nil)
+
+	lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+	assert.Equal(t, 3, len(lines), stderr.String())
+	assert.Contains(t, lines[0], `level=DEBUG msg="using SSH agent" group=git.auth url=git@github.com:polyrepopro/api.git`)
+	assert.Contains(t, lines[1], `level=WARN msg="clone failed" group=git.clone error="file does not exist"`)
+	assert.Contains(t, lines[2], `level=INFO msg=listening group=server address=:8080`)
+
+	b, err := os.ReadFile(jsonPath)
+	assert.NoError(t, err)
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var entry map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &entry))
+		entries = append(entries, entry)
+	}
+	assert.Equal(t, 3, len(entries))
+	assert.Equal(t, "git.auth", entries[0]["group"])
+	assert.Equal(t, "file does not exist", entries[1]["error"])
+	assert.Equal(t, "INFO", entries[2]["level"])
+
+	// Applying a new config replaces the destinations and closes the log file.
+	stderr.Reset()
+	previous := current.sinks[1].closer.(*RotatingFile)
+	textPath := filepath.Join(dir, "logs", "polyrepo.log")
+	assert.NoError(t, Setup(&Config{
+		Level:        TraceLevel,
+		Destinations: []Destination{{Type: FileDestination, Path: textPath}},
+	}))
+	multilog.Trace("server", "tick", nil)
+	// multilog.Fatal exits, so the entry is written directly.
+	write(multilog.FATAL, "server", "stopped", nil)
+	assert.Equal(t, "", stderr.String())
+	b, err = os.ReadFile(textPath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "level=TRACE msg=tick")
+	assert.Contains(t, string(b), "level=FATAL msg=stopped")
+	_, err = previous.Write([]byte("late\n"))
+	assert.Equal(t, os.ErrClosed, err)
+
+	// An invalid config keeps the current one.
+	assert.Error(t, Setup(&Config{Level: "verbose"}))
+	assert.Error(t, Setup(&Config{Format: "xml"}))
+	assert.Error(t, Setup(&Config{Destinations: []Destination{{Type: "syslog"}}}))
+	assert.Error(t, Setup(&Config{Destinations: []Destination{{Type: FileDestination}}}))
+	assert.Error(t, Setup(&Config{Components: map[string]Level{"git": "loud"}}))
+	assert.Error(t, Setup(&Config{Drop: []string{"("}}))
+	assert.Equal(t, textPath, current.sinks[0].closer.(*RotatingFile).Path())
+}
@@ -0,0 +1,146 @@
+package monitoring
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// metricType is the type of a metric family in the Prometheus text format.
+type metricType string
+
+const (
+	counterType   metricType = "counter"
+	gaugeType     metricType = "gauge"
+	histogramType metricType = "histogram"
+)
+
+// family is a metric and its series, keyed by their label values.
+type family struct {
+	name    string
+	help    string
+	typ     metricType
+	labels  []string
+	buckets []float64
+	series  map[string]*series
+}
+
+// series is the value of a metric for one set of label values.
+type series struct {
+	labels []string
+	value  float64
+	// counts are the cumulative observations per bucket of a histogram.
+	counts []uint64
+	count  uint64
+}
+
+func newFamily(name string, help string, typ metricType, labels ...string) *family {
+	return &family{name: name, help: help, typ: typ, labels: labels, series: make(map[string]*series)}
+}
+
+func newHistogram(name string, help string, buckets []float64, labels ...string) *family {
+	f := newFamily(name, help, histogramType, labels...)
+	f.buckets = buckets
+	return f
+}
+
+// with returns the series for the label values, creating it if needed.
+func (f *family) with(values ...string) *series {
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: values}
+		if f.typ == histogramType {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// observe adds an observation to a histogram series.
+func (f *family) observe(value float64, values ...string) {
+	s := f.with(values...)
+	for i, bound := range f.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.value += value
+}
+
+// reset removes every series, for families computed when they are written.
+func (f *family) reset() {
+	clear(f.series)
+}
+
+// write writes the family in the Prometheus text exposition format, series
+// are sorted by their label values so the output is stable.
+func (f *family) write(w io.Writer) error {
+	if len(f.series) == 0 {
+		return nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# HELP %s %s\n", f.name, helpEscaper.Replace(f.help))
+	fmt.Fprintf(&b, "# TYPE %s %s\n", f.name, f.typ)
+
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		s := f.series[key]
+		if f.typ != histogramType {
+			fmt.Fprintf(&b, "%s%s %s\n", f.name, f.labelSet(s.labels, ""), formatFloat(s.value))
+			continue
+		}
+		for i, bound := range f.buckets {
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", f.name, f.labelSet(s.labels, formatFloat(bound)), s.counts[i])
+		}
+		fmt.Fprintf(&b, "%s_bucket%s %d\n", f.name, f.labelSet(s.labels, "+Inf"), s.count)
+		fmt.Fprintf(&b, "%s_sum%s %s\n", f.name, f.labelSet(s.labels, ""), formatFloat(s.value))
+		fmt.Fprintf(&b, "%s_count%s %d\n", f.name, f.labelSet(s.labels, ""), s.count)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// labelSet formats label values as {name="value",...}, with the le label of a histogram bucket when set.
+func (f *family) labelSet(values []string, le string) string {
+	pairs := make([]string, 0, len(values)+1)
+	for i, value := range values {
+		pairs = append(pairs, f.labels[i]+`="`+labelEscaper.Replace(value)+`"`)
+	}
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,227 @@
+package monitoring
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mateothegreat/go-multilog/multilog"
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/events"
+	"github.com/polyrepopro/api/git"
+)
+
+// DurationBuckets are the upper bounds in seconds of the operation duration histogram.
+var DurationBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// syncedStates are the states of a sync or pull that leave a repository up to date with its remote.
+var syncedStates = map[string]bool{string(git.FastForwardUpdated): true, string(git.FastForwardUpToDate): true}
+
+// MetricsArgs are the arguments for creating metrics.
+type MetricsArgs struct {
+	// Bus is the bus the metrics are collected from, nil uses events.Default.
+	Bus *events.Bus
+	// Config seeds the last sync time of the repositories from their synced timestamps, when set.
+	Config *config.Config
+	// Buffer is the number of events buffered while the metrics are updated, zero uses events.DefaultBuffer.
+	Buffer int
+}
+
+// Metrics collects metrics about operations and runners from the events they
+// publish and serves them in the Prometheus text exposition format.
+//
+// Operations are measured per workspace and repository, the events published
+// for the workspace as a whole are not counted.
+type Metrics struct {
+	sub  *events.Subscription
+	done chan struct{}
+	// now returns the current time, it is replaced in tests.
+	now func() time.Time
+
+	mu         sync.Mutex
+	operations *family
+	failures   *family
+	durations  *family
+	bytes      *family
+	restarts   *family
+	runnerUp   *family
+	uptime     *family
+	lastSync   *family
+	syncLag    *family
+	dropped    *family
+	// started is when each running operation started, by operation, workspace and repository.
+	started map[[3]string]time.Time
+	// runners is when each running runner started, by workspace and runner.
+	runners map[[2]string]time.Time
+	// synced is when each repository was last brought up to date, by workspace and repository.
+	synced map[[2]string]time.Time
+}
+
+// NewMetrics creates metrics and starts collecting them, call Close to stop.
+//
+// Arguments:
+//   - args: The arguments for the metrics.
+//
+// Returns:
+//   - *Metrics: The metrics.
+func NewMetrics(args MetricsArgs) *Metrics {
+	bus := args.Bus
+	if bus == nil {
+		bus = events.Default
+	}
+
+	m := &Metrics{
+		done:       make(chan struct{}),
+		now:        time.Now,
+		operations: newFamily("polyrepo_operations_total", "Repository operations completed.", counterType, "operation", "workspace", "repository"),
+		failures:   newFamily("polyrepo_operation_failures_total", "Repository operations that failed.", counterType, "operation", "workspace", "repository"),
+		durations:  newHistogram("polyrepo_operation_duration_seconds", "Duration of repository operations.", DurationBuckets, "operation", "workspace", "repository"),
+		bytes:      newFamily("polyrepo_operation_received_bytes_total", "Bytes received from remotes by repository operations.", counterType, "operation", "workspace", "repository"),
+		restarts:   newFamily("polyrepo_runner_restarts_total", "Times a runner was restarted.", counterType, "workspace", "runner"),
+		runnerUp:   newFamily("polyrepo_runner_up", "Whether a runner is running.", gaugeType, "workspace", "runner"),
+		uptime:     newFamily("polyrepo_runner_uptime_seconds", "Time since a running runner was started.", gaugeType, "workspace", "runner"),
+		lastSync:   newFamily("polyrepo_repository_last_sync_timestamp_seconds", "Unix time a repository was last brought up to date with its remote.", gaugeType, "workspace", "repository"),
+		syncLag:    newFamily("polyrepo_repository_sync_lag_seconds", "Time since a repository was last brought up to date with its remote.", gaugeType, "workspace", "repository"),
+		dropped:    newFamily("polyrepo_metrics_dropped_events_total", "Events the metrics missed because they did not keep up.", counterType),
+		started:    make(map[[3]string]time.Time),
+		runners:    make(map[[2]string]time.Time),
+		synced:     make(map[[2]string]time.Time),
+	}
+
+	if args.Config != nil && args.Config.Workspaces != nil {
+		for _, workspace := range *args.Config.Workspaces {
+			if workspace.Repositories == nil {
+				continue
+			}
+			for _, repo := range *workspace.Repositories {
+				if !repo.Synced.IsZero() {
+					m.synced[[2]string{workspace.Name, repo.Name}] = repo.Synced
+				}
+			}
+		}
+	}
+
+	m.sub = bus.Subscribe(args.Buffer, events.OperationStarted, events.OperationProgress, events.OperationFinished, events.RunnerState)
+	go m.collect()
+	return m
+}
+
+// Close stops collecting metrics, the metrics collected so far can still be written.
+func (m *Metrics) Close() {
+	m.sub.Close()
+	<-m.done
+}
+
+func (m *Metrics) collect() {
+	defer close(m.done)
+	for event := range m.sub.C {
+		m.mu.Lock()
+		m.record(event)
+		m.mu.Unlock()
+	}
+}
+
+// record updates the metrics with an event, m.mu must be held.
+func (m *Metrics) record(event events.Event) {
+	switch event.Type {
+	case events.OperationStarted:
+		if event.Repository != "" {
+			m.started[[3]string{event.Operation, event.Workspace, event.Repository}] = event.Time
+		}
+	case events.OperationProgress:
+		if event.Bytes > 0 {
+			m.bytes.with(event.Operation, event.Workspace, event.Repository).value += float64(event.Bytes)
+		}
+		// A sync or pull that left the repository dirty, diverged or on another
+		// branch finishes without an error but did not bring it up to date.
+		if syncedStates[event.State] {
+			m.synced[[2]string{event.Workspace, event.Repository}] = event.Time
+		}
+	case events.OperationFinished:
+		if event.Repository == "" {
+			return
+		}
+		labels := []string{event.Operation, event.Workspace, event.Repository}
+		m.operations.with(labels...).value++
+		if event.Error != "" {
+			m.failures.with(labels...).value++
+		}
+		// Repositories skipped because a dependency failed finish without starting.
+		key := [3]string{event.Operation, event.Workspace, event.Repository}
+		if started, ok := m.started[key]; ok {
+			m.durations.observe(event.Time.Sub(started).Seconds(), labels...)
+			delete(m.started, key)
+		}
+	case events.RunnerState:
+		key := [2]string{event.Workspace, event.Runner}
+		m.restarts.with(key[:]...).value = float64(event.Restarts)
+		// The status is a commands.RunnerStatus, which cannot be imported here.
+		running := event.Status == "running"
+		if _, ok := m.runners[key]; ok && !running {
+			delete(m.runners, key)
+		} else if !ok && running {
+			m.runners[key] = event.Time
+		}
+		m.runnerUp.with(key[:]...).value = 0
+		if running {
+			m.runnerUp.with(key[:]...).value = 1
+		}
+	}
+}
+
+// Write writes the metrics in the Prometheus text exposition format.
+//
+// Arguments:
+//   - w: The writer to write the metrics to.
+//
+// Returns:
+//   - error: An error if the metrics could not be written.
+func (m *Metrics) Write(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.uptime.reset()
+	for key, started := range m.runners {
+		m.uptime.with(key[:]...).value = now.Sub(started).Seconds()
+	}
+	m.lastSync.reset()
+	m.syncLag.reset()
+	for key, synced := range m.synced {
+		m.lastSync.with(key[:]...).value = float64(synced.UnixMilli()) / 1000
+		m.syncLag.with(key[:]...).value = now.Sub(synced).Seconds()
+	}
+	m.dropped.reset()
+	if dropped := m.sub.Dropped(); dropped > 0 {
+		m.dropped.with().value = float64(dropped)
+	}
+
+	for _, f := range []*family{
+		m.operations, m.failures, m.durations, m.bytes,
+		m.restarts, m.runnerUp, m.uptime,
+		m.lastSync, m.syncLag, m.dropped,
+	} {
+		if err := f.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServeHTTP serves the metrics so they can be scraped by Prometheus, to
+// expose them without the API server mount Metrics in any http.ServeMux.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	if err := m.Write(&buf); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		multilog.Debug("monitoring", "failed to write metrics", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
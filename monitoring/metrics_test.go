@@ -0,0 +1,137 @@
+package monitoring
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert"
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/events"
+	"github.com/polyrepopro/api/git"
+)
+
+// scrape waits until the metrics contain every line and returns them.
+func scrape(t *testing.T, m *Metrics, lines ...string) string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var b strings.Builder
+		assert.NoError(t, m.Write(&b))
+		missing := ""
+		for _, line := range lines {
+			if !strings.Contains(b.String(), line+"\n") {
+				missing = line
+				break
+			}
+		}
+		if missing == "" {
+			return b.String()
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("metrics do not contain %q:\n%s", missing, b.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	synced := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	bus := events.NewBus()
+	m := NewMetrics(MetricsArgs{
+		Bus: bus,
+		Config: &config.Config{Workspaces: &[]config.Workspace{{
+			Name:         "test",
+			Repositories: &[]config.Repository{{Name: "web", Synced: synced}},
+		}}},
+	})
+	defer m.Close()
+	now := time.Date(2024, 1, 1, 0, 10, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	start := now.Add(-time.Minute)
+	bus.Publish(events.Event{Time: start, Type: events.OperationStarted, Operation: "pull", Workspace: "test"})
+	bus.Publish(events.Event{Time: start, Type: events.OperationStarted, Operation: "pull", Workspace: "test", Repository: "api"})
+	bus.Publish(events.Event{Type: events.OperationProgress, Operation: "pull", Workspace: "test", Repository: "api", Bytes: 1024})
+	bus.Publish(events.Event{Time: start.Add(3 * time.Second), Type: events.OperationProgress, Operation: "pull", Workspace: "test", Repository: "api", State: "up-to-date"})
+	bus.Publish(events.Event{Time: start.Add(3 * time.Second), Type: events.OperationFinished, Operation: "pull", Workspace: "test", Repository: "api"})
+	// A sync that leaves a repository diverged succeeds without syncing it.
+	bus.Publish(events.Event{Time: start, Type: events.OperationStarted, Operation: "sync", Workspace: "test", Repository: "docs"})
+	bus.Publish(events.Event{Time: start, Type: events.OperationProgress, Operation: "sync", Workspace: "test", Repository: "docs", State: "diverged"})
+	bus.Publish(events.Event{Time: start, Type: events.OperationFinished, Operation: "sync", Workspace: "test", Repository: "docs"})
+	bus.Publish(events.Event{Time: start, Type: events.OperationStarted, Operation: "push", Workspace: "test", Repository: `we"b`})
+	bus.Publish(events.Event{Time: start.Add(time.Second / 2), Type: events.OperationFinished, Operation: "push", Workspace: "test", Repository: `we"b`, Error: "rejected"})
+	bus.Publish(events.Event{Time: start, Type: events.OperationFinished, Operation: "pull", Workspace: "test"})
+	bus.Publish(events.Event{Time: now.Add(-30 * time.Second), Type: events.RunnerState, Workspace: "test", Runner: "api/server", Status: "running", Restarts: 2})
+	bus.Publish(events.Event{Time: now, Type: events.RunnerState, Workspace: "test", Runner: "web/server", Status: "backoff", Restarts: 1})
+
+	out := scrape(t, m,
+		`polyrepo_operations_total{operation="pull",workspace="test",repository="api"} 1`,
+		`polyrepo_operations_total{operation="push",workspace="test",repository="we\"b"} 1`,
+		`polyrepo_operation_failures_total{operation="push",workspace="test",repository="we\"b"} 1`,
+		`polyrepo_operation_duration_seconds_bucket{operation="pull",workspace="test",repository="api",le="2.5"} 0`,
+		`polyrepo_operation_duration_seconds_bucket{operation="pull",workspace="test",repository="api",le="5"} 1`,
+		`polyrepo_operation_duration_seconds_bucket{operation="pull",workspace="test",repository="api",le="+Inf"} 1`,
+		`polyrepo_operation_duration_seconds_sum{operation="pull",workspace="test",repository="api"} 3`,
+		`polyrepo_operation_duration_seconds_count{operation="pull",workspace="test",repository="api"} 1`,
+		`polyrepo_operation_received_bytes_total{operation="pull",workspace="test",repository="api"} 1024`,
+		`polyrepo_runner_restarts_total{workspace="test",runner="api/server"} 2`,
+		`polyrepo_runner_up{workspace="test",runner="api/server"} 1`,
+		`polyrepo_runner_up{workspace="test",runner="web/server"} 0`,
+		`polyrepo_runner_uptime_seconds{workspace="test",runner="api/server"} 30`,
+		`polyrepo_repository_sync_lag_seconds{workspace="test",repository="api"} 57`,
+		`polyrepo_repository_sync_lag_seconds{workspace="test",repository="web"} 600`,
+		`polyrepo_repository_last_sync_timestamp_seconds{workspace="test",repository="web"} 1.7040672e+09`,
+		"# TYPE polyrepo_operation_duration_seconds histogram",
+	)
+	// Workspace level events and runners that are not running are not measured.
+	assert.NotContains(t, out, `repository=""`)
+	assert.NotContains(t, out, `polyrepo_repository_sync_lag_seconds{workspace="test",repository="docs"}`)
+	assert.NotContains(t, out, `polyrepo_runner_uptime_seconds{workspace="test",runner="web/server"}`)
+	assert.NotContains(t, out, "polyrepo_metrics_dropped_events_total")
+
+	res := httptest.NewRecorder()
+	m.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", res.Header().Get("Content-Type"))
+	assert.Equal(t, out, res.Body.String())
+}
+
+func TestMetricsReceivedBytes(t *testing.T) {
+	base := t.TempDir()
+	upstream := filepath.Join(base, "upstream")
+	clone := filepath.Join(base, "clone")
+	run := func(dir string, args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com", "GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		out, err := cmd.CombinedOutput()
+		assert.NoError(t, err, string(out))
+	}
+	run("", "init", "-q", "-b", "main", upstream)
+	run(upstream, "commit", "-q", "--allow-empty", "-m", "initial")
+	run("", "clone", "-q", upstream, clone)
+	assert.NoError(t, os.WriteFile(filepath.Join(upstream, "data.txt"), []byte(strings.Repeat("polyrepo\n", 1000)), 0644))
+	run(upstream, "add", "data.txt")
+	run(upstream, "commit", "-q", "-m", "data")
+
+	bus := events.NewBus()
+	m := NewMetrics(MetricsArgs{Bus: bus})
+	defer m.Close()
+
+	assert.NoError(t, git.Fetch(context.Background(), git.FetchArgs{
+		URL:      upstream,
+		Remote:   "origin",
+		Path:     clone,
+		Progress: bus.NewProgress("fetch", "test", "clone"),
+	}))
+	out := scrape(t, m, "# TYPE polyrepo_operation_received_bytes_total counter")
+	assert.True(t, regexp.MustCompile(`polyrepo_operation_received_bytes_total\{operation="fetch",workspace="test",repository="clone"\} [1-9]\d*\n`).MatchString(out), out)
+}
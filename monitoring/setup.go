@@ -1,10 +1,43 @@
 package monitoring
 
-import "github.com/mateothegreat/go-multilog/multilog"
+import (
+	"fmt"
 
-func Setup() {
-	multilog.RegisterLogger(multilog.LogMethod("console"), multilog.NewConsoleLogger(&multilog.NewConsoleLoggerArgs{
-		Level:  multilog.DEBUG,
-		Format: multilog.FormatText,
-	}))
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/history"
+	"github.com/polyrepopro/api/logs"
+)
+
+// Setup configures logging from the logging section of the config and opens
+// the history that operations changing repositories are recorded in.
+//
+// Arguments:
+//   - cfg: The config, logging falls back to the defaults of logs.Setup and the
+//     history to history.DefaultPath when it is nil or has no such section.
+//
+// Returns:
+//   - error: An error if the logging config is invalid, a log file could not be opened or the history directory could not be created.
+func Setup(cfg *config.Config) error {
+	var logging *logs.Config
+	settings := &config.History{}
+	if cfg != nil {
+		logging = cfg.Logging
+		if cfg.History != nil {
+			settings = cfg.History
+		}
+	}
+	if err := logs.Setup(logging); err != nil {
+		return err
+	}
+
+	if settings.Disabled {
+		history.SetDefault(nil)
+		return nil
+	}
+	store, err := history.Open(settings.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+	history.SetDefault(store)
+	return nil
 }
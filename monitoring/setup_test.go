@@ -0,0 +1,27 @@
+package monitoring
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert"
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/history"
+	"github.com/polyrepopro/api/logs"
+	"github.com/polyrepopro/api/test"
+)
+
+func TestSetup(t *testing.T) {
+	defer test.Setup()
+	defer history.SetDefault(nil)
+
+	path := filepath.Join(t.TempDir(), "state", "history.jsonl")
+	assert.NoError(t, Setup(&config.Config{History: &config.History{Path: path}}))
+	assert.NotZero(t, history.Default())
+	assert.Equal(t, path, history.Default().Path())
+
+	assert.NoError(t, Setup(&config.Config{History: &config.History{Disabled: true}}))
+	assert.Zero(t, history.Default())
+
+	assert.Error(t, Setup(&config.Config{Logging: &logs.Config{Level: "loud"}}))
+}
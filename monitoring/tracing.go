@@ -0,0 +1,104 @@
+package monitoring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mateothegreat/go-util/files"
+	"github.com/polyrepopro/api/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// SetupTracing installs a global tracer provider that exports the spans of
+// workspace operations as configured. Every workspace operation is traced as
+// a parent span with a child span per repository, which in turn has child
+// spans for its git steps (auth resolution, clone, fetch, pull, push,
+// checkout) and hook commands.
+//
+// Arguments:
+//   - cfg: The tracing config, tracing stays disabled when it is nil or has no exporter.
+//
+// Returns:
+//   - func(context.Context) error: Flushes the remaining spans and stops the exporter, call it before exiting.
+//   - error: An error if the exporter could not be created.
+func SetupTracing(cfg *config.Tracing) (func(context.Context) error, error) {
+	if cfg == nil || cfg.Exporter == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	var exporter sdktrace.SpanExporter
+	var closers []func() error
+	switch cfg.Exporter {
+	case config.OTLPExporter:
+		otlp, err := newOTLPExporter(cfg.GetEndpoint(), cfg.Headers)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+		exporter = otlp
+	case config.StdoutExporter:
+		stdout, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stdout exporter: %w", err)
+		}
+		exporter = stdout
+	case config.FileExporter:
+		f, err := os.OpenFile(files.ExpandPath(cfg.File), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open trace file: %w", err)
+		}
+		file, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to create file exporter: %w", err)
+		}
+		exporter = file
+		closers = append(closers, f.Close)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", cfg.GetServiceName()),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	sampler := sdktrace.AlwaysSample()
+	if cfg.SampleRatio > 0 {
+		sampler = sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sampler),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		for _, closer := range closers {
+			err = errors.Join(err, closer())
+		}
+		return err
+	}, nil
+}
+
+// newOTLPExporter creates an exporter sending spans to the /v1/traces path of
+// an OTLP/HTTP receiver.
+func newOTLPExporter(endpoint string, headers map[string]string) (sdktrace.SpanExporter, error) {
+	return otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpointURL(strings.TrimSuffix(endpoint, "/")+"/v1/traces"),
+		otlptracehttp.WithHeaders(headers),
+	)
+}
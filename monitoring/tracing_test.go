@@ -0,0 +1,159 @@
+package monitoring
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert"
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/workspaces"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// stdoutSpan holds the fields of a span written by the stdout and file exporters.
+type stdoutSpan struct {
+	Name        string
+	SpanContext struct{ SpanID string }
+	Parent      struct{ SpanID string }
+}
+
+func TestTracingFile(t *testing.T) {
+	defer otel.SetTracerProvider(otel.GetTracerProvider())
+
+	base := t.TempDir()
+	upstream := filepath.Join(base, "upstream")
+	run := func(dir string, args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com", "GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		out, err := cmd.CombinedOutput()
+		assert.NoError(t, err, string(out))
+	}
+	run("", "init", "-q", "-b", "main", upstream)
+	run(upstream, "commit", "-q", "--allow-empty", "-m", "initial")
+	run("", "clone", "-q", upstream, filepath.Join(base, "workspace", "api"))
+
+	file := filepath.Join(base, "traces.json")
+	shutdown, err := SetupTracing(&config.Tracing{Exporter: config.FileExporter, File: file})
+	assert.NoError(t, err)
+
+	workspace := &config.Workspace{
+		Name: "test",
+		Path: filepath.Join(base, "workspace"),
+		Repositories: &[]config.Repository{{
+			Name: "api",
+			URL:  upstream,
+			Path: "api",
+			Hooks: &[]config.Hook{{
+				Type:     config.PullHook,
+				Commands: []config.Command{{Name: "greet", Shell: "echo hello"}},
+			}},
+		}},
+	}
+	assert.Equal(t, 0, len(workspaces.Fetch(workspaces.FetchArgs{Workspace: workspace})))
+	assert.Equal(t, 0, len(workspaces.RunHooks(workspaces.RunHooksArgs{Workspace: workspace, Type: config.PullHook})))
+	assert.NoError(t, shutdown(context.Background()))
+
+	f, err := os.Open(file)
+	assert.NoError(t, err)
+	defer f.Close()
+	spans := make(map[string]stdoutSpan)
+	decoder := json.NewDecoder(f)
+	for {
+		var span stdoutSpan
+		if err := decoder.Decode(&span); errors.Is(err, io.EOF) {
+			break
+		} else {
+			assert.NoError(t, err)
+		}
+		spans[span.Name] = span
+	}
+
+	parent := func(name string) string {
+		span, ok := spans[name]
+		assert.True(t, ok, "missing span %s in %v", name, spans)
+		for _, candidate := range spans {
+			if candidate.SpanContext.SpanID == span.Parent.SpanID {
+				return candidate.Name
+			}
+		}
+		return ""
+	}
+	assert.Equal(t, "", parent("workspace.fetch"))
+	assert.Equal(t, "workspace.fetch", parent("repository.fetch"))
+	assert.Equal(t, "repository.fetch", parent("git.fetch"))
+	assert.Equal(t, "git.fetch", parent("git.auth"))
+	assert.Equal(t, "", parent("workspace.hooks"))
+	assert.Equal(t, "workspace.hooks", parent("repository.hooks"))
+	assert.Equal(t, "repository.hooks", parent("hook.pull"))
+	assert.Equal(t, "hook.pull", parent("command greet"))
+}
+
+func TestTracingOTLP(t *testing.T) {
+	var requests []*coltracepb.ExportTraceServiceRequest
+	var headers http.Header
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		headers = r.Header
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		request := &coltracepb.ExportTraceServiceRequest{}
+		assert.NoError(t, proto.Unmarshal(body, request))
+		requests = append(requests, request)
+	}))
+	defer receiver.Close()
+
+	exporter, err := newOTLPExporter(receiver.URL+"/", map[string]string{"Authorization": "Bearer token"})
+	assert.NoError(t, err)
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracer := provider.Tracer("test")
+	ctx, parent := tracer.Start(context.Background(), "workspace.pull")
+	_, child := tracer.Start(ctx, "repository.pull")
+	child.SetAttributes(
+		attribute.String("polyrepo.repository", "api"),
+		attribute.Int("count", 3),
+	)
+	child.SetStatus(codes.Error, "failed")
+	child.End()
+	parent.End()
+	assert.NoError(t, provider.Shutdown(context.Background()))
+
+	assert.Equal(t, "application/x-protobuf", headers.Get("Content-Type"))
+	assert.Equal(t, "Bearer token", headers.Get("Authorization"))
+	// The syncer exports every span when it ends.
+	assert.Equal(t, 2, len(requests))
+	assert.Equal(t, 1, len(requests[0].ResourceSpans))
+	scopes := requests[0].ResourceSpans[0].ScopeSpans
+	assert.Equal(t, "test", scopes[0].Scope.Name)
+	span := scopes[0].Spans[0]
+	assert.Equal(t, "repository.pull", span.Name)
+	parentID := parent.SpanContext().SpanID()
+	traceID := parent.SpanContext().TraceID()
+	assert.Equal(t, parentID[:], span.ParentSpanId)
+	assert.Equal(t, traceID[:], span.TraceId)
+	assert.Equal(t, tracepb.Status_STATUS_CODE_ERROR, span.Status.Code)
+	assert.Equal(t, "failed", span.Status.Message)
+	assert.Equal(t, 2, len(span.Attributes))
+	assert.Equal(t, "api", span.Attributes[0].Value.GetStringValue())
+	assert.Equal(t, int64(3), span.Attributes[1].Value.GetIntValue())
+
+	_, err = SetupTracing(&config.Tracing{Exporter: "zipkin"})
+	assert.Error(t, err)
+	shutdown, err := SetupTracing(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+}
@@ -0,0 +1,54 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/events"
+	"github.com/polyrepopro/api/git"
+)
+
+// CloneArgs are the arguments for cloning a repository into its workspace.
+type CloneArgs struct {
+	Workspace  *config.Workspace
+	Repository *config.Repository
+	Auth       *config.Auth
+	// Context carries the trace the clone is part of and cancels it, nil uses context.Background().
+	Context context.Context
+}
+
+// Clone clones a repository into its path in the workspace.
+// The clone is published as a "clone" operation of the repository, with
+// OperationStarted and OperationFinished events around the progress of the
+// transfer, so it is measured like the operations run across a workspace.
+//
+// Arguments:
+//   - args: The arguments for the clone.
+//
+// Returns:
+//   - error: An error if the repository could not be cloned.
+func Clone(args CloneArgs) error {
+	event := events.Event{
+		Operation:  "clone",
+		Workspace:  args.Workspace.Name,
+		Repository: args.Repository.Name,
+	}
+	event.Type = events.OperationStarted
+	events.Publish(event)
+
+	err := git.Clone(git.CloneArgs{
+		URL:      args.Repository.URL,
+		Path:     fmt.Sprintf("%s/%s", args.Workspace.GetAbsolutePath(), args.Repository.Path),
+		Auth:     args.Auth,
+		Progress: events.NewProgress("clone", args.Workspace.Name, args.Repository.Name),
+		Context:  args.Context,
+	})
+
+	event.Type = events.OperationFinished
+	if err != nil {
+		event.Error = err.Error()
+	}
+	events.Publish(event)
+	return err
+}
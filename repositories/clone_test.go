@@ -0,0 +1,46 @@
+package repositories
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert"
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/events"
+)
+
+func TestClone(t *testing.T) {
+	base := t.TempDir()
+	remote := filepath.Join(base, "remote")
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main", remote},
+		{"-C", remote, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "initial"},
+	} {
+		out, err := exec.Command("git", args...).CombinedOutput()
+		assert.NoError(t, err, string(out))
+	}
+
+	workspace := &config.Workspace{Name: "test", Path: filepath.Join(base, "workspace")}
+	sub := events.Default.Subscribe(0, events.OperationStarted, events.OperationFinished)
+	defer sub.Close()
+
+	assert.NoError(t, Clone(CloneArgs{Workspace: workspace, Repository: &config.Repository{Name: "api", Path: "api", URL: remote}}))
+	assert.Error(t, Clone(CloneArgs{Workspace: workspace, Repository: &config.Repository{Name: "web", Path: "web", URL: filepath.Join(base, "missing")}}))
+
+	var received []events.Event
+	for len(sub.C) > 0 {
+		received = append(received, <-sub.C)
+	}
+	assert.Equal(t, 4, len(received))
+	for i, repository := range []string{"api", "api", "web", "web"} {
+		assert.Equal(t, "clone", received[i].Operation)
+		assert.Equal(t, "test", received[i].Workspace)
+		assert.Equal(t, repository, received[i].Repository)
+	}
+	assert.Equal(t, events.OperationStarted, received[0].Type)
+	assert.Equal(t, events.OperationFinished, received[1].Type)
+	assert.Equal(t, "", received[1].Error)
+	assert.Equal(t, events.OperationFinished, received[3].Type)
+	assert.NotEqual(t, "", received[3].Error)
+}
@@ -0,0 +1,64 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/events"
+	"github.com/polyrepopro/api/git"
+)
+
+// FastForwardArgs are the arguments for fetching and fast-forwarding a repository.
+type FastForwardArgs struct {
+	Workspace  *config.Workspace
+	Repository *config.Repository
+	// Operation is the operation the progress events are published for, empty uses "pull".
+	Operation string
+}
+
+// FastForward fetches the remote of a repository and fast-forwards its checked
+// out branch when the worktree is clean and the configured branch, if any, is
+// checked out. Unlike Pull it never merges or overwrites local commits.
+//
+// Arguments:
+//   - ctx: The context, cancelling it aborts the fetch.
+//   - args: The arguments for the fast-forward.
+//
+// Returns:
+//   - git.FastForwardResult: The outcome, its state is empty if the fetch failed.
+//   - error: An error if the repository could not be fetched or updated.
+func FastForward(ctx context.Context, args FastForwardArgs) (git.FastForwardResult, error) {
+	path := fmt.Sprintf("%s/%s", args.Workspace.GetAbsolutePath(), args.Repository.Path)
+	remote := args.Repository.Origin
+	if remote == "" {
+		remote = "origin"
+	}
+	operation := args.Operation
+	if operation == "" {
+		operation = "pull"
+	}
+
+	progress := events.NewProgress(operation, args.Workspace.Name, args.Repository.Name)
+	err := git.Fetch(ctx, git.FetchArgs{
+		URL:      args.Repository.URL,
+		Remote:   remote,
+		Path:     path,
+		Auth:     args.Repository.Auth,
+		Progress: progress,
+	})
+	if err != nil {
+		return git.FastForwardResult{}, err
+	}
+
+	result, err := git.FastForward(git.FastForwardArgs{
+		Path:    path,
+		Remote:  remote,
+		Branch:  args.Repository.Branch,
+		Context: ctx,
+	})
+	if result.State != "" {
+		progress.State(string(result.State))
+	}
+	return result, err
+}
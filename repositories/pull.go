@@ -6,6 +6,7 @@ import (
 
 	"github.com/mateothegreat/go-multilog/multilog"
 	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/events"
 	"github.com/polyrepopro/api/git"
 )
 
@@ -33,31 +34,41 @@ func Pull(args PullArgs) error {
 			"url":  args.Repository.URL,
 		})
 
-		err = git.Clone(git.CloneArgs{
-			URL:  args.Repository.URL,
-			Path: fmt.Sprintf("%s/%s", args.Workspace.GetAbsolutePath(), args.Repository.Path),
-			Auth: args.Auth,
+		err = Clone(CloneArgs{
+			Workspace:  args.Workspace,
+			Repository: args.Repository,
+			Auth:       args.Auth,
+			Context:    args.Context,
 		})
 		if err != nil {
-			multilog.Fatal("repositories.pull", "failed to clone repository", map[string]interface{}{
-				"repository": args,
-			})
-			return err
+			return fmt.Errorf("failed to clone repository: %w", err)
 		}
 
 		multilog.Info("repositories.pull", "✅ cloned repository", map[string]interface{}{
 			"repository": args,
 		})
+		events.NewProgress("pull", args.Workspace.Name, args.Repository.Name).State(string(git.FastForwardUpdated))
 	} else {
+		path := fmt.Sprintf("%s/%s", args.Workspace.Path, args.Repository.Path)
+		_, before, _ := git.HeadRef(path)
+		progress := events.NewProgress("pull", args.Workspace.Name, args.Repository.Name)
 		err = git.Pull(git.PullArgs{
-			Path:   fmt.Sprintf("%s/%s", args.Workspace.Path, args.Repository.Path),
-			Remote: args.Remote,
-			URL:    args.Repository.URL,
-			Auth:   args.Auth,
+			Path:     path,
+			Remote:   args.Remote,
+			URL:      args.Repository.URL,
+			Auth:     args.Auth,
+			Progress: progress,
+			Context:  args.Context,
 		})
 		if err != nil {
 			return fmt.Errorf("failed to pull remote %q: %w", args.Remote, err)
 		}
+		// A pull only succeeds when it fast-forwards the branch or it is already up to date.
+		state := git.FastForwardUpToDate
+		if _, after, _ := git.HeadRef(path); after != before {
+			state = git.FastForwardUpdated
+		}
+		progress.State(string(state))
 	}
 	return nil
 }
@@ -6,6 +6,7 @@ import (
 
 	"github.com/mateothegreat/go-multilog/multilog"
 	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/events"
 	"github.com/polyrepopro/api/git"
 )
 
@@ -40,10 +41,13 @@ func Push(args PushArgs) error {
 		"url":    args.Repository.URL,
 	})
 	err := git.Push(git.PushArgs{
-		Path:   fmt.Sprintf("%s/%s", args.Workspace.Path, args.Repository.Path),
-		Remote: r,
-		URL:    args.Repository.URL,
-		Auth:   args.Repository.Auth,
+		Path:     fmt.Sprintf("%s/%s", args.Workspace.Path, args.Repository.Path),
+		Remote:   r,
+		URL:      args.Repository.URL,
+		Auth:     args.Repository.Auth,
+		RefSpecs: args.RefSpecs,
+		Progress: events.NewProgress("push", args.Workspace.Name, args.Repository.Name),
+		Context:  args.Context,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to push remote %q: %w", r, err)
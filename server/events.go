@@ -0,0 +1,67 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/polyrepopro/api/events"
+)
+
+// keepAliveInterval is the time between comments sent on an idle event stream
+// so that proxies and clients do not time the connection out.
+const keepAliveInterval = 15 * time.Second
+
+// streamEvents streams events as server-sent events until the client disconnects.
+// The "types" query parameter is a comma separated list of event types and the
+// "workspace" query parameter limits the stream to the events of a workspace.
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return newError(http.StatusInternalServerError, "streaming is not supported")
+	}
+
+	var types []events.Type
+	if value := r.URL.Query().Get("types"); value != "" {
+		for _, typ := range strings.Split(value, ",") {
+			types = append(types, events.Type(strings.TrimSpace(typ)))
+		}
+	}
+	workspace := r.URL.Query().Get("workspace")
+
+	sub := s.bus.Subscribe(0, types...)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-s.ctx.Done():
+			return nil
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case event := <-sub.C:
+			if workspace != "" && event.Workspace != workspace {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+		}
+		flusher.Flush()
+	}
+}
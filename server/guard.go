@@ -0,0 +1,69 @@
+package server
+
+import (
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// guard rejects the requests that do not come from a local client, and the
+// requests a web page could make a browser send to the API.
+// A page on another origin cannot read the responses, but without these checks
+// it could still start operations with a simple cross-origin POST, or reach the
+// API through a DNS name it rebinds to the loopback address:
+//   - the client must connect from and address a loopback address, unless the API is served on a Unix socket,
+//   - a browser Origin header must be the origin of the API itself,
+//   - POST bodies must be sent as application/json, which a page can only do after a CORS preflight the API does not answer.
+func (s *Server) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A server that allows remote connections for webhooks still only serves
+		// the API to local clients.
+		if s.socket == "" && !loopbackHost(r.RemoteAddr) {
+			writeError(w, newError(http.StatusForbidden, "the API is only served to loopback clients"))
+			return
+		}
+		if s.socket == "" && !loopbackHost(r.Host) {
+			writeError(w, newError(http.StatusForbidden, "host %q is not a loopback address", r.Host))
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" && !sameOrigin(origin, r.Host) {
+			writeError(w, newError(http.StatusForbidden, "origin %q is not allowed", origin))
+			return
+		}
+		if r.Method == http.MethodPost {
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || mediaType != "application/json" {
+				writeError(w, newError(http.StatusUnsupportedMediaType, "content type must be application/json"))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// loopbackHost reports whether the host of a Host header or remote address is localhost or a loopback address.
+func loopbackHost(hostport string) bool {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		// The port is optional.
+		host = hostport
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	if ip == nil && len(host) > 2 && host[0] == '[' && host[len(host)-1] == ']' {
+		ip = net.ParseIP(host[1 : len(host)-1])
+	}
+	return ip != nil && ip.IsLoopback()
+}
+
+// sameOrigin reports whether a browser Origin header is the origin of the API served on host.
+func sameOrigin(origin string, host string) bool {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host == host
+}
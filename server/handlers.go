@@ -0,0 +1,308 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/repositories"
+	"github.com/polyrepopro/api/workspaces"
+)
+
+// WorkspaceInfo describes a workspace.
+type WorkspaceInfo struct {
+	Name         string   `json:"name"`
+	Path         string   `json:"path"`
+	Tags         []string `json:"tags,omitempty"`
+	Repositories int      `json:"repositories"`
+}
+
+// RepositoryInfo describes a repository of a workspace.
+type RepositoryInfo struct {
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	Path      string    `json:"path"`
+	Branch    string    `json:"branch,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	DependsOn []string  `json:"dependsOn,omitempty"`
+	Synced    time.Time `json:"synced,omitempty"`
+}
+
+// RepositoryStatus is the working tree and remote status of a repository.
+type RepositoryStatus struct {
+	Repository string                  `json:"repository"`
+	Code       repositories.StatusCode `json:"code"`
+	Message    string                  `json:"message"`
+	Ahead      int                     `json:"ahead"`
+	Behind     int                     `json:"behind"`
+	NeedsPush  bool                    `json:"needsPush"`
+	NeedsPull  bool                    `json:"needsPull"`
+}
+
+// OperationRequest is the body of the requests that start an operation.
+type OperationRequest struct {
+	// Selector is a repository selector expression, empty selects every repository.
+	Selector string `json:"selector,omitempty"`
+	// Branch is the branch to switch to.
+	Branch string `json:"branch,omitempty"`
+	// Message is the commit message.
+	Message string `json:"message,omitempty"`
+	// Ordered operates on repositories after the repositories they depend on.
+	Ordered bool `json:"ordered,omitempty"`
+	// Parallelism is the maximum number of repositories operated on at once,
+	// zero means no limit.
+	Parallelism int `json:"parallelism,omitempty"`
+}
+
+// operation runs a workspace operation as a job.
+type operation func(ctx context.Context, workspace *config.Workspace, req OperationRequest, selector *config.Selector) (any, []error)
+
+func (s *Server) routes() {
+	s.mux.HandleFunc("GET /workspaces", s.handle(s.listWorkspaces))
+	s.mux.HandleFunc("GET /workspaces/{workspace}/repositories", s.handle(s.listRepositories))
+	s.mux.HandleFunc("GET /workspaces/{workspace}/status", s.handle(s.status))
+
+	s.mux.HandleFunc("POST /workspaces/{workspace}/fetch", s.handle(s.operation("fetch", fetch)))
+	s.mux.HandleFunc("POST /workspaces/{workspace}/pull", s.handle(s.operation("pull", pull)))
+	s.mux.HandleFunc("POST /workspaces/{workspace}/push", s.handle(s.operation("push", push)))
+	s.mux.HandleFunc("POST /workspaces/{workspace}/switch", s.handle(s.operation("switch", switchBranch)))
+	s.mux.HandleFunc("POST /workspaces/{workspace}/commit", s.handle(s.operation("commit", commit)))
+
+	s.mux.HandleFunc("GET /workspaces/{workspace}/runners", s.handle(s.listRunners))
+	s.mux.HandleFunc("POST /workspaces/{workspace}/runners/start", s.handle(s.startRunners))
+	s.mux.HandleFunc("POST /workspaces/{workspace}/runners/stop", s.handle(s.stopRunnersHandler))
+	s.mux.HandleFunc("GET /workspaces/{workspace}/runners/{repository}/{runner}/logs", s.handle(s.runnerLogs))
+
+	s.mux.HandleFunc("GET /jobs", s.handle(s.listJobs))
+	s.mux.HandleFunc("GET /jobs/{id}", s.handle(s.getJob))
+
+	s.mux.HandleFunc("GET /events", s.handle(s.streamEvents))
+	s.mux.Handle("GET /metrics", s.metrics)
+
+	// Webhook deliveries are sent by forges rather than browsers, they are
+	// authenticated with the webhook secret instead of being guarded.
+	s.webhooks = http.NewServeMux()
+	s.webhooks.HandleFunc("POST /webhooks", s.handle(s.webhook))
+
+	handler := http.NewServeMux()
+	handler.Handle("/", s.guard(s.mux))
+	handler.Handle("POST /webhooks", s.webhooks)
+	s.handler = handler
+}
+
+// handle adapts a handler that returns an error to an http.HandlerFunc.
+func (s *Server) handle(fn func(w http.ResponseWriter, r *http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := fn(w, r); err != nil {
+			writeError(w, err)
+		}
+	}
+}
+
+// workspace returns the workspace named in the request path.
+func (s *Server) workspace(r *http.Request) (*config.Workspace, error) {
+	name := r.PathValue("workspace")
+	if s.config.Workspaces != nil {
+		for i := range *s.config.Workspaces {
+			if (*s.config.Workspaces)[i].Name == name {
+				return &(*s.config.Workspaces)[i], nil
+			}
+		}
+	}
+	return nil, newError(http.StatusNotFound, "workspace %s not found", name)
+}
+
+func parseSelector(expr string) (*config.Selector, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	selector, err := config.ParseSelector(expr)
+	if err != nil {
+		return nil, newError(http.StatusBadRequest, "invalid selector: %w", err)
+	}
+	return selector, nil
+}
+
+func (s *Server) listWorkspaces(w http.ResponseWriter, r *http.Request) error {
+	infos := []WorkspaceInfo{}
+	if s.config.Workspaces != nil {
+		for _, workspace := range *s.config.Workspaces {
+			info := WorkspaceInfo{Name: workspace.Name, Path: workspace.Path, Tags: workspace.Tags}
+			if workspace.Repositories != nil {
+				info.Repositories = len(*workspace.Repositories)
+			}
+			infos = append(infos, info)
+		}
+	}
+	writeJSON(w, http.StatusOK, infos)
+	return nil
+}
+
+func (s *Server) listRepositories(w http.ResponseWriter, r *http.Request) error {
+	workspace, err := s.workspace(r)
+	if err != nil {
+		return err
+	}
+	selector, err := parseSelector(r.URL.Query().Get("selector"))
+	if err != nil {
+		return err
+	}
+
+	infos := []RepositoryInfo{}
+	for _, repo := range workspace.SelectRepositories(selector) {
+		infos = append(infos, RepositoryInfo{
+			Name:      repo.Name,
+			URL:       repo.URL,
+			Path:      repo.Path,
+			Branch:    repo.Branch,
+			Tags:      repo.Tags,
+			DependsOn: repo.DependsOn,
+			Synced:    repo.Synced,
+		})
+	}
+	writeJSON(w, http.StatusOK, infos)
+	return nil
+}
+
+func (s *Server) status(w http.ResponseWriter, r *http.Request) error {
+	workspace, err := s.workspace(r)
+	if err != nil {
+		return err
+	}
+	selector, err := parseSelector(r.URL.Query().Get("selector"))
+	if err != nil {
+		return err
+	}
+
+	selected := workspace.SelectRepositories(selector)
+	statuses := make([]RepositoryStatus, len(selected))
+	var wg sync.WaitGroup
+	for i, repo := range selected {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			remote := repo.Origin
+			if remote == "" {
+				remote = "origin"
+			}
+			result := repositories.StatusWithRemote(fmt.Sprintf("%s/%s", workspace.GetAbsolutePath(), repo.Path), remote)
+			statuses[i] = RepositoryStatus{
+				Repository: repo.Name,
+				Code:       result.Code,
+				Message:    result.Message,
+				Ahead:      result.AheadCount,
+				Behind:     result.BehindCount,
+				NeedsPush:  result.NeedsPush,
+				NeedsPull:  result.NeedsPull,
+			}
+		}()
+	}
+	wg.Wait()
+
+	writeJSON(w, http.StatusOK, statuses)
+	return nil
+}
+
+// operation returns a handler that validates the request and starts the operation as a job.
+func (s *Server) operation(name string, op operation) func(w http.ResponseWriter, r *http.Request) error {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		workspace, err := s.workspace(r)
+		if err != nil {
+			return err
+		}
+
+		var req OperationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			return newError(http.StatusBadRequest, "invalid request body: %w", err)
+		}
+		selector, err := parseSelector(req.Selector)
+		if err != nil {
+			return err
+		}
+		if name == "switch" && req.Branch == "" {
+			return newError(http.StatusBadRequest, "branch is required")
+		}
+		if name == "commit" && req.Message == "" {
+			return newError(http.StatusBadRequest, "message is required")
+		}
+
+		job := s.jobs.Submit(s.ctx, name, workspace.Name, func(ctx context.Context) (any, []error) {
+			return op(ctx, workspace, req, selector)
+		})
+		w.Header().Set("Location", "/jobs/"+job.ID)
+		writeJSON(w, http.StatusAccepted, job)
+		return nil
+	}
+}
+
+func fetch(ctx context.Context, workspace *config.Workspace, req OperationRequest, selector *config.Selector) (any, []error) {
+	return nil, workspaces.Fetch(workspaces.FetchArgs{
+		Workspace:   workspace,
+		Selector:    selector,
+		Ordered:     req.Ordered,
+		Parallelism: req.Parallelism,
+		Context:     ctx,
+	})
+}
+
+func pull(ctx context.Context, workspace *config.Workspace, req OperationRequest, selector *config.Selector) (any, []error) {
+	return nil, workspaces.Pull(workspaces.PullArgs{
+		Workspace:   workspace,
+		Selector:    selector,
+		Ordered:     req.Ordered,
+		Parallelism: req.Parallelism,
+		Context:     ctx,
+	})
+}
+
+func push(ctx context.Context, workspace *config.Workspace, req OperationRequest, selector *config.Selector) (any, []error) {
+	return nil, workspaces.Push(workspaces.PushArgs{
+		Workspace:   workspace,
+		Selector:    selector,
+		Ordered:     req.Ordered,
+		Parallelism: req.Parallelism,
+		Context:     ctx,
+	})
+}
+
+func switchBranch(ctx context.Context, workspace *config.Workspace, req OperationRequest, selector *config.Selector) (any, []error) {
+	return nil, workspaces.Switch(workspaces.SwitchArgs{
+		Workspace:   workspace,
+		Branch:      req.Branch,
+		Selector:    selector,
+		Ordered:     req.Ordered,
+		Parallelism: req.Parallelism,
+		Context:     ctx,
+	})
+}
+
+func commit(ctx context.Context, workspace *config.Workspace, req OperationRequest, selector *config.Selector) (any, []error) {
+	return workspaces.Commit(workspaces.CommitArgs{
+		Workspace:   workspace,
+		Message:     req.Message,
+		Selector:    selector,
+		Ordered:     req.Ordered,
+		Parallelism: req.Parallelism,
+		Context:     ctx,
+	})
+}
+
+func (s *Server) listJobs(w http.ResponseWriter, r *http.Request) error {
+	writeJSON(w, http.StatusOK, s.jobs.List())
+	return nil
+}
+
+func (s *Server) getJob(w http.ResponseWriter, r *http.Request) error {
+	job, ok := s.jobs.Get(r.PathValue("id"))
+	if !ok {
+		return newError(http.StatusNotFound, "job %s not found", r.PathValue("id"))
+	}
+	writeJSON(w, http.StatusOK, job)
+	return nil
+}
@@ -0,0 +1,226 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"slices"
+	"sync"
+	"time"
+)
+
+// JobStatus is the status of an asynchronous operation.
+type JobStatus string
+
+const (
+	// JobQueued is a job waiting for an earlier job of its workspace to finish.
+	JobQueued JobStatus = "queued"
+	// JobRunning is a job whose operation is running.
+	JobRunning JobStatus = "running"
+	// JobSucceeded is a job whose operation completed without errors.
+	JobSucceeded JobStatus = "succeeded"
+	// JobFailed is a job whose operation returned at least one error.
+	JobFailed JobStatus = "failed"
+)
+
+// DefaultMaxJobs is the number of finished jobs kept for polling when none is set.
+const DefaultMaxJobs = 100
+
+// Job is a snapshot of an asynchronous operation.
+type Job struct {
+	ID         string     `json:"id"`
+	Operation  string     `json:"operation"`
+	Workspace  string     `json:"workspace"`
+	Status     JobStatus  `json:"status"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	Result     any        `json:"result,omitempty"`
+	Errors     []string   `json:"errors,omitempty"`
+}
+
+// JobFunc is the operation run by a job.
+type JobFunc func(ctx context.Context) (any, []error)
+
+// Jobs runs operations in the background and keeps their outcome for polling.
+// The jobs of a workspace run one at a time in the order they were submitted,
+// since they operate on the same worktrees. It is safe for concurrent use.
+type Jobs struct {
+	max int
+
+	mu    sync.Mutex
+	jobs  map[string]*Job
+	order []string
+	// queues holds the jobs of each workspace that have not finished, the first one is running.
+	queues map[string][]*queuedJob
+	wg     sync.WaitGroup
+}
+
+// queuedJob is a job of a workspace that has not finished.
+type queuedJob struct {
+	// start is closed when the job may run.
+	start chan struct{}
+}
+
+// NewJobs creates a job registry.
+//
+// Arguments:
+//   - max: The number of finished jobs kept, older ones are forgotten. Zero uses DefaultMaxJobs.
+//
+// Returns:
+//   - *Jobs: The registry.
+func NewJobs(max int) *Jobs {
+	if max <= 0 {
+		max = DefaultMaxJobs
+	}
+	return &Jobs{max: max, jobs: make(map[string]*Job), queues: make(map[string][]*queuedJob)}
+}
+
+// Submit starts an operation in the background, or queues it until the
+// earlier jobs of the workspace have finished.
+//
+// Arguments:
+//   - ctx: The context passed to the operation.
+//   - operation: The name of the operation, such as "pull".
+//   - workspace: The name of the workspace the operation runs in.
+//   - fn: The operation.
+//
+// Returns:
+//   - Job: A snapshot of the job right after it was submitted.
+func (j *Jobs) Submit(ctx context.Context, operation string, workspace string, fn JobFunc) Job {
+	job := &Job{
+		ID:        newJobID(),
+		Operation: operation,
+		Workspace: workspace,
+		Status:    JobRunning,
+		CreatedAt: time.Now(),
+	}
+	queued := &queuedJob{start: make(chan struct{})}
+
+	j.mu.Lock()
+	j.jobs[job.ID] = job
+	j.order = append(j.order, job.ID)
+	j.queues[workspace] = append(j.queues[workspace], queued)
+	if len(j.queues[workspace]) == 1 {
+		close(queued.start)
+	} else {
+		job.Status = JobQueued
+	}
+	j.prune()
+	snapshot := *job
+	j.mu.Unlock()
+
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		defer j.dequeue(workspace, queued)
+
+		var result any
+		var errs []error
+		select {
+		case <-queued.start:
+			j.mu.Lock()
+			job.Status = JobRunning
+			j.mu.Unlock()
+			result, errs = fn(ctx)
+		case <-ctx.Done():
+			errs = []error{ctx.Err()}
+		}
+
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		now := time.Now()
+		job.FinishedAt = &now
+		job.Result = result
+		job.Status = JobSucceeded
+		for _, err := range errs {
+			job.Errors = append(job.Errors, err.Error())
+		}
+		if len(job.Errors) > 0 {
+			job.Status = JobFailed
+		}
+	}()
+
+	return snapshot
+}
+
+// Get returns a snapshot of a job.
+//
+// Arguments:
+//   - id: The id of the job.
+//
+// Returns:
+//   - Job: The job.
+//   - bool: False if no job has the id.
+func (j *Jobs) Get(id string) (Job, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	job, ok := j.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// List returns a snapshot of every job, oldest first.
+//
+// Returns:
+//   - []Job: The jobs.
+func (j *Jobs) List() []Job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	jobs := make([]Job, 0, len(j.order))
+	for _, id := range j.order {
+		jobs = append(jobs, *j.jobs[id])
+	}
+	return jobs
+}
+
+// dequeue removes a finished job from the workspace queue and starts the next
+// job when the finished job was the one running.
+func (j *Jobs) dequeue(workspace string, finished *queuedJob) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	queue := j.queues[workspace]
+	i := slices.Index(queue, finished)
+	queue = slices.Delete(queue, i, i+1)
+	if len(queue) == 0 {
+		delete(j.queues, workspace)
+		return
+	}
+	j.queues[workspace] = queue
+	if i == 0 {
+		close(queue[0].start)
+	}
+}
+
+// Wait blocks until every submitted job has finished.
+func (j *Jobs) Wait() {
+	j.wg.Wait()
+}
+
+// prune forgets the oldest finished jobs beyond the maximum, unfinished jobs are always kept.
+func (j *Jobs) prune() {
+	excess := len(j.order) - j.max
+	if excess <= 0 {
+		return
+	}
+	kept := j.order[:0]
+	for _, id := range j.order {
+		if excess > 0 && j.jobs[id].FinishedAt != nil {
+			delete(j.jobs, id)
+			excess--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	j.order = kept
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/polyrepopro/api/commands"
+)
+
+// runnerSet is a supervisor started through the API.
+type runnerSet struct {
+	supervisor *commands.Supervisor
+	cancel     context.CancelFunc
+	done       chan struct{}
+	errors     []error
+}
+
+// RunnersResponse is the state of the runners of a workspace.
+type RunnersResponse struct {
+	Running bool                   `json:"running"`
+	Runners []commands.RunnerState `json:"runners"`
+	Errors  []string               `json:"errors,omitempty"`
+}
+
+func (s *Server) runnersResponse(set *runnerSet) RunnersResponse {
+	response := RunnersResponse{Runners: []commands.RunnerState{}}
+	if set == nil {
+		return response
+	}
+	response.Runners = set.supervisor.States()
+	select {
+	case <-set.done:
+		response.Errors = errorStrings(set.errors)
+	default:
+		response.Running = true
+	}
+	return response
+}
+
+func (s *Server) listRunners(w http.ResponseWriter, r *http.Request) error {
+	workspace, err := s.workspace(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	set := s.runners[workspace.Name]
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, s.runnersResponse(set))
+	return nil
+}
+
+func (s *Server) startRunners(w http.ResponseWriter, r *http.Request) error {
+	workspace, err := s.workspace(r)
+	if err != nil {
+		return err
+	}
+
+	var req OperationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		return newError(http.StatusBadRequest, "invalid request body: %w", err)
+	}
+	selector, err := parseSelector(req.Selector)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if set, ok := s.runners[workspace.Name]; ok {
+		select {
+		case <-set.done:
+		default:
+			return newError(http.StatusConflict, "runners of workspace %s are already running", workspace.Name)
+		}
+	}
+
+	supervisor, err := commands.NewSupervisor(commands.SupervisorArgs{
+		Workspace: workspace,
+		Selector:  selector,
+	})
+	if err != nil {
+		return newError(http.StatusBadRequest, "failed to create supervisor: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	set := &runnerSet{supervisor: supervisor, cancel: cancel, done: make(chan struct{})}
+	supervisor.Start(ctx)
+	go func() {
+		set.errors = supervisor.Wait()
+		close(set.done)
+	}()
+	s.runners[workspace.Name] = set
+
+	writeJSON(w, http.StatusAccepted, s.runnersResponse(set))
+	return nil
+}
+
+func (s *Server) stopRunnersHandler(w http.ResponseWriter, r *http.Request) error {
+	workspace, err := s.workspace(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	set, ok := s.runners[workspace.Name]
+	s.mu.Unlock()
+	if !ok {
+		return newError(http.StatusNotFound, "runners of workspace %s were not started", workspace.Name)
+	}
+
+	set.cancel()
+	select {
+	case <-set.done:
+	case <-r.Context().Done():
+		return r.Context().Err()
+	}
+
+	writeJSON(w, http.StatusOK, s.runnersResponse(set))
+	return nil
+}
+
+func (s *Server) runnerLogs(w http.ResponseWriter, r *http.Request) error {
+	workspace, err := s.workspace(r)
+	if err != nil {
+		return err
+	}
+
+	lines := 0
+	if value := r.URL.Query().Get("lines"); value != "" {
+		if lines, err = strconv.Atoi(value); err != nil {
+			return newError(http.StatusBadRequest, "invalid lines %q", value)
+		}
+	}
+
+	s.mu.Lock()
+	set, ok := s.runners[workspace.Name]
+	s.mu.Unlock()
+	if !ok {
+		return newError(http.StatusNotFound, "runners of workspace %s were not started", workspace.Name)
+	}
+
+	name := r.PathValue("repository") + "/" + r.PathValue("runner")
+	tail, ok := set.supervisor.Tail(name, lines)
+	if !ok {
+		return newError(http.StatusNotFound, "runner %s not found", name)
+	}
+	if tail == nil {
+		tail = []string{}
+	}
+	writeJSON(w, http.StatusOK, tail)
+	return nil
+}
+
+// stopRunners stops every runner started through the API and waits for them.
+func (s *Server) stopRunners() {
+	s.mu.Lock()
+	sets := make([]*runnerSet, 0, len(s.runners))
+	for _, set := range s.runners {
+		sets = append(sets, set)
+	}
+	s.mu.Unlock()
+
+	for _, set := range sets {
+		set.cancel()
+		<-set.done
+	}
+}
@@ -0,0 +1,288 @@
+// Package server exposes workspace operations as a JSON API over HTTP so that
+// local tools and editors can drive polyrepo without shelling out to it.
+//
+// The API has no authentication, it is meant to be bound to localhost or to a
+// Unix socket whose file permissions restrict who may connect, and it only
+// answers clients connecting from a loopback address. Only the webhook
+// endpoint may be reached remotely: it is enabled with a secret that forges
+// must sign or send their deliveries with, and can be served on its own
+// listener with WebhookHandler or alongside the API with AllowRemote.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mateothegreat/go-multilog/multilog"
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/events"
+	"github.com/polyrepopro/api/monitoring"
+)
+
+// DefaultAddress is the address the server listens on when neither an address nor a socket is set.
+const DefaultAddress = "127.0.0.1:7447"
+
+// ServerArgs are the arguments for creating a server.
+type ServerArgs struct {
+	Config *config.Config
+	// Address is the host:port to listen on, it must be a loopback address unless AllowRemote is set.
+	Address string
+	// Socket is the path of a Unix socket to listen on instead of Address.
+	Socket string
+	// AllowRemote allows Address to be a non-loopback address so that forges can
+	// deliver webhooks, the rest of the API is still only served to loopback clients.
+	AllowRemote bool
+	// MaxJobs is the number of finished jobs kept for polling, zero uses DefaultMaxJobs.
+	MaxJobs int
+	// Bus is the bus whose events are streamed, nil uses events.Default.
+	Bus *events.Bus
+	// Metrics are served on /metrics, nil collects metrics from Bus for as long as the server runs.
+	Metrics *monitoring.Metrics
+	// WebhookSecret is the secret push webhooks are verified with, empty disables the webhook endpoint.
+	WebhookSecret string
+}
+
+// Server serves the JSON API.
+type Server struct {
+	config  *config.Config
+	address string
+	socket  string
+	jobs    *Jobs
+	bus     *events.Bus
+	mux     *http.ServeMux
+	// webhooks serves the webhook endpoint.
+	webhooks *http.ServeMux
+	// handler serves mux behind the guard and the webhook endpoint.
+	handler http.Handler
+	metrics *monitoring.Metrics
+	// ownMetrics is set when the metrics were created by the server and must be closed by it.
+	ownMetrics bool
+
+	webhookSecret string
+
+	// ctx is cancelled when the server shuts down, it stops jobs and runners.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	runners map[string]*runnerSet
+}
+
+// NewServer creates a server for a config.
+//
+// Arguments:
+//   - args: The arguments for the server.
+//
+// Returns:
+//   - *Server: The server.
+//   - error: An error if the address is not a loopback address and remote access is not allowed.
+func NewServer(args ServerArgs) (*Server, error) {
+	if args.Config == nil {
+		return nil, fmt.Errorf("a config is required")
+	}
+
+	address := args.Address
+	if address == "" && args.Socket == "" {
+		address = DefaultAddress
+	}
+	if args.Socket == "" && !args.AllowRemote {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %q: %w", address, err)
+		}
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return nil, fmt.Errorf("refusing to listen on non-loopback address %q", address)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		config:        args.Config,
+		address:       address,
+		socket:        args.Socket,
+		jobs:          NewJobs(args.MaxJobs),
+		bus:           args.Bus,
+		webhookSecret: args.WebhookSecret,
+		mux:           http.NewServeMux(),
+		ctx:           ctx,
+		cancel:        cancel,
+		runners:       make(map[string]*runnerSet),
+	}
+	if s.bus == nil {
+		s.bus = events.Default
+	}
+	s.metrics = args.Metrics
+	if s.metrics == nil {
+		s.metrics = monitoring.NewMetrics(monitoring.MetricsArgs{Bus: s.bus, Config: s.config})
+		s.ownMetrics = true
+	}
+	s.routes()
+	return s, nil
+}
+
+// Handler returns the handler serving the API, to mount it in another server.
+// It only accepts requests addressed to a loopback host, from no browser
+// origin other than its own and, for POST requests, with a JSON body.
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// WebhookHandler returns a handler serving only the webhook endpoint on
+// /webhooks, to receive deliveries from forges on a listener of its own while
+// the API stays bound to a loopback address or socket.
+func (s *Server) WebhookHandler() http.Handler {
+	return s.webhooks
+}
+
+// Jobs returns the jobs started through the API.
+func (s *Server) Jobs() *Jobs {
+	return s.jobs
+}
+
+// ListenAndServe serves the API until the context is cancelled, then stops
+// accepting requests, stops the runners started through the API and waits
+// for running jobs.
+//
+// Arguments:
+//   - ctx: The context, cancelling it shuts the server down.
+//
+// Returns:
+//   - error: An error if the server could not listen or failed while serving.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	listener, err := s.listen()
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, listener)
+}
+
+// Serve serves the API on a listener until the context is cancelled.
+//
+// Arguments:
+//   - ctx: The context, cancelling it shuts the server down.
+//   - listener: The listener, it is closed when the server shuts down.
+//
+// Returns:
+//   - error: An error if the server failed while serving.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	server := &http.Server{
+		Handler:           s.handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	multilog.Info("server", "listening", map[string]interface{}{
+		"address": listener.Addr().String(),
+	})
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-errs:
+		s.shutdown()
+		return fmt.Errorf("failed to serve: %w", err)
+	case <-ctx.Done():
+	}
+
+	// Cancelling the server context ends the event streams, which would
+	// otherwise keep the shutdown waiting.
+	s.cancel()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := server.Shutdown(shutdownCtx)
+	s.shutdown()
+	if err != nil {
+		return fmt.Errorf("failed to shut down: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) listen() (net.Listener, error) {
+	if s.socket == "" {
+		listener, err := net.Listen("tcp", s.address)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen on %s: %w", s.address, err)
+		}
+		return listener, nil
+	}
+
+	// A socket file left behind by a previous server that did not shut down
+	// cleanly would make listening fail.
+	if conn, err := net.Dial("unix", s.socket); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("socket %s is already in use", s.socket)
+	}
+	if err := os.Remove(s.socket); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale socket %s: %w", s.socket, err)
+	}
+
+	listener, err := net.Listen("unix", s.socket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", s.socket, err)
+	}
+	if err := os.Chmod(s.socket, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to restrict socket permissions: %w", err)
+	}
+	return listener, nil
+}
+
+func (s *Server) shutdown() {
+	s.cancel()
+	s.stopRunners()
+	s.jobs.Wait()
+	if s.ownMetrics {
+		s.metrics.Close()
+	}
+}
+
+// apiError is an error with the HTTP status it is reported with.
+type apiError struct {
+	status int
+	err    error
+}
+
+func (e *apiError) Error() string {
+	return e.err.Error()
+}
+
+func newError(status int, format string, args ...any) error {
+	return &apiError{status: status, err: fmt.Errorf(format, args...)}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		multilog.Debug("server", "failed to write response", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		status = apiErr.status
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// errorStrings converts errors to strings so they can be encoded as JSON.
+func errorStrings(errs []error) []string {
+	strs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		strs = append(strs, err.Error())
+	}
+	return strs
+}
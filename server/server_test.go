@@ -0,0 +1,410 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert"
+	"github.com/polyrepopro/api/commands"
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/events"
+	"github.com/polyrepopro/api/test"
+	"github.com/stretchr/testify/suite"
+)
+
+type ServerSuite struct {
+	suite.Suite
+	cfg    *config.Config
+	server *Server
+	http   *httptest.Server
+}
+
+func TestServer(t *testing.T) {
+	suite.Run(t, new(ServerSuite))
+}
+
+func (s *ServerSuite) SetupTest() {
+	test.Setup()
+
+	base := s.T().TempDir()
+	upstream := filepath.Join(base, "upstream")
+	workspace := filepath.Join(base, "workspace")
+	s.git("", "init", "-q", "-b", "main", upstream)
+	s.git(upstream, "commit", "-q", "--allow-empty", "-m", "initial")
+	s.git("", "clone", "-q", upstream, filepath.Join(workspace, "api"))
+	s.git("", "clone", "-q", upstream, filepath.Join(workspace, "web"))
+
+	s.cfg = &config.Config{
+		Workspaces: &[]config.Workspace{
+			{
+				Name: "test",
+				Path: workspace,
+				Repositories: &[]config.Repository{
+					{
+						Name: "api",
+						URL:  upstream,
+						Path: "api",
+						Tags: []string{"backend"},
+						Runners: &[]config.Runner{
+							{Name: "server", Commands: []config.Command{{Name: "serve", Shell: "echo listening; sleep 30"}}},
+						},
+					},
+					{Name: "web", URL: upstream, Path: "web", Tags: []string{"frontend"}},
+				},
+			},
+		},
+	}
+
+	var err error
+	s.server, err = NewServer(ServerArgs{Config: s.cfg})
+	assert.NoError(s.T(), err)
+	s.http = httptest.NewServer(s.server.Handler())
+}
+
+func (s *ServerSuite) TearDownTest() {
+	s.http.Close()
+	s.server.shutdown()
+}
+
+func (s *ServerSuite) git(dir string, args ...string) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com", "GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+	out, err := cmd.CombinedOutput()
+	assert.NoError(s.T(), err, string(out))
+}
+
+func (s *ServerSuite) request(method string, path string, body string, v any) int {
+	req, err := http.NewRequest(method, s.http.URL+path, strings.NewReader(body))
+	assert.NoError(s.T(), err)
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := http.DefaultClient.Do(req)
+	assert.NoError(s.T(), err)
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	assert.NoError(s.T(), err)
+	if v != nil {
+		assert.NoError(s.T(), json.Unmarshal(b, v), string(b))
+	}
+	return res.StatusCode
+}
+
+func (s *ServerSuite) waitJob(id string) Job {
+	var job Job
+	s.Eventually(func() bool {
+		s.request(http.MethodGet, "/jobs/"+id, "", &job)
+		return job.FinishedAt != nil
+	}, 10*time.Second, 20*time.Millisecond)
+	return job
+}
+
+func (s *ServerSuite) Test1List() {
+	var workspaces []WorkspaceInfo
+	assert.Equal(s.T(), http.StatusOK, s.request(http.MethodGet, "/workspaces", "", &workspaces))
+	assert.Equal(s.T(), []WorkspaceInfo{{Name: "test", Path: (*s.cfg.Workspaces)[0].Path, Repositories: 2}}, workspaces)
+
+	var repos []RepositoryInfo
+	assert.Equal(s.T(), http.StatusOK, s.request(http.MethodGet, "/workspaces/test/repositories?selector=frontend", "", &repos))
+	assert.Equal(s.T(), 1, len(repos))
+	assert.Equal(s.T(), "web", repos[0].Name)
+
+	var apiErr map[string]string
+	assert.Equal(s.T(), http.StatusNotFound, s.request(http.MethodGet, "/workspaces/missing/repositories", "", &apiErr))
+	assert.Equal(s.T(), "workspace missing not found", apiErr["error"])
+	assert.Equal(s.T(), http.StatusBadRequest, s.request(http.MethodGet, "/workspaces/test/repositories?selector=(", "", &apiErr))
+}
+
+func (s *ServerSuite) Test2Status() {
+	assert.NoError(s.T(), os.WriteFile(filepath.Join((*s.cfg.Workspaces)[0].Path, "web", "new.txt"), []byte("new"), 0644))
+
+	var statuses []RepositoryStatus
+	assert.Equal(s.T(), http.StatusOK, s.request(http.MethodGet, "/workspaces/test/status", "", &statuses))
+	assert.Equal(s.T(), 2, len(statuses))
+	assert.Equal(s.T(), "api", statuses[0].Repository)
+	assert.Equal(s.T(), "clean", string(statuses[0].Code))
+	assert.Equal(s.T(), "dirty", string(statuses[1].Code))
+}
+
+func (s *ServerSuite) Test3Jobs() {
+	var job Job
+	assert.Equal(s.T(), http.StatusAccepted, s.request(http.MethodPost, "/workspaces/test/fetch", `{"selector": "name=api"}`, &job))
+	assert.Equal(s.T(), "fetch", job.Operation)
+	assert.Equal(s.T(), JobSucceeded, s.waitJob(job.ID).Status)
+
+	assert.Equal(s.T(), http.StatusAccepted, s.request(http.MethodPost, "/workspaces/test/switch", `{"branch": "missing"}`, &job))
+	job = s.waitJob(job.ID)
+	assert.Equal(s.T(), JobFailed, job.Status)
+	assert.Equal(s.T(), 2, len(job.Errors))
+
+	var jobs []Job
+	assert.Equal(s.T(), http.StatusOK, s.request(http.MethodGet, "/jobs", "", &jobs))
+	assert.Equal(s.T(), 2, len(jobs))
+
+	var apiErr map[string]string
+	assert.Equal(s.T(), http.StatusBadRequest, s.request(http.MethodPost, "/workspaces/test/switch", "", &apiErr))
+	assert.Equal(s.T(), http.StatusBadRequest, s.request(http.MethodPost, "/workspaces/test/commit", `{"message": ""}`, &apiErr))
+	assert.Equal(s.T(), http.StatusBadRequest, s.request(http.MethodPost, "/workspaces/test/pull", `{`, &apiErr))
+	assert.Equal(s.T(), http.StatusNotFound, s.request(http.MethodGet, "/jobs/unknown", "", &apiErr))
+	assert.Equal(s.T(), http.StatusMethodNotAllowed, s.request(http.MethodGet, "/workspaces/test/pull", "", nil))
+}
+
+func (s *ServerSuite) Test4Runners() {
+	var runners RunnersResponse
+	assert.Equal(s.T(), http.StatusOK, s.request(http.MethodGet, "/workspaces/test/runners", "", &runners))
+	assert.False(s.T(), runners.Running)
+
+	assert.Equal(s.T(), http.StatusAccepted, s.request(http.MethodPost, "/workspaces/test/runners/start", "", &runners))
+	assert.True(s.T(), runners.Running)
+	assert.Equal(s.T(), http.StatusConflict, s.request(http.MethodPost, "/workspaces/test/runners/start", "", nil))
+
+	var lines []string
+	s.Eventually(func() bool {
+		s.request(http.MethodGet, "/workspaces/test/runners/api/server/logs?lines=10", "", &lines)
+		return len(lines) == 1
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(s.T(), []string{"listening"}, lines)
+	assert.Equal(s.T(), http.StatusNotFound, s.request(http.MethodGet, "/workspaces/test/runners/api/missing/logs", "", nil))
+
+	assert.Equal(s.T(), http.StatusOK, s.request(http.MethodPost, "/workspaces/test/runners/stop", "", &runners))
+	assert.False(s.T(), runners.Running)
+	assert.Equal(s.T(), commands.RunnerStopped, runners.Runners[0].Status)
+}
+
+func (s *ServerSuite) Test5UnixSocket() {
+	socket := filepath.Join(s.T().TempDir(), "api.sock")
+	server, err := NewServer(ServerArgs{Config: s.cfg, Socket: socket})
+	assert.NoError(s.T(), err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- server.ListenAndServe(ctx)
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	var res *http.Response
+	s.Eventually(func() bool {
+		res, err = client.Get("http://polyrepo/workspaces")
+		return err == nil
+	}, 5*time.Second, 20*time.Millisecond)
+	res.Body.Close()
+	assert.Equal(s.T(), http.StatusOK, res.StatusCode)
+
+	info, err := os.Stat(socket)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), os.FileMode(0600), info.Mode().Perm())
+
+	cancel()
+	assert.NoError(s.T(), <-done)
+}
+
+func (s *ServerSuite) Test6Addresses() {
+	_, err := NewServer(ServerArgs{Config: s.cfg, Address: "0.0.0.0:7447"})
+	assert.Error(s.T(), err)
+	_, err = NewServer(ServerArgs{Config: s.cfg, Address: "0.0.0.0:7447", AllowRemote: true})
+	assert.NoError(s.T(), err)
+	_, err = NewServer(ServerArgs{Config: s.cfg, Address: "localhost:7447"})
+	assert.NoError(s.T(), err)
+	server, err := NewServer(ServerArgs{Config: s.cfg})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), DefaultAddress, server.address)
+}
+
+func TestJobsPrune(t *testing.T) {
+	jobs := NewJobs(2)
+	release := make(chan struct{})
+	running := jobs.Submit(context.Background(), "slow", "test", func(ctx context.Context) (any, []error) {
+		<-release
+		return nil, nil
+	})
+	for i := 0; i < 3; i++ {
+		job := jobs.Submit(context.Background(), "fast", "other", func(ctx context.Context) (any, []error) {
+			return i, []error{fmt.Errorf("failed %d", i)}
+		})
+		for {
+			if job, _ := jobs.Get(job.ID); job.FinishedAt != nil {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// The running job is kept even though it is the oldest.
+	list := jobs.List()
+	assert.Equal(t, 2, len(list))
+	assert.Equal(t, running.ID, list[0].ID)
+	assert.Equal(t, JobFailed, list[1].Status)
+	assert.Equal(t, []string{"failed 2"}, list[1].Errors)
+
+	close(release)
+	jobs.Wait()
+	job, ok := jobs.Get(running.ID)
+	assert.True(t, ok)
+	assert.Equal(t, JobSucceeded, job.Status)
+}
+
+func TestJobsQueue(t *testing.T) {
+	jobs := NewJobs(0)
+	release := make(chan struct{})
+	first := jobs.Submit(context.Background(), "pull", "test", func(ctx context.Context) (any, []error) {
+		<-release
+		return nil, nil
+	})
+	assert.Equal(t, JobRunning, first.Status)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := jobs.Submit(ctx, "switch", "test", func(ctx context.Context) (any, []error) {
+		return nil, []error{fmt.Errorf("cancelled job ran")}
+	})
+	second := jobs.Submit(context.Background(), "commit", "test", func(ctx context.Context) (any, []error) {
+		if job, _ := jobs.Get(first.ID); job.FinishedAt == nil {
+			return nil, []error{fmt.Errorf("ran before the first job finished")}
+		}
+		return nil, nil
+	})
+	assert.Equal(t, JobQueued, cancelled.Status)
+	assert.Equal(t, JobQueued, second.Status)
+
+	// Jobs of other workspaces are not held back.
+	other := jobs.Submit(context.Background(), "pull", "other", func(ctx context.Context) (any, []error) {
+		return nil, nil
+	})
+	assert.Equal(t, JobRunning, other.Status)
+
+	// A queued job that is cancelled fails without running or starting the jobs after it.
+	cancel()
+	for {
+		if job, _ := jobs.Get(cancelled.ID); job.FinishedAt != nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	job, _ := jobs.Get(cancelled.ID)
+	assert.Equal(t, JobFailed, job.Status)
+	assert.Equal(t, []string{"context canceled"}, job.Errors)
+	job, _ = jobs.Get(second.ID)
+	assert.Equal(t, JobQueued, job.Status)
+
+	close(release)
+	jobs.Wait()
+	job, _ = jobs.Get(second.ID)
+	assert.Equal(t, JobSucceeded, job.Status)
+	job, _ = jobs.Get(other.ID)
+	assert.Equal(t, JobSucceeded, job.Status)
+}
+
+func (s *ServerSuite) Test7Events() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.http.URL+"/events?workspace=test&types=operation.started,operation.finished", nil)
+	assert.NoError(s.T(), err)
+	res, err := http.DefaultClient.Do(req)
+	assert.NoError(s.T(), err)
+	defer res.Body.Close()
+	assert.Equal(s.T(), "text/event-stream", res.Header.Get("Content-Type"))
+
+	received := make(chan events.Event)
+	go func() {
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+				var event events.Event
+				if json.Unmarshal([]byte(data), &event) != nil {
+					continue
+				}
+				select {
+				case received <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	// Events of other workspaces are filtered out.
+	events.Publish(events.Event{Type: events.OperationStarted, Workspace: "other"})
+	s.request(http.MethodPost, "/workspaces/test/fetch", `{"selector": "name=api"}`, nil)
+
+	var stream []string
+	for len(stream) < 4 {
+		select {
+		case event := <-received:
+			assert.Equal(s.T(), "test", event.Workspace)
+			stream = append(stream, fmt.Sprintf("%s %s %s", event.Type, event.Operation, event.Repository))
+		case <-time.After(10 * time.Second):
+			s.T().Fatalf("timed out waiting for events, received %v", stream)
+		}
+	}
+	assert.Equal(s.T(), []string{
+		"operation.started fetch ",
+		"operation.started fetch api",
+		"operation.finished fetch api",
+		"operation.finished fetch ",
+	}, stream)
+}
+
+func (s *ServerSuite) Test9Metrics() {
+	var job Job
+	assert.Equal(s.T(), http.StatusAccepted, s.request(http.MethodPost, "/workspaces/test/fetch", `{"selector": "name=api"}`, &job))
+	s.waitJob(job.ID)
+
+	s.Eventually(func() bool {
+		res, err := http.Get(s.http.URL + "/metrics")
+		assert.NoError(s.T(), err)
+		defer res.Body.Close()
+		b, err := io.ReadAll(res.Body)
+		assert.NoError(s.T(), err)
+		return strings.Contains(string(b), `polyrepo_operations_total{operation="fetch",workspace="test",repository="api"} 1`+"\n")
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+func (s *ServerSuite) Test10Guard() {
+	send := func(method string, path string, headers map[string]string) int {
+		req, err := http.NewRequest(method, s.http.URL+path, strings.NewReader(`{"selector": "name=api"}`))
+		assert.NoError(s.T(), err)
+		for k, v := range headers {
+			if k == "Host" {
+				req.Host = v
+				continue
+			}
+			req.Header.Set(k, v)
+		}
+		res, err := http.DefaultClient.Do(req)
+		assert.NoError(s.T(), err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+	host := strings.TrimPrefix(s.http.URL, "http://")
+
+	// A page on another origin cannot start operations.
+	assert.Equal(s.T(), http.StatusForbidden, send(http.MethodPost, "/workspaces/test/fetch", map[string]string{"Content-Type": "application/json", "Origin": "http://evil.example"}))
+	assert.Equal(s.T(), http.StatusForbidden, send(http.MethodPost, "/workspaces/test/fetch", map[string]string{"Content-Type": "application/json", "Origin": "null"}))
+	// Nor can it make a simple request without a preflight.
+	assert.Equal(s.T(), http.StatusUnsupportedMediaType, send(http.MethodPost, "/workspaces/test/fetch", map[string]string{"Content-Type": "text/plain"}))
+	assert.Equal(s.T(), http.StatusUnsupportedMediaType, send(http.MethodPost, "/workspaces/test/runners/stop", nil))
+	// Nor reach the API through a name rebound to the loopback address.
+	assert.Equal(s.T(), http.StatusForbidden, send(http.MethodGet, "/workspaces", map[string]string{"Host": "evil.example:" + strings.Split(host, ":")[1]}))
+
+	assert.Equal(s.T(), http.StatusOK, send(http.MethodGet, "/workspaces", map[string]string{"Origin": "http://" + host}))
+	assert.Equal(s.T(), http.StatusOK, send(http.MethodGet, "/workspaces", map[string]string{"Host": "localhost"}))
+	assert.Equal(s.T(), http.StatusAccepted, send(http.MethodPost, "/workspaces/test/fetch", map[string]string{"Content-Type": "application/json; charset=utf-8", "Origin": "http://" + host}))
+	s.server.Jobs().Wait()
+}
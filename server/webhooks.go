@@ -0,0 +1,160 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/mateothegreat/go-multilog/multilog"
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/repositories"
+	"github.com/polyrepopro/api/workspaces"
+)
+
+// maxWebhookBody is the largest webhook payload accepted, forges send at most a few megabytes.
+const maxWebhookBody = 25 << 20
+
+// WebhookResponse is the response to a webhook delivery.
+type WebhookResponse struct {
+	// Provider is the forge the delivery was recognized as, "github", "gitlab" or "gitea".
+	Provider string `json:"provider"`
+	// Event is the event type sent by the forge.
+	Event string `json:"event"`
+	// Ignored is set when the event is not a push and nothing was done.
+	Ignored bool `json:"ignored,omitempty"`
+	// Jobs are the pulls started for the configured repositories matching the pushed repository.
+	Jobs []Job `json:"jobs"`
+}
+
+// webhookPayload holds the fields of GitHub, Gitea and GitLab push payloads
+// that identify the pushed repository.
+type webhookPayload struct {
+	Repository struct {
+		CloneURL string `json:"clone_url"`
+		SSHURL   string `json:"ssh_url"`
+		HTMLURL  string `json:"html_url"`
+		GitURL   string `json:"git_url"`
+	} `json:"repository"`
+	Project struct {
+		HTTPURL string `json:"git_http_url"`
+		SSHURL  string `json:"git_ssh_url"`
+		WebURL  string `json:"web_url"`
+	} `json:"project"`
+}
+
+func (p webhookPayload) urls() []string {
+	return []string{
+		p.Repository.CloneURL, p.Repository.SSHURL, p.Repository.HTMLURL, p.Repository.GitURL,
+		p.Project.HTTPURL, p.Project.SSHURL, p.Project.WebURL,
+	}
+}
+
+// webhook receives push events from GitHub, GitLab and Gitea and fast-forwards
+// every configured repository whose URL matches the pushed repository.
+//
+// GitHub and Gitea deliveries must be signed with the webhook secret, GitLab
+// does not sign deliveries and sends the secret as a token instead.
+func (s *Server) webhook(w http.ResponseWriter, r *http.Request) error {
+	if s.webhookSecret == "" {
+		return newError(http.StatusNotFound, "webhooks are not enabled")
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return newError(http.StatusRequestEntityTooLarge, "payload is larger than %d bytes", tooLarge.Limit)
+		}
+		return newError(http.StatusBadRequest, "failed to read payload: %w", err)
+	}
+
+	response := WebhookResponse{Jobs: []Job{}}
+	var push bool
+	// Gitea also sends the GitHub headers for compatibility so it is detected first.
+	switch {
+	case r.Header.Get("X-Gitea-Event") != "":
+		response.Provider, response.Event = "gitea", r.Header.Get("X-Gitea-Event")
+		if !validSignature(body, r.Header.Get("X-Gitea-Signature"), s.webhookSecret) {
+			return newError(http.StatusUnauthorized, "invalid signature")
+		}
+		push = response.Event == "push"
+	case r.Header.Get("X-Gitlab-Event") != "":
+		response.Provider, response.Event = "gitlab", r.Header.Get("X-Gitlab-Event")
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Gitlab-Token")), []byte(s.webhookSecret)) != 1 {
+			return newError(http.StatusUnauthorized, "invalid token")
+		}
+		push = response.Event == "Push Hook" || response.Event == "Tag Push Hook"
+	case r.Header.Get("X-GitHub-Event") != "":
+		response.Provider, response.Event = "github", r.Header.Get("X-GitHub-Event")
+		if !validSignature(body, strings.TrimPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256="), s.webhookSecret) {
+			return newError(http.StatusUnauthorized, "invalid signature")
+		}
+		push = response.Event == "push"
+	default:
+		return newError(http.StatusBadRequest, "unrecognized webhook, expected a GitHub, GitLab or Gitea event header")
+	}
+
+	if !push {
+		response.Ignored = true
+		writeJSON(w, http.StatusOK, response)
+		return nil
+	}
+
+	var payload webhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return newError(http.StatusBadRequest, "invalid payload: %w", err)
+	}
+
+	refs := s.config.FindRepositoriesByURL(payload.urls()...)
+	multilog.Info("server", "received push webhook", map[string]interface{}{
+		"provider": response.Provider,
+		"url":      cmp.Or(payload.Repository.CloneURL, payload.Project.HTTPURL),
+		"matches":  len(refs),
+	})
+	if len(refs) == 0 {
+		writeJSON(w, http.StatusOK, response)
+		return nil
+	}
+
+	for _, ref := range refs {
+		workspace, repo := ref.Workspace, *ref.Repository
+		response.Jobs = append(response.Jobs, s.jobs.Submit(s.ctx, "pull", workspace.Name, func(ctx context.Context) (any, []error) {
+			var result any
+			errs := workspaces.ExecuteContext(workspaces.ExecuteArgs{
+				Workspace:    workspace,
+				Repositories: []config.Repository{repo},
+				Operation:    "pull",
+				Context:      ctx,
+			}, func(ctx context.Context, repo *config.Repository) error {
+				ff, err := repositories.FastForward(ctx, repositories.FastForwardArgs{
+					Workspace:  workspace,
+					Repository: repo,
+				})
+				result = ff
+				return err
+			})
+			return result, errs
+		}))
+	}
+	writeJSON(w, http.StatusAccepted, response)
+	return nil
+}
+
+// validSignature reports whether signature is the hex encoded HMAC-SHA256 of the body keyed with the secret.
+func validSignature(body []byte, signature string, secret string) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil || len(expected) == 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/assert"
+	"github.com/polyrepopro/api/git"
+)
+
+const webhookSecret = "s3cret"
+
+func (s *ServerSuite) webhook(url string, headers map[string]string, body string, v any) int {
+	req, err := http.NewRequest(http.MethodPost, url+"/webhooks", strings.NewReader(body))
+	assert.NoError(s.T(), err)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	res, err := http.DefaultClient.Do(req)
+	assert.NoError(s.T(), err)
+	defer res.Body.Close()
+	if v != nil {
+		assert.NoError(s.T(), json.NewDecoder(res.Body).Decode(v))
+	}
+	return res.StatusCode
+}
+
+func sign(body string) string {
+	mac := hmac.New(sha256.New, []byte(webhookSecret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *ServerSuite) head(path string) string {
+	out, err := exec.Command("git", "-C", path, "rev-parse", "HEAD").Output()
+	assert.NoError(s.T(), err)
+	return strings.TrimSpace(string(out))
+}
+
+func (s *ServerSuite) Test8Webhooks() {
+	server, err := NewServer(ServerArgs{Config: s.cfg, WebhookSecret: webhookSecret})
+	assert.NoError(s.T(), err)
+	defer server.shutdown()
+	listener := httptest.NewServer(server.Handler())
+	defer listener.Close()
+
+	workspace := (*s.cfg.Workspaces)[0]
+	upstream := (*workspace.Repositories)[0].URL
+	s.git(upstream, "commit", "-q", "--allow-empty", "-m", "pushed")
+
+	github := `{"ref": "refs/heads/main", "repository": {"clone_url": "` + upstream + `.git"}}`
+	gitlab := `{"ref": "refs/heads/main", "project": {"git_http_url": "` + upstream + `"}}`
+	other := `{"repository": {"clone_url": "https://github.com/org/other.git"}}`
+
+	// Deliveries that are not authentic are rejected.
+	assert.Equal(s.T(), http.StatusUnauthorized, s.webhook(listener.URL, map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + sign(other)}, github, nil))
+	assert.Equal(s.T(), http.StatusUnauthorized, s.webhook(listener.URL, map[string]string{"X-GitHub-Event": "push"}, github, nil))
+	assert.Equal(s.T(), http.StatusUnauthorized, s.webhook(listener.URL, map[string]string{"X-Gitea-Event": "push", "X-Gitea-Signature": "zz"}, github, nil))
+	assert.Equal(s.T(), http.StatusUnauthorized, s.webhook(listener.URL, map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": "wrong"}, gitlab, nil))
+	assert.Equal(s.T(), http.StatusBadRequest, s.webhook(listener.URL, nil, github, nil))
+
+	var response WebhookResponse
+	assert.Equal(s.T(), http.StatusOK, s.webhook(listener.URL, map[string]string{"X-GitHub-Event": "ping", "X-Hub-Signature-256": "sha256=" + sign(`{}`)}, `{}`, &response))
+	assert.True(s.T(), response.Ignored)
+	assert.Equal(s.T(), http.StatusOK, s.webhook(listener.URL, map[string]string{"X-Gitea-Event": "push", "X-Gitea-Signature": sign(other)}, other, &response))
+	assert.Equal(s.T(), "gitea", response.Provider)
+	assert.Equal(s.T(), 0, len(response.Jobs))
+
+	// Both repositories are clones of the pushed repository.
+	assert.Equal(s.T(), http.StatusAccepted, s.webhook(listener.URL, map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + sign(github)}, github, &response))
+	assert.Equal(s.T(), "github", response.Provider)
+	assert.Equal(s.T(), 2, len(response.Jobs))
+	server.Jobs().Wait()
+	for _, job := range response.Jobs {
+		job, _ := server.Jobs().Get(job.ID)
+		assert.Equal(s.T(), JobSucceeded, job.Status, job.Errors)
+		assert.Equal(s.T(), git.FastForwardUpdated, job.Result.(git.FastForwardResult).State)
+	}
+	assert.Equal(s.T(), s.head(upstream), s.head(filepath.Join(workspace.Path, "api")))
+
+	assert.Equal(s.T(), http.StatusAccepted, s.webhook(listener.URL, map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": webhookSecret}, gitlab, &response))
+	assert.Equal(s.T(), "gitlab", response.Provider)
+	assert.Equal(s.T(), 2, len(response.Jobs))
+	server.Jobs().Wait()
+	job, _ := server.Jobs().Get(response.Jobs[0].ID)
+	assert.Equal(s.T(), git.FastForwardUpToDate, job.Result.(git.FastForwardResult).State)
+
+	// The endpoint is disabled without a secret.
+	assert.Equal(s.T(), http.StatusNotFound, s.webhook(s.http.URL, map[string]string{"X-GitHub-Event": "push"}, github, nil))
+
+	// Remote clients can only reach the webhook endpoint.
+	remote, err := NewServer(ServerArgs{Config: s.cfg, Address: "0.0.0.0:7447", AllowRemote: true, WebhookSecret: webhookSecret})
+	assert.NoError(s.T(), err)
+	defer remote.shutdown()
+	serve := func(handler http.Handler, method string, path string, body string, headers map[string]string) int {
+		req := httptest.NewRequest(method, "http://polyrepo.example.com"+path, strings.NewReader(body))
+		req.RemoteAddr = "203.0.113.7:51234"
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	ping := map[string]string{"X-GitHub-Event": "ping", "X-Hub-Signature-256": "sha256=" + sign(`{}`)}
+	assert.Equal(s.T(), http.StatusForbidden, serve(remote.Handler(), http.MethodGet, "/workspaces", "", nil))
+	assert.Equal(s.T(), http.StatusForbidden, serve(remote.Handler(), http.MethodPost, "/workspaces/test/pull", "{}", map[string]string{"Content-Type": "application/json"}))
+	assert.Equal(s.T(), http.StatusOK, serve(remote.Handler(), http.MethodPost, "/webhooks", `{}`, ping))
+	assert.Equal(s.T(), http.StatusOK, serve(remote.WebhookHandler(), http.MethodPost, "/webhooks", `{}`, ping))
+	assert.Equal(s.T(), http.StatusNotFound, serve(remote.WebhookHandler(), http.MethodGet, "/workspaces", "", nil))
+}
@@ -1,13 +1,13 @@
 package test
 
-import "github.com/mateothegreat/go-multilog/multilog"
+import "github.com/polyrepopro/api/logs"
 
 func Setup() {
-	multilog.RegisterLogger(multilog.LogMethod("console"), multilog.NewConsoleLogger(&multilog.NewConsoleLoggerArgs{
-		Level:  multilog.DEBUG,
-		Format: multilog.FormatText,
-		FilterDropPatterns: []*string{
-			multilog.PtrString("producer"), // Drop rabbitmq producer logs.
+	logs.Setup(&logs.Config{
+		Level:  logs.DebugLevel,
+		Format: logs.TextFormat,
+		Drop: []string{
+			"producer", // Drop rabbitmq producer logs.
 		},
-	}))
+	})
 }
@@ -1,6 +1,9 @@
 package workspaces
 
 import (
+	"context"
+	"sync"
+
 	"github.com/polyrepopro/api/config"
 	"github.com/polyrepopro/api/git"
 	"github.com/polyrepopro/api/repositories"
@@ -9,6 +12,14 @@ import (
 type CommitArgs struct {
 	Workspace *config.Workspace
 	Message   string
+	// Selector limits the operation to the matching repositories.
+	Selector *config.Selector
+	// Ordered commits repositories after the repositories they depend on.
+	Ordered bool
+	// Parallelism is the maximum number of repositories committed at once, zero means no limit.
+	Parallelism int
+	// Context carries the trace the operation is part of, nil starts a new trace.
+	Context context.Context
 }
 
 // Commit commits the changes for each repository in the workspace.
@@ -19,22 +30,29 @@ type CommitArgs struct {
 // Returns:
 //   - []git.CommitResult: The results of the commit.
 func Commit(args CommitArgs) ([]git.CommitResult, []error) {
-	var errors []error
+	var mu sync.Mutex
 	var results []git.CommitResult
 
-	for _, repo := range *args.Workspace.Repositories {
+	errors := Execute(ExecuteArgs{
+		Workspace:   args.Workspace,
+		Selector:    args.Selector,
+		Ordered:     args.Ordered,
+		Parallelism: args.Parallelism,
+		Operation:   "commit",
+		Context:     args.Context,
+	}, func(repo *config.Repository) error {
 		res, err := repositories.Commit(repositories.CommitArgs{
 			Workspace:  args.Workspace,
-			Repository: &repo,
+			Repository: repo,
 			Message:    args.Message,
 		})
-		if err != nil {
-			errors = append(errors, err)
-		}
 		if res != nil {
+			mu.Lock()
 			results = append(results, *res)
+			mu.Unlock()
 		}
-	}
+		return err
+	})
 
 	return results, errors
 }
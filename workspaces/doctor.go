@@ -1,41 +1,612 @@
 package workspaces
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 
-	"github.com/mateothegreat/go-multilog/multilog"
+	g "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/mateothegreat/go-util/files"
 	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/git"
 )
 
-func Doctor(name string) error {
-	config, err := config.GetRelativeConfig()
+// Severity is the severity of a doctor finding.
+type Severity string
+
+const (
+	// SeverityOK means the check passed.
+	SeverityOK Severity = "ok"
+	// SeverityInfo is informational and does not need any action.
+	SeverityInfo Severity = "info"
+	// SeverityWarning is a problem that does not prevent operations from running.
+	SeverityWarning Severity = "warning"
+	// SeverityError is a problem that will cause operations to fail.
+	SeverityError Severity = "error"
+)
+
+// Finding is a single result produced by a doctor check.
+type Finding struct {
+	Check      string   `json:"check"`
+	Severity   Severity `json:"severity"`
+	Message    string   `json:"message"`
+	Repository string   `json:"repository,omitempty"`
+	Fixable    bool     `json:"fixable"`
+	Fixed      bool     `json:"fixed"`
+	FixError   string   `json:"fixError,omitempty"`
+	// Fix is an optional automatic fix for the finding.
+	Fix func() error `json:"-"`
+}
+
+// DoctorContext is the state handed to each check.
+type DoctorContext struct {
+	Config    *config.Config
+	Workspace *config.Workspace
+}
+
+// RepositoryPath returns the absolute path of a repository in the workspace.
+//
+// Arguments:
+//   - repository: The repository to get the path for.
+//
+// Returns:
+//   - string: The absolute path of the repository.
+func (c *DoctorContext) RepositoryPath(repository *config.Repository) string {
+	return fmt.Sprintf("%s/%s", c.Workspace.GetAbsolutePath(), repository.Path)
+}
+
+// Check is a single diagnostic that can be run against a workspace.
+type Check struct {
+	Name        string
+	Description string
+	Run         func(ctx *DoctorContext) []Finding
+}
+
+var (
+	checksMu sync.RWMutex
+	checks   []Check
+)
+
+// RegisterCheck adds a check to the doctor registry.
+// Registering a check with the name of an existing check replaces it.
+//
+// Arguments:
+//   - check: The check to register.
+func RegisterCheck(check Check) {
+	checksMu.Lock()
+	defer checksMu.Unlock()
+
+	for i, existing := range checks {
+		if existing.Name == check.Name {
+			checks[i] = check
+			return
+		}
+	}
+	checks = append(checks, check)
+}
+
+// Checks returns the registered checks in registration order.
+//
+// Returns:
+//   - []Check: The registered checks.
+func Checks() []Check {
+	checksMu.RLock()
+	defer checksMu.RUnlock()
+
+	return slices.Clone(checks)
+}
+
+// DoctorArgs are the arguments for running the doctor.
+type DoctorArgs struct {
+	// Config is the config to diagnose. If nil, it is loaded from Path.
+	Config *config.Config
+	// Path is the config path, when empty the config is discovered relative to the working directory.
+	Path string
+	// Name is the workspace name, when empty the workspace is found from the working directory.
+	Name string
+	// Checks limits the run to the named checks, when empty all checks are run.
+	Checks []string
+	// Fix applies the automatic fixes of any findings that have one.
+	Fix bool
+}
+
+// DoctorReport is the outcome of a doctor run.
+type DoctorReport struct {
+	Workspace string    `json:"workspace,omitempty"`
+	Findings  []Finding `json:"findings"`
+	Warnings  int       `json:"warnings"`
+	Errors    int       `json:"errors"`
+	Healthy   bool      `json:"healthy"`
+}
+
+// JSON returns the report encoded as indented JSON.
+//
+// Returns:
+//   - []byte: The encoded report.
+//   - error: An error if the report could not be encoded.
+func (r *DoctorReport) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+func (r *DoctorReport) add(findings ...Finding) {
+	for _, finding := range findings {
+		finding.Fixable = finding.Fix != nil
+		r.Findings = append(r.Findings, finding)
+	}
+}
+
+func (r *DoctorReport) summarize() {
+	r.Warnings = 0
+	r.Errors = 0
+	for _, finding := range r.Findings {
+		if finding.Fixed {
+			continue
+		}
+		switch finding.Severity {
+		case SeverityWarning:
+			r.Warnings++
+		case SeverityError:
+			r.Errors++
+		}
+	}
+	r.Healthy = r.Errors == 0
+}
+
+// Doctor diagnoses a workspace by running the registered checks against it.
+// Problems are returned as findings in the report instead of terminating the process.
+//
+// Arguments:
+//   - args: The arguments for the doctor.
+//
+// Returns:
+//   - *DoctorReport: The report containing the findings of every check.
+//   - error: An error if an unknown check was requested.
+func Doctor(args DoctorArgs) (*DoctorReport, error) {
+	registered := Checks()
+	selected := registered
+	if len(args.Checks) > 0 {
+		selected = nil
+		for _, name := range args.Checks {
+			idx := slices.IndexFunc(registered, func(c Check) bool { return c.Name == name })
+			if idx < 0 {
+				return nil, fmt.Errorf("unknown doctor check %q", name)
+			}
+			selected = append(selected, registered[idx])
+		}
+	}
+
+	report := &DoctorReport{}
+
+	cfg := args.Config
+	if cfg == nil {
+		var err error
+		cfg, err = config.GetConfig(args.Path)
+		if err != nil {
+			report.add(Finding{
+				Check:    "config",
+				Severity: SeverityError,
+				Message:  fmt.Sprintf("failed to load config: %v", err),
+			})
+			report.summarize()
+			return report, nil
+		}
+	}
+
+	var workspace *config.Workspace
+	var err error
+	if args.Name != "" {
+		workspace, err = cfg.GetWorkspace(args.Name)
+	} else {
+		workspace, err = cfg.GetWorkspaceByWorkingDir()
+	}
 	if err != nil {
-		multilog.Fatal("workspaces.doctor", "failed to get config", map[string]interface{}{
-			"error": err,
+		report.add(Finding{
+			Check:    "config",
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("failed to get workspace: %v", err),
+		})
+		report.summarize()
+		return report, nil
+	}
+	report.Workspace = workspace.Name
+
+	ctx := &DoctorContext{
+		Config:    cfg,
+		Workspace: workspace,
+	}
+
+	for _, check := range selected {
+		findings := check.Run(ctx)
+		for i := range findings {
+			findings[i].Check = check.Name
+			if args.Fix && findings[i].Fix != nil {
+				if err := findings[i].Fix(); err != nil {
+					findings[i].FixError = err.Error()
+				} else {
+					findings[i].Fixed = true
+				}
+			}
+		}
+		report.add(findings...)
+	}
+
+	report.summarize()
+	return report, nil
+}
+
+func init() {
+	RegisterCheck(Check{
+		Name:        "config",
+		Description: "validates the workspace and repository definitions",
+		Run:         checkConfig,
+	})
+	RegisterCheck(Check{
+		Name:        "git-binary",
+		Description: "ensures the git binary used for ahead/behind counts is available",
+		Run:         checkGitBinary,
+	})
+	RegisterCheck(Check{
+		Name:        "workspace-path",
+		Description: "ensures the workspace directory exists",
+		Run:         checkWorkspacePath,
+	})
+	RegisterCheck(Check{
+		Name:        "repository-path",
+		Description: "ensures every repository has been cloned",
+		Run:         checkRepositoryPaths,
+	})
+	RegisterCheck(Check{
+		Name:        "auth",
+		Description: "ensures credentials can be resolved for every repository url",
+		Run:         checkAuth,
+	})
+	RegisterCheck(Check{
+		Name:        "detached-head",
+		Description: "reports repositories that are not on a branch",
+		Run:         checkDetachedHead,
+	})
+	RegisterCheck(Check{
+		Name:        "branch-drift",
+		Description: "reports repositories that are not on their configured branch",
+		Run:         checkBranchDrift,
+	})
+	RegisterCheck(Check{
+		Name:        "commands",
+		Description: "ensures hook and runner executables can be found",
+		Run:         checkCommands,
+	})
+}
+
+func checkConfig(ctx *DoctorContext) []Finding {
+	var findings []Finding
+
+	if ctx.Workspace.Path == "" {
+		findings = append(findings, Finding{
+			Severity: SeverityError,
+			Message:  "workspace has no path",
+		})
+	}
+	if ctx.Workspace.Repositories == nil || len(*ctx.Workspace.Repositories) == 0 {
+		findings = append(findings, Finding{
+			Severity: SeverityWarning,
+			Message:  "workspace has no repositories",
+		})
+		return findings
+	}
+
+	paths := make(map[string]string)
+	for _, repo := range *ctx.Workspace.Repositories {
+		if repo.URL == "" {
+			findings = append(findings, Finding{
+				Severity:   SeverityError,
+				Message:    "repository has no url",
+				Repository: repo.Name,
+			})
+		}
+		if repo.Path == "" {
+			findings = append(findings, Finding{
+				Severity:   SeverityError,
+				Message:    "repository has no path",
+				Repository: repo.Name,
+			})
+			continue
+		}
+		if other, ok := paths[repo.Path]; ok {
+			findings = append(findings, Finding{
+				Severity:   SeverityError,
+				Message:    fmt.Sprintf("repository path %q is also used by %q", repo.Path, other),
+				Repository: repo.Name,
+			})
+		}
+		paths[repo.Path] = repo.Name
+	}
+
+	if err := ctx.Workspace.ValidateDependencies(); err != nil {
+		findings = append(findings, Finding{
+			Severity: SeverityError,
+			Message:  err.Error(),
+		})
+	}
+
+	if len(findings) == 0 {
+		findings = append(findings, Finding{
+			Severity: SeverityOK,
+			Message:  fmt.Sprintf("%d repositories configured", len(*ctx.Workspace.Repositories)),
 		})
 	}
-	// Ensure that the workspace path exists.
-	workspace, err := config.GetWorkspaceByWorkingDir()
+	return findings
+}
+
+func checkGitBinary(ctx *DoctorContext) []Finding {
+	path, err := exec.LookPath("git")
+	if err != nil {
+		return []Finding{{
+			Severity: SeverityError,
+			Message:  "git binary not found in PATH, ahead/behind status and credential helpers will not work",
+		}}
+	}
+	return []Finding{{
+		Severity: SeverityOK,
+		Message:  fmt.Sprintf("git found at %s", path),
+	}}
+}
+
+func checkWorkspacePath(ctx *DoctorContext) []Finding {
+	path := ctx.Workspace.GetAbsolutePath()
+
+	stat, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return []Finding{{
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("workspace directory %s does not exist", path),
+			Fix: func() error {
+				return os.MkdirAll(path, 0755)
+			},
+		}}
+	}
 	if err != nil {
-		multilog.Fatal("workspaces.doctor", "failed to get workspace", map[string]interface{}{
-			"error": err,
+		return []Finding{{
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("failed to stat workspace directory %s: %v", path, err),
+		}}
+	}
+	if !stat.IsDir() {
+		return []Finding{{
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("workspace path %s is not a directory", path),
+		}}
+	}
+	return []Finding{{
+		Severity: SeverityOK,
+		Message:  fmt.Sprintf("workspace directory %s exists", path),
+	}}
+}
+
+func checkRepositoryPaths(ctx *DoctorContext) []Finding {
+	var findings []Finding
+	if ctx.Workspace.Repositories == nil {
+		return findings
+	}
+
+	for _, repo := range *ctx.Workspace.Repositories {
+		path := ctx.RepositoryPath(&repo)
+
+		if _, err := os.Stat(filepath.Join(path, ".git")); err == nil {
+			continue
+		}
+
+		if _, err := os.Stat(path); err == nil {
+			findings = append(findings, Finding{
+				Severity:   SeverityError,
+				Message:    fmt.Sprintf("%s exists but is not a git repository", path),
+				Repository: repo.Name,
+			})
+			continue
+		}
+
+		findings = append(findings, Finding{
+			Severity:   SeverityWarning,
+			Message:    fmt.Sprintf("repository has not been cloned to %s", path),
+			Repository: repo.Name,
+			Fix: func() error {
+				return git.Clone(git.CloneArgs{
+					URL:  repo.URL,
+					Path: path,
+					Auth: repo.Auth,
+				})
+			},
 		})
 	}
 
-	path := workspace.GetAbsolutePath()
+	if len(findings) == 0 {
+		findings = append(findings, Finding{
+			Severity: SeverityOK,
+			Message:  "all repositories are cloned",
+		})
+	}
+	return findings
+}
+
+func checkAuth(ctx *DoctorContext) []Finding {
+	var findings []Finding
+	if ctx.Workspace.Repositories == nil {
+		return findings
+	}
+
+	seen := make(map[string]bool)
+	for _, repo := range *ctx.Workspace.Repositories {
+		if repo.URL == "" || seen[repo.URL] {
+			continue
+		}
+		seen[repo.URL] = true
+
+		auth := repo.Auth
+		if auth == nil {
+			auth = ctx.Workspace.Auth
+		}
 
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		multilog.Error("workspaces.doctor", "workspace directory does not exist", map[string]interface{}{
-			"name": name,
+		// GetAuth terminates the process on a key it cannot load so load it up front.
+		if auth != nil && auth.Key != "" {
+			if _, err := ssh.NewPublicKeysFromFile("git", files.ExpandPath(auth.Key), ""); err != nil {
+				findings = append(findings, Finding{
+					Severity:   SeverityError,
+					Message:    fmt.Sprintf("ssh key %s for %s could not be loaded: %v", auth.Key, repo.URL, err),
+					Repository: repo.Name,
+				})
+				continue
+			}
+		}
+		if auth != nil && auth.Key == "" && auth.Env.Username != "" {
+			var missing []string
+			for _, name := range []string{auth.Env.Username, auth.Env.Password} {
+				if os.Getenv(name) == "" {
+					missing = append(missing, name)
+				}
+			}
+			if len(missing) > 0 {
+				findings = append(findings, Finding{
+					Severity:   SeverityError,
+					Message:    fmt.Sprintf("environment variables %s for %s are not set", strings.Join(missing, ", "), repo.URL),
+					Repository: repo.Name,
+				})
+				continue
+			}
+		}
+
+		if git.GetAuth(repo.URL, auth) == nil {
+			findings = append(findings, Finding{
+				Severity:   SeverityWarning,
+				Message:    fmt.Sprintf("no credentials could be resolved for %s, only anonymous access will work", repo.URL),
+				Repository: repo.Name,
+			})
+		}
+	}
+
+	if len(findings) == 0 {
+		findings = append(findings, Finding{
+			Severity: SeverityOK,
+			Message:  "credentials resolved for all repository urls",
 		})
+	}
+	return findings
+}
+
+func checkDetachedHead(ctx *DoctorContext) []Finding {
+	var findings []Finding
+	if ctx.Workspace.Repositories == nil {
+		return findings
+	}
+
+	for _, repo := range *ctx.Workspace.Repositories {
+		r, err := g.PlainOpen(ctx.RepositoryPath(&repo))
+		if err != nil {
+			continue // Reported by the repository-path check.
+		}
+		head, err := r.Head()
+		if err != nil {
+			findings = append(findings, Finding{
+				Severity:   SeverityWarning,
+				Message:    fmt.Sprintf("failed to resolve HEAD: %v", err),
+				Repository: repo.Name,
+			})
+			continue
+		}
+		if !head.Name().IsBranch() {
+			findings = append(findings, Finding{
+				Severity:   SeverityWarning,
+				Message:    fmt.Sprintf("HEAD is detached at %s", head.Hash().String()[:7]),
+				Repository: repo.Name,
+			})
+		}
+	}
+	return findings
+}
+
+func checkBranchDrift(ctx *DoctorContext) []Finding {
+	var findings []Finding
+	if ctx.Workspace.Repositories == nil {
+		return findings
+	}
 
-		err := os.MkdirAll(path, 0755)
+	for _, repo := range *ctx.Workspace.Repositories {
+		if repo.Branch == "" {
+			continue
+		}
+		path := ctx.RepositoryPath(&repo)
+		r, err := g.PlainOpen(path)
 		if err != nil {
-			multilog.Fatal("workspaces.doctor", "failed to create workspace directory", map[string]interface{}{
-				"error": err,
+			continue // Reported by the repository-path check.
+		}
+		head, err := r.Head()
+		if err != nil || !head.Name().IsBranch() {
+			continue // Reported by the detached-head check.
+		}
+		if head.Name().Short() != repo.Branch {
+			branch := repo.Branch
+			findings = append(findings, Finding{
+				Severity:   SeverityWarning,
+				Message:    fmt.Sprintf("on branch %q but configured for %q", head.Name().Short(), repo.Branch),
+				Repository: repo.Name,
+				Fix: func() error {
+					return git.Switch(&git.SwitchArgs{
+						Path:   path,
+						Branch: branch,
+					})
+				},
 			})
 		}
 	}
+	return findings
+}
 
-	return nil
+func checkCommands(ctx *DoctorContext) []Finding {
+	var findings []Finding
+	if ctx.Workspace.Repositories == nil {
+		return findings
+	}
+
+	for _, repo := range *ctx.Workspace.Repositories {
+		var cmds []config.Command
+		if repo.Hooks != nil {
+			for _, hook := range *repo.Hooks {
+				cmds = append(cmds, hook.Commands...)
+			}
+		}
+		if repo.Runners != nil {
+			for _, runner := range *repo.Runners {
+				cmds = append(cmds, runner.Commands...)
+			}
+		}
+
+		for _, command := range cmds {
+			argv := command.Argv()
+			if len(argv) == 0 {
+				findings = append(findings, Finding{
+					Severity:   SeverityError,
+					Message:    fmt.Sprintf("command %q has nothing to run", command.Name),
+					Repository: repo.Name,
+				})
+				continue
+			}
+
+			executable := argv[0]
+			if strings.ContainsRune(executable, filepath.Separator) && !filepath.IsAbs(executable) {
+				executable = filepath.Join(ctx.RepositoryPath(&repo), command.Cwd, executable)
+			}
+			if _, err := exec.LookPath(executable); err != nil {
+				findings = append(findings, Finding{
+					Severity:   SeverityWarning,
+					Message:    fmt.Sprintf("executable %q for command %q not found", argv[0], command.Name),
+					Repository: repo.Name,
+				})
+			}
+		}
+	}
+	return findings
 }
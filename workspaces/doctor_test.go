@@ -1,11 +1,127 @@
 package workspaces_test
 
 import (
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/alecthomas/assert"
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/test"
 	"github.com/polyrepopro/api/workspaces"
+	"github.com/stretchr/testify/suite"
 )
 
+type DoctorSuite struct {
+	suite.Suite
+	cfg *config.Config
+}
+
 func TestDoctor(t *testing.T) {
-	workspaces.Doctor("test")
+	suite.Run(t, new(DoctorSuite))
+}
+
+func (s *DoctorSuite) SetupTest() {
+	test.Setup()
+
+	s.cfg = &config.Config{
+		Workspaces: &[]config.Workspace{
+			{
+				Name: "test",
+				Path: filepath.Join(s.T().TempDir(), "workspace"),
+				Repositories: &[]config.Repository{
+					{
+						Name: "example",
+						URL:  "https://github.com/risersh/example-test-repo.git",
+						Path: "example",
+					},
+				},
+			},
+		},
+	}
+}
+
+func (s *DoctorSuite) Test1ReportsMissingWorkspace() {
+	report, err := workspaces.Doctor(workspaces.DoctorArgs{
+		Config: s.cfg,
+		Name:   "test",
+		Checks: []string{"config", "workspace-path"},
+	})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "test", report.Workspace)
+	assert.False(s.T(), report.Healthy)
+	assert.Equal(s.T(), 1, report.Errors)
+
+	finding := report.Findings[len(report.Findings)-1]
+	assert.Equal(s.T(), "workspace-path", finding.Check)
+	assert.Equal(s.T(), workspaces.SeverityError, finding.Severity)
+	assert.True(s.T(), finding.Fixable)
+}
+
+func (s *DoctorSuite) Test2FixesMissingWorkspace() {
+	report, err := workspaces.Doctor(workspaces.DoctorArgs{
+		Config: s.cfg,
+		Name:   "test",
+		Checks: []string{"workspace-path"},
+		Fix:    true,
+	})
+	assert.NoError(s.T(), err)
+	assert.True(s.T(), report.Healthy)
+	assert.True(s.T(), report.Findings[0].Fixed)
+
+	_, err = os.Stat((*s.cfg.Workspaces)[0].Path)
+	assert.NoError(s.T(), err)
+}
+
+func (s *DoctorSuite) Test3UnknownWorkspaceIsAFinding() {
+	report, err := workspaces.Doctor(workspaces.DoctorArgs{
+		Config: s.cfg,
+		Name:   "missing",
+	})
+	assert.NoError(s.T(), err)
+	assert.False(s.T(), report.Healthy)
+	assert.Equal(s.T(), "config", report.Findings[0].Check)
+}
+
+func (s *DoctorSuite) Test4UnknownCheck() {
+	_, err := workspaces.Doctor(workspaces.DoctorArgs{
+		Config: s.cfg,
+		Name:   "test",
+		Checks: []string{"nope"},
+	})
+	assert.Error(s.T(), err)
+}
+
+func (s *DoctorSuite) Test5JSON() {
+	report, err := workspaces.Doctor(workspaces.DoctorArgs{
+		Config: s.cfg,
+		Name:   "test",
+		Checks: []string{"repository-path"},
+	})
+	assert.NoError(s.T(), err)
+
+	b, err := report.JSON()
+	assert.NoError(s.T(), err)
+
+	var decoded map[string]interface{}
+	assert.NoError(s.T(), json.Unmarshal(b, &decoded))
+	assert.Equal(s.T(), "test", decoded["workspace"])
+	assert.Equal(s.T(), 1, len(decoded["findings"].([]interface{})))
+}
+
+func (s *DoctorSuite) Test6InvalidKeyIsAFinding() {
+	key := filepath.Join(s.T().TempDir(), "id_ed25519")
+	assert.NoError(s.T(), os.WriteFile(key, []byte("not a private key"), 0600))
+	(*(*s.cfg.Workspaces)[0].Repositories)[0].Auth = &config.Auth{Key: key}
+
+	report, err := workspaces.Doctor(workspaces.DoctorArgs{
+		Config: s.cfg,
+		Name:   "test",
+		Checks: []string{"auth"},
+	})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), 1, report.Errors)
+	assert.Equal(s.T(), workspaces.SeverityError, report.Findings[0].Severity)
+	assert.Contains(s.T(), report.Findings[0].Message, "could not be loaded")
 }
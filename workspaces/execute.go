@@ -0,0 +1,219 @@
+package workspaces
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/events"
+	"github.com/polyrepopro/api/history"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ExecuteArgs are the arguments for running an operation across repositories.
+type ExecuteArgs struct {
+	Workspace *config.Workspace
+	// Repositories limits the operation to these repositories, when nil the
+	// repositories of the workspace matched by Selector are used.
+	Repositories []config.Repository
+	// Selector filters the repositories of the workspace, nil selects all of them.
+	Selector *config.Selector
+	// Ordered runs the repositories level by level in dependency order.
+	Ordered bool
+	// Parallelism is the maximum number of repositories operated on at once
+	// within a level, zero means no limit.
+	Parallelism int
+	// Operation is the name of the operation, such as "pull". When set, events
+	// are published when the operation and each repository start and finish,
+	// and operations that change repositories are recorded in history.Default().
+	Operation string
+	// Context carries the trace the operation is part of, nil starts a new trace.
+	Context context.Context
+}
+
+// tracer returns the tracer of workspace operations from the global tracer
+// provider, which records nothing until monitoring.SetupTracing installs an exporter.
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/polyrepopro/api/workspaces")
+}
+
+// Execute runs fn for each repository of a workspace, see ExecuteContext.
+//
+// Arguments:
+//   - args: The arguments for the execution.
+//   - fn: The operation to run for each repository.
+//
+// Returns:
+//   - []error: The errors returned by the operation or for skipped repositories.
+func Execute(args ExecuteArgs, fn func(repo *config.Repository) error) []error {
+	return ExecuteContext(args, func(_ context.Context, repo *config.Repository) error {
+		return fn(repo)
+	})
+}
+
+// ExecuteContext runs fn for each repository of a workspace.
+// When ordered, a repository is only run once all of its dependencies have
+// completed and it is skipped if any of them failed.
+// When args.Operation is set, OperationStarted and OperationFinished events are
+// published for the workspace and for every repository, and the ref of every
+// repository before and after a mutating operation is recorded in history.Default().
+//
+// The operation is traced with a span for the workspace and a child span for
+// every repository, fn receives the context of the repository span so that
+// the git steps it runs are traced as its children.
+//
+// Arguments:
+//   - args: The arguments for the execution.
+//   - fn: The operation to run for each repository.
+//
+// Returns:
+//   - []error: The errors returned by the operation or for skipped repositories.
+func ExecuteContext(args ExecuteArgs, fn func(ctx context.Context, repo *config.Repository) error) []error {
+	repositories := args.Repositories
+	if repositories == nil {
+		repositories = args.Workspace.SelectRepositories(args.Selector)
+	}
+
+	levels := [][]config.Repository{repositories}
+	if args.Ordered {
+		var err error
+		levels, err = args.Workspace.GetRepositoryLevels(repositories)
+		if err != nil {
+			return []error{err}
+		}
+	}
+
+	var mu sync.Mutex
+	var errors []error
+	failed := make(map[string]bool)
+	recording := args.newRecorder()
+
+	ctx, span := args.startSpan(args.Context, "workspace", "",
+		attribute.Int("polyrepo.repositories", len(repositories)),
+		attribute.Bool("polyrepo.ordered", args.Ordered))
+	args.publish(events.OperationStarted, "", nil)
+	defer func() {
+		err := operationError(errors)
+		args.publish(events.OperationFinished, "", err)
+		endSpan(span, err)
+	}()
+
+	for _, level := range levels {
+		limit := args.Parallelism
+		if limit <= 0 || limit > len(level) {
+			limit = len(level)
+		}
+		sem := make(chan struct{}, max(limit, 1))
+
+		var wg sync.WaitGroup
+		for _, repo := range level {
+			if args.Ordered {
+				// Repositories of the level still running write failed concurrently.
+				mu.Lock()
+				dep := failedDependency(repo, failed)
+				var err error
+				if dep != "" {
+					failed[repo.Name] = true
+					err = fmt.Errorf("skipped %s: dependency %s failed", repo.Name, dep)
+					errors = append(errors, err)
+				}
+				mu.Unlock()
+				if err != nil {
+					_, span := args.startSpan(ctx, "repository", repo.Name, attribute.Bool("polyrepo.skipped", true))
+					endSpan(span, err)
+					recording.start(repo)(history.Skipped, err)
+					args.publish(events.OperationFinished, repo.Name, err)
+					continue
+				}
+			}
+
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				ctx, span := args.startSpan(ctx, "repository", repo.Name, attribute.String("polyrepo.path", repo.Path))
+				args.publish(events.OperationStarted, repo.Name, nil)
+				record := recording.start(repo)
+				err := fn(ctx, &repo)
+				record(outcome(err), err)
+				args.publish(events.OperationFinished, repo.Name, err)
+				endSpan(span, err)
+				if err != nil {
+					mu.Lock()
+					failed[repo.Name] = true
+					errors = append(errors, err)
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	return errors
+}
+
+// publish publishes an operation event if the execution has an operation name.
+func (args ExecuteArgs) publish(typ events.Type, repository string, err error) {
+	if args.Operation == "" {
+		return
+	}
+	event := events.Event{
+		Type:       typ,
+		Operation:  args.Operation,
+		Workspace:  args.Workspace.Name,
+		Repository: repository,
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	events.Publish(event)
+}
+
+// startSpan starts a span named after the kind and operation, such as "workspace.pull".
+func (args ExecuteArgs) startSpan(ctx context.Context, kind string, repository string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	operation := args.Operation
+	if operation == "" {
+		operation = "execute"
+	}
+	attrs = append(attrs,
+		attribute.String("polyrepo.operation", operation),
+		attribute.String("polyrepo.workspace", args.Workspace.Name))
+	if repository != "" {
+		attrs = append(attrs, attribute.String("polyrepo.repository", repository))
+	}
+	return tracer().Start(ctx, kind+"."+operation, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends a span, recording the error if the operation failed.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func operationError(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of the repositories failed", len(errs))
+}
+
+func failedDependency(repo config.Repository, failed map[string]bool) string {
+	for _, dep := range repo.DependsOn {
+		if failed[dep] {
+			return dep
+		}
+	}
+	return ""
+}
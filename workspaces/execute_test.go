@@ -0,0 +1,88 @@
+package workspaces
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/alecthomas/assert"
+	"github.com/polyrepopro/api/config"
+)
+
+func TestExecuteOrdered(t *testing.T) {
+	workspace := &config.Workspace{
+		Name: "test",
+		Repositories: &[]config.Repository{
+			{Name: "web", DependsOn: []string{"api"}},
+			{Name: "api", DependsOn: []string{"lib"}},
+			{Name: "lib"},
+			{Name: "docs"},
+		},
+	}
+
+	var mu sync.Mutex
+	var order []string
+	errs := Execute(ExecuteArgs{
+		Workspace:   workspace,
+		Ordered:     true,
+		Parallelism: 1,
+	}, func(repo *config.Repository) error {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, repo.Name)
+		return nil
+	})
+	assert.Equal(t, 0, len(errs))
+	assert.Equal(t, []string{"lib", "docs", "api", "web"}, order)
+}
+
+func TestExecuteSkipsDependentsOfFailures(t *testing.T) {
+	workspace := &config.Workspace{
+		Name: "test",
+		Repositories: &[]config.Repository{
+			{Name: "lib"},
+			{Name: "api", DependsOn: []string{"lib"}},
+			{Name: "web", DependsOn: []string{"api"}},
+			{Name: "docs"},
+		},
+	}
+
+	var mu sync.Mutex
+	var ran []string
+	errs := Execute(ExecuteArgs{
+		Workspace: workspace,
+		Ordered:   true,
+	}, func(repo *config.Repository) error {
+		mu.Lock()
+		ran = append(ran, repo.Name)
+		mu.Unlock()
+		if repo.Name == "lib" {
+			return fmt.Errorf("lib failed")
+		}
+		return nil
+	})
+	assert.Equal(t, 3, len(errs))
+	assert.Equal(t, 2, len(ran))
+}
+
+func TestExecuteOrderedFailuresWithinALevel(t *testing.T) {
+	repositories := []config.Repository{{Name: "lib"}}
+	for i := 0; i < 20; i++ {
+		repositories = append(repositories, config.Repository{Name: fmt.Sprintf("service-%d", i), DependsOn: []string{"lib"}})
+	}
+	repositories = append(repositories, config.Repository{Name: "web", DependsOn: []string{"service-0"}})
+	workspace := &config.Workspace{Name: "test", Repositories: &repositories}
+
+	// Every service fails while the loop is still checking the dependencies of the others.
+	errs := Execute(ExecuteArgs{
+		Workspace: workspace,
+		Ordered:   true,
+	}, func(repo *config.Repository) error {
+		if repo.Name != "lib" {
+			return fmt.Errorf("%s failed", repo.Name)
+		}
+		return nil
+	})
+	assert.Equal(t, 21, len(errs))
+	assert.EqualError(t, errs[len(errs)-1], "skipped web: dependency service-0 failed")
+}
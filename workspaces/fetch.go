@@ -0,0 +1,58 @@
+package workspaces
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/events"
+	"github.com/polyrepopro/api/git"
+)
+
+// FetchArgs are the arguments for fetching every repository in a workspace.
+type FetchArgs struct {
+	Workspace *config.Workspace
+	// Selector limits the operation to the matching repositories.
+	Selector *config.Selector
+	// Ordered fetches repositories after the repositories they depend on.
+	Ordered bool
+	// Parallelism is the maximum number of repositories fetched at once, zero means no limit.
+	Parallelism int
+	// Context carries the trace the operation is part of and cancelling it aborts
+	// running fetches, nil starts a new trace.
+	Context context.Context
+}
+
+// Fetch fetches the remote of each repository in the workspace without touching the worktrees.
+//
+// Arguments:
+//   - args: The arguments for the fetch.
+//
+// Returns:
+//   - []error: The errors of the repositories that could not be fetched.
+func Fetch(args FetchArgs) []error {
+	return ExecuteContext(ExecuteArgs{
+		Workspace:   args.Workspace,
+		Selector:    args.Selector,
+		Ordered:     args.Ordered,
+		Parallelism: args.Parallelism,
+		Operation:   "fetch",
+		Context:     args.Context,
+	}, func(ctx context.Context, repo *config.Repository) error {
+		remote := repo.Origin
+		if remote == "" {
+			remote = "origin"
+		}
+		err := git.Fetch(ctx, git.FetchArgs{
+			URL:      repo.URL,
+			Remote:   remote,
+			Path:     fmt.Sprintf("%s/%s", args.Workspace.GetAbsolutePath(), repo.Path),
+			Auth:     repo.Auth,
+			Progress: events.NewProgress("fetch", args.Workspace.Name, repo.Name),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to fetch %s: %w", repo.Name, err)
+		}
+		return nil
+	})
+}
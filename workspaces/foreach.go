@@ -0,0 +1,200 @@
+package workspaces
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+
+	"github.com/mateothegreat/go-util/files"
+	"github.com/polyrepopro/api/commands"
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/logs"
+)
+
+// ForeachArgs are the arguments for running a command in every repository.
+type ForeachArgs struct {
+	Workspace *config.Workspace
+	// Selector limits the command to the matching repositories.
+	Selector *config.Selector
+	// Command is the argv to run, ignored when Shell is set.
+	Command []string
+	// Shell is a script run with the interpreter instead of Command.
+	Shell string
+	// Interpreter runs Shell, config.DefaultInterpreter when empty.
+	Interpreter string
+	// Env is added to the environment of the command, on top of the
+	// environment of the workspace and repository.
+	Env map[string]string
+	// Expand expands the templates in Command, Shell and Env for each repository, see commands.Vars.
+	Expand bool
+	// Parallelism is the maximum number of repositories running at once, zero uses the number of CPUs.
+	Parallelism int
+	// FailFast stops the remaining repositories once a command fails.
+	FailFast bool
+	// Stream receives the output of every repository as it is produced, each
+	// line prefixed with the repository name and the values of secret variables masked.
+	Stream io.Writer
+	// Context carries the trace the operation is part of and cancelling it stops
+	// every command, nil starts a new trace.
+	Context context.Context
+}
+
+// ForeachResult is the outcome of running the command in a single repository.
+type ForeachResult struct {
+	Repository string `json:"repository"`
+	Path       string `json:"path"`
+	// ExitCode is the exit code of the command, -1 if it could not be started or was terminated by a signal.
+	ExitCode int `json:"exitCode"`
+	// Output is the tail of the combined stdout and stderr, see commands.Result.
+	Output    string        `json:"output"`
+	Truncated bool          `json:"truncated,omitempty"`
+	Duration  time.Duration `json:"duration"`
+	Error     string        `json:"error,omitempty"`
+	Skipped   bool          `json:"skipped"`
+}
+
+// ForeachSummary is the outcome of running a command across a workspace.
+type ForeachSummary struct {
+	Results   []ForeachResult `json:"results"`
+	Succeeded int             `json:"succeeded"`
+	Failed    int             `json:"failed"`
+	Skipped   int             `json:"skipped"`
+}
+
+// Foreach runs an ad-hoc command in every selected repository of a workspace.
+//
+// Arguments:
+//   - args: The arguments for the command.
+//
+// Returns:
+//   - *ForeachSummary: The result of every repository in configured order.
+//   - error: An error if the command is empty.
+func Foreach(args ForeachArgs) (*ForeachSummary, error) {
+	if args.Shell == "" && len(args.Command) == 0 {
+		return nil, fmt.Errorf("no command provided")
+	}
+
+	parallelism := args.Parallelism
+	if parallelism <= 0 {
+		parallelism = runtime.NumCPU()
+	}
+
+	ctx := args.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	repositories := args.Workspace.SelectRepositories(args.Selector)
+	results := make([]ForeachResult, len(repositories))
+	index := make(map[string]int, len(repositories))
+	for i, repo := range repositories {
+		index[repo.Name+"\x00"+repo.Path] = i
+		results[i] = ForeachResult{
+			Repository: repo.Name,
+			Path:       fmt.Sprintf("%s/%s", files.ExpandPath(args.Workspace.Path), repo.Path),
+		}
+	}
+
+	var stream *logs.Multiplexer
+	if args.Stream != nil {
+		names := make([]string, 0, len(repositories))
+		for _, repo := range repositories {
+			names = append(names, repo.Name)
+		}
+		stream = logs.NewMultiplexer(args.Stream, false, names...)
+	}
+	ExecuteContext(ExecuteArgs{
+		Workspace:    args.Workspace,
+		Repositories: repositories,
+		Parallelism:  parallelism,
+		Operation:    "foreach",
+		Context:      ctx,
+	}, func(ctx context.Context, repo *config.Repository) error {
+		result := &results[index[repo.Name+"\x00"+repo.Path]]
+		if ctx.Err() != nil {
+			result.Skipped = true
+			return nil
+		}
+
+		// Each repository expands its own copy of the arguments.
+		run := args
+		var err error
+		if args.Expand {
+			run, err = foreachExpand(args, commands.NewVars(args.Workspace, repo))
+		}
+		if err == nil {
+			err = foreachRun(ctx, run, repo, result, stream)
+		} else {
+			result.ExitCode = -1
+			result.Error = err.Error()
+			err = fmt.Errorf("%s: %w", repo.Name, err)
+		}
+		if err != nil && args.FailFast {
+			cancel()
+		}
+		return err
+	})
+
+	summary := &ForeachSummary{Results: results}
+	for _, result := range results {
+		switch {
+		case result.Skipped:
+			summary.Skipped++
+		case result.Error != "":
+			summary.Failed++
+		default:
+			summary.Succeeded++
+		}
+	}
+	return summary, nil
+}
+
+// foreachExpand returns a copy of the arguments with the command templates expanded.
+func foreachExpand(args ForeachArgs, vars *commands.Vars) (ForeachArgs, error) {
+	command := config.Command{Name: "foreach", Command: args.Command, Shell: args.Shell, Env: args.Env}
+	expanded, err := vars.ExpandCommand(command)
+	if err != nil {
+		return args, err
+	}
+	args.Command = expanded.Command
+	args.Shell = expanded.Shell
+	args.Env = expanded.Env
+	return args, nil
+}
+
+func foreachRun(ctx context.Context, args ForeachArgs, repo *config.Repository, result *ForeachResult, stream *logs.Multiplexer) error {
+	command := config.Command{
+		Name:        "foreach",
+		Command:     args.Command,
+		Shell:       args.Shell,
+		Interpreter: args.Interpreter,
+		Env:         args.Env,
+	}
+	command = commands.InheritEnvironment([]config.Command{command}, args.Workspace.GetEnvironment(repo), result.Path)[0]
+
+	output := &commands.Output{Mask: true, Capture: commands.DefaultCapture, Quiet: true}
+	if stream != nil {
+		w := stream.Writer(result.Repository)
+		defer w.Flush()
+		output.Stdout = w
+		output.Stderr = w
+	}
+
+	res, err := commands.Run(ctx, result.Repository, command, result.Path, output)
+	result.ExitCode = -1
+	if res != nil {
+		result.ExitCode = res.ExitCode
+		result.Output = res.Output
+		result.Truncated = res.Truncated
+		result.Duration = res.Duration
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return fmt.Errorf("%s: %w", result.Repository, err)
+	}
+	return nil
+}
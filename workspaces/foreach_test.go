@@ -0,0 +1,133 @@
+package workspaces
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert"
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/test"
+	"github.com/stretchr/testify/suite"
+)
+
+type ForeachSuite struct {
+	suite.Suite
+	workspace *config.Workspace
+}
+
+func TestForeach(t *testing.T) {
+	suite.Run(t, new(ForeachSuite))
+}
+
+func (s *ForeachSuite) SetupTest() {
+	test.Setup()
+
+	path := s.T().TempDir()
+	s.workspace = &config.Workspace{
+		Name: "test",
+		Path: path,
+		Repositories: &[]config.Repository{
+			{Name: "a", Path: "a", Tags: []string{"odd"}},
+			{Name: "b", Path: "b"},
+			{Name: "c", Path: "c", Tags: []string{"odd"}},
+		},
+	}
+	for _, repo := range *s.workspace.Repositories {
+		assert.NoError(s.T(), os.MkdirAll(filepath.Join(path, repo.Path), 0755))
+	}
+}
+
+func (s *ForeachSuite) Test1Argv() {
+	var stream bytes.Buffer
+	summary, err := Foreach(ForeachArgs{
+		Workspace: s.workspace,
+		Command:   []string{"pwd"},
+		Stream:    &stream,
+	})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), 3, summary.Succeeded)
+
+	for _, result := range summary.Results {
+		assert.Equal(s.T(), 0, result.ExitCode)
+		assert.True(s.T(), strings.HasSuffix(strings.TrimSpace(result.Output), "/"+result.Repository))
+		assert.Contains(s.T(), stream.String(), result.Repository+" | ")
+	}
+}
+
+func (s *ForeachSuite) Test2ShellWithSelector() {
+	summary, err := Foreach(ForeachArgs{
+		Workspace: s.workspace,
+		Selector:  config.MustParseSelector("odd"),
+		Shell:     "echo out && echo err >&2 && exit 3",
+	})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), 2, len(summary.Results))
+	assert.Equal(s.T(), 2, summary.Failed)
+	assert.Equal(s.T(), 3, summary.Results[0].ExitCode)
+	assert.Contains(s.T(), summary.Results[0].Output, "out\n")
+	assert.Contains(s.T(), summary.Results[0].Output, "err\n")
+}
+
+func (s *ForeachSuite) Test3FailFast() {
+	summary, err := Foreach(ForeachArgs{
+		Workspace:   s.workspace,
+		Shell:       "exit 1",
+		Parallelism: 1,
+		FailFast:    true,
+	})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), 1, summary.Failed)
+	assert.Equal(s.T(), 2, summary.Skipped)
+}
+
+func (s *ForeachSuite) Test4Expand() {
+	summary, err := Foreach(ForeachArgs{
+		Workspace: s.workspace,
+		Selector:  config.MustParseSelector("name=a"),
+		Command:   []string{"echo", "{{ .Workspace.Name }}/{{ .Repository.Name }}", "${GREETING}"},
+		Env:       map[string]string{"GREETING": "hello {{ join .Repository.Tags \",\" }}"},
+		Expand:    true,
+	})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "test/a ${GREETING}\n", summary.Results[0].Output)
+
+	summary, err = Foreach(ForeachArgs{
+		Workspace: s.workspace,
+		Selector:  config.MustParseSelector("name=a"),
+		Shell:     "echo $GREETING",
+		Env:       map[string]string{"GREETING": "hello {{ join .Repository.Tags \",\" }}"},
+		Expand:    true,
+	})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "hello odd\n", summary.Results[0].Output)
+}
+
+func (s *ForeachSuite) Test5ExpandsEveryRepository() {
+	summary, err := Foreach(ForeachArgs{
+		Workspace: s.workspace,
+		Shell:     "echo {{ .Repository.Name }}",
+		Expand:    true,
+	})
+	assert.NoError(s.T(), err)
+	for _, result := range summary.Results {
+		assert.Equal(s.T(), result.Repository+"\n", result.Output)
+	}
+}
+
+func (s *ForeachSuite) Test6MasksSecrets() {
+	var stream bytes.Buffer
+	summary, err := Foreach(ForeachArgs{
+		Workspace:   s.workspace,
+		Selector:    config.MustParseSelector("name=a"),
+		Shell:       "echo token=$API_TOKEN",
+		Interpreter: "bash",
+		Env:         map[string]string{"API_TOKEN": "supersecret"},
+		Stream:      &stream,
+	})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "token=****\n", summary.Results[0].Output)
+	assert.Equal(s.T(), "a | token=****\n", stream.String())
+}
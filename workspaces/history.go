@@ -0,0 +1,99 @@
+package workspaces
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/mateothegreat/go-multilog/multilog"
+	"github.com/mateothegreat/go-util/files"
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/git"
+	"github.com/polyrepopro/api/history"
+)
+
+// mutatingOperations are the operations recorded in the history.
+var mutatingOperations = map[string]bool{
+	"commit":  true,
+	"foreach": true,
+	"hooks":   true,
+	"pull":    true,
+	"push":    true,
+	"switch":  true,
+	"sync":    true,
+	"tag":     true,
+	"undo":    true,
+}
+
+// recorder records the repositories of one operation in the default history.
+type recorder struct {
+	store     *history.Store
+	id        string
+	operation string
+	workspace *config.Workspace
+}
+
+// newRecorder returns a recorder for the operation, or nil when the operation
+// does not change repositories or no history is set up.
+func (args ExecuteArgs) newRecorder() *recorder {
+	store := history.Default()
+	if store == nil || !mutatingOperations[args.Operation] {
+		return nil
+	}
+	return &recorder{
+		store:     store,
+		id:        history.NewID(),
+		operation: args.Operation,
+		workspace: args.Workspace,
+	}
+}
+
+// start captures the ref of a repository before it is operated on and
+// returns the function that records the outcome.
+func (r *recorder) start(repo config.Repository) func(outcome history.Outcome, err error) {
+	if r == nil {
+		return func(history.Outcome, error) {}
+	}
+
+	entry := history.Entry{
+		ID:         r.id,
+		Time:       time.Now(),
+		Operation:  r.operation,
+		Workspace:  r.workspace.Name,
+		Repository: repo.Name,
+		Path:       filepath.Join(files.ExpandPath(r.workspace.Path), repo.Path),
+	}
+	entry.Before = ref(entry.Path)
+
+	return func(outcome history.Outcome, err error) {
+		entry.After = ref(entry.Path)
+		entry.Outcome = outcome
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		if err := r.store.Append(entry); err != nil {
+			multilog.Error("workspaces.history", "failed to record operation", map[string]interface{}{
+				"operation":  entry.Operation,
+				"repository": entry.Repository,
+				"error":      err.Error(),
+			})
+		}
+	}
+}
+
+// ref returns where HEAD of the repository points, empty if it cannot be resolved
+// such as before a repository is cloned.
+func ref(path string) history.Ref {
+	branch, commit, err := git.HeadRef(path)
+	if err != nil {
+		return history.Ref{}
+	}
+	return history.Ref{Branch: branch, Commit: commit}
+}
+
+// outcome returns the outcome of an operation that returned err.
+func outcome(err error) history.Outcome {
+	if err != nil {
+		return history.Failed
+	}
+	return history.Succeeded
+}
@@ -0,0 +1,76 @@
+package workspaces
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert"
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/history"
+	"github.com/polyrepopro/api/test"
+)
+
+func TestHistory(t *testing.T) {
+	test.Setup()
+
+	base := t.TempDir()
+	run := func(dir string, args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com", "GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		out, err := cmd.CombinedOutput()
+		assert.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+	for _, name := range []string{"api", "web"} {
+		path := filepath.Join(base, "workspace", name)
+		run("", "init", "-q", "-b", "main", path)
+		run(path, "commit", "-q", "--allow-empty", "-m", "initial")
+	}
+	api := filepath.Join(base, "workspace", "api")
+	main := run(api, "rev-parse", "HEAD")
+	run(api, "checkout", "-q", "-b", "feature")
+	run(api, "commit", "-q", "--allow-empty", "-m", "feature")
+	feature := run(api, "rev-parse", "HEAD")
+	run(api, "checkout", "-q", "main")
+	web := run(filepath.Join(base, "workspace", "web"), "rev-parse", "HEAD")
+
+	store, err := history.Open(filepath.Join(base, "history.jsonl"))
+	assert.NoError(t, err)
+	history.SetDefault(store)
+	defer history.SetDefault(nil)
+
+	workspace := &config.Workspace{
+		Name: "test",
+		Path: filepath.Join(base, "workspace"),
+		Repositories: &[]config.Repository{
+			{Name: "api", Path: "api"},
+			{Name: "web", Path: "web"},
+		},
+	}
+	// The web repository has no feature branch.
+	assert.Equal(t, 1, len(Switch(SwitchArgs{Workspace: workspace, Branch: "feature"})))
+	// Operations that do not change repositories are not recorded.
+	assert.Equal(t, 0, len(Execute(ExecuteArgs{Workspace: workspace, Operation: "status"}, func(*config.Repository) error { return nil })))
+
+	entries, err := store.List(history.ListArgs{Operation: "switch"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(entries))
+	all, err := store.List(history.ListArgs{})
+	assert.NoError(t, err)
+	assert.Equal(t, entries, all)
+	assert.Equal(t, entries[0].ID, entries[1].ID)
+
+	byName := map[string]history.Entry{entries[0].Repository: entries[0], entries[1].Repository: entries[1]}
+	assert.Equal(t, history.Succeeded, byName["api"].Outcome)
+	assert.Equal(t, api, byName["api"].Path)
+	assert.Equal(t, history.Ref{Branch: "main", Commit: main}, byName["api"].Before)
+	assert.Equal(t, history.Ref{Branch: "feature", Commit: feature}, byName["api"].After)
+	assert.Equal(t, history.Failed, byName["web"].Outcome)
+	assert.Contains(t, byName["web"].Error, `failed to checkout branch "feature"`)
+	assert.Equal(t, history.Ref{Branch: "main", Commit: web}, byName["web"].Before)
+	assert.Equal(t, byName["web"].Before, byName["web"].After)
+}
@@ -0,0 +1,59 @@
+package workspaces
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mateothegreat/go-util/files"
+	"github.com/polyrepopro/api/commands"
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/hooks"
+)
+
+// RunHooksArgs are the arguments for running hooks across a workspace.
+type RunHooksArgs struct {
+	Workspace *config.Workspace
+	Type      config.HookType
+	// Selector limits the operation to the matching repositories.
+	Selector *config.Selector
+	// Ordered runs the hooks of a repository after those of its dependencies.
+	Ordered bool
+	// Parallelism is the maximum number of repositories running hooks at once, zero means no limit.
+	Parallelism int
+	// Context carries the trace the operation is part of and cancelling it stops
+	// the hook commands, nil starts a new trace.
+	Context context.Context
+}
+
+// RunHooks runs the hooks of the given type for each repository in the workspace.
+//
+// Arguments:
+//   - args: The arguments for running the hooks.
+//
+// Returns:
+//   - []error: The errors of the repositories whose hooks failed.
+func RunHooks(args RunHooksArgs) []error {
+	return ExecuteContext(ExecuteArgs{
+		Workspace:   args.Workspace,
+		Selector:    args.Selector,
+		Ordered:     args.Ordered,
+		Parallelism: args.Parallelism,
+		Operation:   "hooks",
+		Context:     args.Context,
+	}, func(ctx context.Context, repo *config.Repository) error {
+		if repo.Hooks == nil {
+			return nil
+		}
+		for _, hook := range *repo.Hooks {
+			if hook.Type != args.Type {
+				continue
+			}
+			path := fmt.Sprintf("%s/%s", files.ExpandPath(args.Workspace.Path), repo.Path)
+			hook.Commands = commands.InheritEnvironment(hook.Commands, args.Workspace.GetEnvironment(repo), path)
+			if _, err := hooks.Run(ctx, &hook, path, commands.NewVars(args.Workspace, repo)); err != nil {
+				return fmt.Errorf("%s hook failed for %s: %w", hook.Type, repo.Name, err)
+			}
+		}
+		return nil
+	})
+}
@@ -1,25 +1,38 @@
 package workspaces
 
 import (
+	"context"
+
 	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/git"
 	"github.com/polyrepopro/api/repositories"
 )
 
 type PullArgs struct {
 	Workspace *config.Workspace
+	// Selector limits the operation to the matching repositories.
+	Selector *config.Selector
+	// Ordered pulls repositories after the repositories they depend on.
+	Ordered bool
+	// Parallelism is the maximum number of repositories pulled at once, zero means no limit.
+	Parallelism int
+	// Context carries the trace the operation is part of, nil starts a new trace.
+	Context context.Context
 }
 
 func Pull(args PullArgs) []error {
-	var errors []error
-
-	for _, repo := range *args.Workspace.Repositories {
-		err := repositories.Pull(repositories.PullArgs{
+	return ExecuteContext(ExecuteArgs{
+		Workspace:   args.Workspace,
+		Selector:    args.Selector,
+		Ordered:     args.Ordered,
+		Parallelism: args.Parallelism,
+		Operation:   "pull",
+		Context:     args.Context,
+	}, func(ctx context.Context, repo *config.Repository) error {
+		return repositories.Pull(repositories.PullArgs{
+			PullArgs:   git.PullArgs{Context: ctx},
 			Workspace:  args.Workspace,
-			Repository: &repo,
+			Repository: repo,
 		})
-		if err != nil {
-			errors = append(errors, err)
-		}
-	}
-	return errors
+	})
 }
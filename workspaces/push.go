@@ -1,7 +1,7 @@
 package workspaces
 
 import (
-	"sync"
+	"context"
 
 	"github.com/polyrepopro/api/config"
 	"github.com/polyrepopro/api/git"
@@ -10,28 +10,32 @@ import (
 
 type PushArgs struct {
 	Workspace *config.Workspace
+	// Selector limits the operation to the matching repositories.
+	Selector *config.Selector
+	// Ordered pushes repositories after the repositories they depend on.
+	Ordered bool
+	// Parallelism is the maximum number of concurrent pushes, zero means no limit.
+	Parallelism int
+	// Context carries the trace the operation is part of, nil starts a new trace.
+	Context context.Context
 }
 
 func Push(args PushArgs) []error {
-	var errors []error
-
-	var wg sync.WaitGroup
-	for _, repo := range *args.Workspace.Repositories {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			err := repositories.Push(repositories.PushArgs{
-				PushArgs: git.PushArgs{
-					Remote: repo.Origin,
-				},
-				Workspace:  args.Workspace,
-				Repository: &repo,
-			})
-			if err != nil {
-				errors = append(errors, err)
-			}
-		}()
-	}
-	wg.Wait()
-	return errors
+	return ExecuteContext(ExecuteArgs{
+		Workspace:   args.Workspace,
+		Selector:    args.Selector,
+		Ordered:     args.Ordered,
+		Parallelism: args.Parallelism,
+		Operation:   "push",
+		Context:     args.Context,
+	}, func(ctx context.Context, repo *config.Repository) error {
+		return repositories.Push(repositories.PushArgs{
+			PushArgs: git.PushArgs{
+				Remote:  repo.Origin,
+				Context: ctx,
+			},
+			Workspace:  args.Workspace,
+			Repository: repo,
+		})
+	})
 }
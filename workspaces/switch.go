@@ -1,6 +1,7 @@
 package workspaces
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/mateothegreat/go-util/files"
@@ -11,19 +12,29 @@ import (
 type SwitchArgs struct {
 	Workspace *config.Workspace
 	Branch    string
+	// Selector limits the operation to the matching repositories.
+	Selector *config.Selector
+	// Ordered switches repositories after the repositories they depend on.
+	Ordered bool
+	// Parallelism is the maximum number of repositories switched at once, zero means no limit.
+	Parallelism int
+	// Context carries the trace the operation is part of, nil starts a new trace.
+	Context context.Context
 }
 
 func Switch(args SwitchArgs) []error {
-	var errors []error
-
-	for _, repo := range *args.Workspace.Repositories {
-		err := git.Switch(&git.SwitchArgs{
-			Path:   fmt.Sprintf("%s/%s", files.ExpandPath(args.Workspace.Path), repo.Path),
-			Branch: args.Branch,
+	return ExecuteContext(ExecuteArgs{
+		Workspace:   args.Workspace,
+		Selector:    args.Selector,
+		Ordered:     args.Ordered,
+		Parallelism: args.Parallelism,
+		Operation:   "switch",
+		Context:     args.Context,
+	}, func(ctx context.Context, repo *config.Repository) error {
+		return git.Switch(&git.SwitchArgs{
+			Path:    fmt.Sprintf("%s/%s", files.ExpandPath(args.Workspace.Path), repo.Path),
+			Branch:  args.Branch,
+			Context: ctx,
 		})
-		if err != nil {
-			errors = append(errors, err)
-		}
-	}
-	return errors
+	})
 }
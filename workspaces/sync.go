@@ -1,18 +1,24 @@
 package workspaces
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"sync"
 
 	"github.com/mateothegreat/go-util/files"
 	"github.com/polyrepopro/api/config"
-	"github.com/polyrepopro/api/git"
 	"github.com/polyrepopro/api/repositories"
 )
 
 type SyncArgs struct {
 	config.DefaultArgs
 	Name string
+	// Selector limits the operation to the matching repositories.
+	Selector *config.Selector
+	// Context carries the trace the operation is part of, nil starts a new trace.
+	Context context.Context
 }
 
 func SyncAll(args *SyncArgs) ([]string, []error) {
@@ -28,6 +34,8 @@ func SyncAll(args *SyncArgs) ([]string, []error) {
 		}
 		if args != nil {
 			syncArgs.DefaultArgs = args.DefaultArgs
+			syncArgs.Selector = args.Selector
+			syncArgs.Context = args.Context
 		}
 
 		m, err := Sync(syncArgs)
@@ -65,28 +73,46 @@ func Sync(args SyncArgs) ([]string, error) {
 		ret = append(ret, fmt.Sprintf("created workspace directory %s", workspacePath))
 	}
 
-	for _, repo := range *workspace.Repositories {
+	// Repositories are synced one at a time so the messages stay in order, and
+	// the sync is recorded in the history so the clones and updates can be undone.
+	var mu sync.Mutex
+	errs := ExecuteContext(ExecuteArgs{
+		Workspace:   workspace,
+		Selector:    args.Selector,
+		Parallelism: 1,
+		Operation:   "sync",
+		Context:     args.Context,
+	}, func(ctx context.Context, repo *config.Repository) error {
 		repoPath := fmt.Sprintf("%s/%s", workspacePath, repo.Path)
 
 		if _, err := os.Stat(repoPath); os.IsNotExist(err) {
-			err = git.Clone(git.CloneArgs{
-				URL:  repo.URL,
-				Path: repoPath,
-				Auth: repo.Auth,
+			err = repositories.Clone(repositories.CloneArgs{
+				Workspace:  workspace,
+				Repository: repo,
+				Auth:       repo.Auth,
+				Context:    ctx,
 			})
 			if err != nil {
-				return nil, err
+				return err
 			}
 
+			mu.Lock()
 			ret = append(ret, fmt.Sprintf("cloned new repository %s", repo.URL))
+			mu.Unlock()
 		}
 
-		err := repositories.Update(workspace, &repo)
+		err := repositories.Update(workspace, repo)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
+		mu.Lock()
 		ret = append(ret, fmt.Sprintf("updated repository %s", repo.URL))
+		mu.Unlock()
+		return nil
+	})
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
 	}
 
 	return ret, nil
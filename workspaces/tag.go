@@ -0,0 +1,67 @@
+package workspaces
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mateothegreat/go-util/files"
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/git"
+	"github.com/polyrepopro/api/repositories"
+)
+
+// TagArgs are the arguments for tagging every repository in a workspace.
+type TagArgs struct {
+	Workspace *config.Workspace
+	Name      string
+	Message   string
+	// Selector limits the operation to the matching repositories.
+	Selector *config.Selector
+	// Push pushes the tag to each repository's remote after creating it.
+	Push bool
+	// Ordered tags repositories after the repositories they depend on.
+	Ordered bool
+	// Parallelism is the maximum number of repositories tagged at once, zero means no limit.
+	Parallelism int
+	// Context carries the trace the operation is part of, nil starts a new trace.
+	Context context.Context
+}
+
+// Tag creates a tag at the HEAD of each repository in the workspace.
+//
+// Arguments:
+//   - args: The arguments for the tag.
+//
+// Returns:
+//   - []error: The errors of the repositories that could not be tagged.
+func Tag(args TagArgs) []error {
+	return ExecuteContext(ExecuteArgs{
+		Workspace:   args.Workspace,
+		Selector:    args.Selector,
+		Ordered:     args.Ordered,
+		Parallelism: args.Parallelism,
+		Operation:   "tag",
+		Context:     args.Context,
+	}, func(ctx context.Context, repo *config.Repository) error {
+		_, err := git.Tag(git.TagArgs{
+			Path:    fmt.Sprintf("%s/%s", files.ExpandPath(args.Workspace.Path), repo.Path),
+			Name:    args.Name,
+			Message: args.Message,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to tag %s: %w", repo.Name, err)
+		}
+		if !args.Push {
+			return nil
+		}
+		return repositories.Push(repositories.PushArgs{
+			PushArgs: git.PushArgs{
+				Remote:   repo.Origin,
+				RefSpecs: []string{fmt.Sprintf("refs/tags/%s:refs/tags/%s", args.Name, args.Name)},
+				Context:  ctx,
+			},
+			Workspace:  args.Workspace,
+			Repository: repo,
+		})
+	})
+}
@@ -0,0 +1,169 @@
+package workspaces
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/mateothegreat/go-util/files"
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/git"
+	"github.com/polyrepopro/api/history"
+)
+
+// UndoArgs are the arguments for undoing a workspace operation.
+type UndoArgs struct {
+	Workspace *config.Workspace
+	// Store is the history the operation was recorded in, nil uses history.Default().
+	Store *history.Store
+	// ID is the ID of the operation to undo, empty undoes the most recent
+	// operation recorded for the workspace.
+	ID string
+	// Context carries the trace the operation is part of, nil starts a new trace.
+	Context context.Context
+}
+
+// UndoResult reports what happened to the repositories of the undone operation.
+type UndoResult struct {
+	// ID is the ID of the undone operation.
+	ID string
+	// Operation is the name of the undone operation, such as "pull".
+	Operation string
+	// Reverted are the repositories restored to their branch and commit from before the operation.
+	Reverted []string
+	// Unchanged are the repositories that were already where they were before the operation.
+	Unchanged []string
+	// Failed are the repositories that could not be reverted.
+	Failed []string
+}
+
+// Undo restores every repository of a recorded operation to the branch and
+// commit HEAD pointed at before the operation. A repository is only reverted
+// when its worktree is clean and HEAD still points where the operation left
+// it, otherwise it is reported as failed and left alone. A repository the
+// operation cloned, such as by a sync, is reported as failed as well since
+// undo never removes a worktree.
+//
+// The undo is itself recorded in history.Default() as an "undo" operation, so
+// undoing the most recent operation twice restores the refs the first undo replaced.
+//
+// Arguments:
+//   - args: The arguments for the undo.
+//
+// Returns:
+//   - *UndoResult: The repositories reverted, unchanged and failed, nil if no operation could be found.
+//   - []error: The reasons repositories could not be reverted, or why no operation could be found.
+func Undo(args UndoArgs) (*UndoResult, []error) {
+	store := args.Store
+	if store == nil {
+		store = history.Default()
+	}
+	if store == nil {
+		return nil, []error{fmt.Errorf("no history is recorded")}
+	}
+
+	id := args.ID
+	if id == "" {
+		last, err := store.List(history.ListArgs{Workspace: args.Workspace.Name, Limit: 1})
+		if err != nil {
+			return nil, []error{err}
+		}
+		if len(last) == 0 {
+			return nil, []error{fmt.Errorf("no operation is recorded for workspace %s", args.Workspace.Name)}
+		}
+		id = last[0].ID
+	}
+	entries, err := store.List(history.ListArgs{ID: id})
+	if err != nil {
+		return nil, []error{err}
+	}
+	if len(entries) == 0 {
+		return nil, []error{fmt.Errorf("operation %s is not recorded", id)}
+	}
+
+	result := &UndoResult{ID: id, Operation: entries[0].Operation}
+	var errs []error
+
+	configured := args.Workspace.SelectRepositories(nil)
+	recorded := make(map[string]history.Entry)
+	var repositories []config.Repository
+	for _, entry := range entries {
+		i := slices.IndexFunc(configured, func(repo config.Repository) bool { return repo.Name == entry.Repository })
+		if i < 0 {
+			result.Failed = append(result.Failed, entry.Repository)
+			errs = append(errs, fmt.Errorf("failed to undo %s in %s: repository is not in workspace %s", entry.Operation, entry.Repository, args.Workspace.Name))
+			continue
+		}
+		recorded[entry.Repository] = entry
+		repositories = append(repositories, configured[i])
+	}
+	if len(repositories) == 0 {
+		return result, errs
+	}
+
+	var mu sync.Mutex
+	errs = append(errs, ExecuteContext(ExecuteArgs{
+		Workspace:    args.Workspace,
+		Repositories: repositories,
+		Operation:    "undo",
+		Context:      args.Context,
+	}, func(ctx context.Context, repo *config.Repository) error {
+		reverted, err := undoRepository(ctx, filepath.Join(files.ExpandPath(args.Workspace.Path), repo.Path), recorded[repo.Name])
+
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case err != nil:
+			result.Failed = append(result.Failed, repo.Name)
+			return fmt.Errorf("failed to undo %s in %s: %w", recorded[repo.Name].Operation, repo.Name, err)
+		case reverted:
+			result.Reverted = append(result.Reverted, repo.Name)
+		default:
+			result.Unchanged = append(result.Unchanged, repo.Name)
+		}
+		return nil
+	})...)
+
+	return result, errs
+}
+
+// undoRepository restores a repository to the ref recorded before an operation.
+//
+// Returns:
+//   - bool: Whether the repository was changed, false if it already was at the recorded ref.
+//   - error: An error if the repository could not be reverted.
+func undoRepository(ctx context.Context, path string, entry history.Entry) (bool, error) {
+	if entry.Before.Commit == "" {
+		if entry.After.Commit != "" {
+			// Undo never deletes a worktree, a clone has to be removed by hand.
+			return false, fmt.Errorf("the repository was cloned by the operation, remove it to undo the clone")
+		}
+		return false, fmt.Errorf("no ref was recorded before the operation")
+	}
+	current := ref(path)
+	if current == entry.Before {
+		return false, nil
+	}
+	if current != entry.After {
+		return false, fmt.Errorf("HEAD has moved since the operation, expected %s at %s but found %s at %s",
+			refName(entry.After), entry.After.Commit, refName(current), current.Commit)
+	}
+	if err := git.Restore(&git.RestoreArgs{
+		Path:    path,
+		Branch:  entry.Before.Branch,
+		Commit:  entry.Before.Commit,
+		Context: ctx,
+	}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func refName(ref history.Ref) string {
+	if ref.Branch == "" {
+		return "detached HEAD"
+	}
+	return ref.Branch
+}
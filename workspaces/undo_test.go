@@ -0,0 +1,105 @@
+package workspaces
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert"
+	"github.com/polyrepopro/api/config"
+	"github.com/polyrepopro/api/history"
+	"github.com/polyrepopro/api/test"
+)
+
+func TestUndo(t *testing.T) {
+	test.Setup()
+
+	base := t.TempDir()
+	run := func(dir string, args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com", "GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		out, err := cmd.CombinedOutput()
+		assert.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+	heads := make(map[string]string)
+	for _, name := range []string{"api", "web", "docs"} {
+		path := filepath.Join(base, "workspace", name)
+		run("", "init", "-q", "-b", "main", path)
+		run(path, "commit", "-q", "--allow-empty", "-m", "initial")
+		heads[name] = run(path, "rev-parse", "HEAD")
+		if name != "docs" {
+			run(path, "checkout", "-q", "-b", "feature")
+			run(path, "commit", "-q", "--allow-empty", "-m", "feature")
+			run(path, "checkout", "-q", "main")
+		}
+	}
+
+	workspace := &config.Workspace{
+		Name: "test",
+		Path: filepath.Join(base, "workspace"),
+		Repositories: &[]config.Repository{
+			{Name: "api", Path: "api"},
+			{Name: "web", Path: "web"},
+			{Name: "docs", Path: "docs"},
+		},
+	}
+
+	_, errs := Undo(UndoArgs{Workspace: workspace})
+	assert.EqualError(t, errs[0], "no history is recorded")
+
+	store, err := history.Open(filepath.Join(base, "history.jsonl"))
+	assert.NoError(t, err)
+	history.SetDefault(store)
+	defer history.SetDefault(nil)
+
+	_, errs = Undo(UndoArgs{Workspace: workspace})
+	assert.EqualError(t, errs[0], "no operation is recorded for workspace test")
+
+	// The docs repository has no feature branch and stays on main.
+	assert.Equal(t, 1, len(Switch(SwitchArgs{Workspace: workspace, Branch: "feature"})))
+	assert.Equal(t, "feature", run(filepath.Join(base, "workspace", "api"), "branch", "--show-current"))
+	assert.NoError(t, os.WriteFile(filepath.Join(base, "workspace", "web", "notes.txt"), []byte("wip"), 0644))
+
+	result, errs := Undo(UndoArgs{Workspace: workspace})
+	assert.Equal(t, 1, len(errs))
+	assert.Contains(t, errs[0].Error(), "failed to undo switch in web: worktree has uncommitted changes")
+	assert.Equal(t, "switch", result.Operation)
+	assert.Equal(t, []string{"api"}, result.Reverted)
+	assert.Equal(t, []string{"docs"}, result.Unchanged)
+	assert.Equal(t, []string{"web"}, result.Failed)
+	api := filepath.Join(base, "workspace", "api")
+	assert.Equal(t, "main", run(api, "branch", "--show-current"))
+	assert.Equal(t, heads["api"], run(api, "rev-parse", "HEAD"))
+	assert.Equal(t, "feature", run(filepath.Join(base, "workspace", "web"), "branch", "--show-current"))
+
+	// Undoing the undo switches api back to the feature branch.
+	redo, errs := Undo(UndoArgs{Workspace: workspace})
+	assert.Equal(t, 0, len(errs))
+	assert.Equal(t, "undo", redo.Operation)
+	assert.Equal(t, []string{"api"}, redo.Reverted)
+	assert.Equal(t, "feature", run(api, "branch", "--show-current"))
+
+	// An operation whose refs have moved since is not reverted.
+	run(api, "commit", "-q", "--allow-empty", "-m", "later")
+	result, errs = Undo(UndoArgs{Workspace: workspace, ID: result.ID})
+	assert.Equal(t, 2, len(errs))
+	assert.Equal(t, 0, len(result.Reverted))
+	assert.Contains(t, errs[0].Error()+errs[1].Error(), "HEAD has moved since the operation")
+
+	// A repository cloned by a sync is left in place.
+	assert.NoError(t, store.Append(history.Entry{
+		ID:         "cloned",
+		Operation:  "sync",
+		Workspace:  "test",
+		Repository: "docs",
+		After:      history.Ref{Branch: "main", Commit: heads["docs"]},
+	}))
+	result, errs = Undo(UndoArgs{Workspace: workspace, ID: "cloned"})
+	assert.Equal(t, 1, len(errs))
+	assert.Contains(t, errs[0].Error(), "failed to undo sync in docs: the repository was cloned by the operation")
+	assert.Equal(t, []string{"docs"}, result.Failed)
+}